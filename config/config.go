@@ -2,6 +2,8 @@ package config
 
 import (
 	"fmt"
+	"math"
+	"path"
 	"time"
 )
 
@@ -13,18 +15,216 @@ const (
 	PluginTypeScript PluginType = "script" // 脚本插件
 )
 
+// RestartPolicy 插件进程退出后的重启策略
+type RestartPolicy string
+
+const (
+	RestartAlways    RestartPolicy = "always"     // 任何退出都重启
+	RestartOnFailure RestartPolicy = "on-failure" // 仅在异常退出（非0退出码或被信号终止）时重启
+	RestartNever     RestartPolicy = "never"      // 不重启
+)
+
+// AdmissionPolicy 并发调用数达到上限时的处理策略 / Policy for calls over the concurrency limit
+type AdmissionPolicy string
+
+const (
+	AdmissionQueue  AdmissionPolicy = "queue"  // 排队等待，直到有调用结束或调用超时 / Wait until a call finishes or the call times out
+	AdmissionReject AdmissionPolicy = "reject" // 立即拒绝 / Reject immediately
+)
+
+// RateLimitPolicy 令牌耗尽时的处理策略 / Policy when the token bucket is empty
+type RateLimitPolicy string
+
+const (
+	RateLimitWait   RateLimitPolicy = "wait"   // 等待令牌补充，直到调用超时 / Wait for a token until the call times out
+	RateLimitReject RateLimitPolicy = "reject" // 立即拒绝 / Reject immediately
+)
+
 // PluginConfig 插件配置
 type PluginConfig struct {
-	Type                PluginType        `yaml:"type"`                  // 插件类型
-	Path                string            `yaml:"path"`                  // 插件可执行文件路径（二进制插件）
-	Interpreter         string            `yaml:"interpreter"`           // 解释器（脚本插件）
-	ScriptPath          string            `yaml:"script_path"`           // 脚本路径（脚本插件）
-	PoolSize            int               `yaml:"pool_size"`             // 初始池大小
-	MaxInstances        int               `yaml:"max_instances"`         // 最大实例数
-	HealthCheckInterval time.Duration     `yaml:"health_check_interval"` // 健康检查间隔
-	Args                []string          `yaml:"args"`                  // 启动参数
-	Functions           []string          `yaml:"functions"`             // 插件提供的函数列表
-	Environment         map[string]string `yaml:"environment"`           // 环境变量
+	Type                   PluginType                `yaml:"type"`                     // 插件类型
+	Path                   string                    `yaml:"path"`                     // 插件可执行文件路径（二进制插件）
+	Interpreter            string                    `yaml:"interpreter"`              // 解释器（脚本插件）
+	ScriptPath             string                    `yaml:"script_path"`              // 脚本路径（脚本插件）
+	PoolSize               int                       `yaml:"pool_size"`                // 初始池大小
+	MaxInstances           int                       `yaml:"max_instances"`            // 最大实例数
+	MinInstances           *int                      `yaml:"min_instances"`            // 最少保留的实例数，未配置时等于PoolSize，为0时首次调用才启动实例
+	IdleTimeout            time.Duration             `yaml:"idle_timeout"`             // 实例空闲超过该时间后被回收（不低于MinInstances），为0时不回收
+	Autoscale              bool                      `yaml:"autoscale"`                // 启用按负载自动扩缩容
+	TargetUtilization      float64                   `yaml:"target_utilization"`       // 自动扩缩容的目标槽位利用率，默认0.7
+	WarmSpares             int                       `yaml:"warm_spares"`              // 自动扩缩容时额外保留的空闲实例数
+	ScaleDownDelay         time.Duration             `yaml:"scale_down_delay"`         // 负载持续低于目标多久后开始缩容，默认30秒
+	InstanceConcurrency    int                       `yaml:"instance_concurrency"`     // 单个实例允许同时在途的调用数，只对支持多路复用的插件生效，默认16
+	StartupParallelism     int                       `yaml:"startup_parallelism"`      // 启动插件池时同时启动的实例数，默认4
+	MaxConcurrentCalls     int                       `yaml:"max_concurrent_calls"`     // 该插件允许同时在途的调用数，为0时只受全局上限约束
+	AdmissionPolicy        AdmissionPolicy           `yaml:"admission_policy"`         // 在途调用数达到该插件上限时的处理策略，未配置时使用系统的准入策略
+	AcquireTimeout         time.Duration             `yaml:"acquire_timeout"`          // 等待可用实例的最长时间，默认5秒，调用方的ctx更早结束时以ctx为准
+	MaxQueueLength         int                       `yaml:"max_queue_length"`         // 等待可用实例的最大排队数，队列已满时立即拒绝，为0时不限制
+	ReservedInstances      int                       `yaml:"reserved_instances"`       // 只供高优先级调用使用的实例数，低优先级调用最多占用其余实例
+	StarvationTimeout      time.Duration             `yaml:"starvation_timeout"`       // 排队超过该时间的调用不再让位于更高优先级，默认1秒
+	MaxCallsPerInstance    int64                     `yaml:"max_calls_per_instance"`   // 单个实例处理该数量的调用后被替换，为0时不限制
+	MaxLifetime            time.Duration             `yaml:"max_lifetime"`             // 实例运行超过该时间后被替换，为0时不限制
+	MaxRSS                 int64                     `yaml:"max_rss"`                  // 实例进程常驻内存（字节）超过该值后被替换，为0时不限制
+	MaxCPUTime             time.Duration             `yaml:"max_cpu_time"`             // 实例进程累计CPU时间超过该值后被替换，为0时不限制
+	ResourceSampleInterval time.Duration             `yaml:"resource_sample_interval"` // 采样实例进程资源占用的间隔，默认10秒
+	Codec                  string                    `yaml:"codec"`                    // 限定使用的编解码器（json/msgpack），为空时与插件自动协商
+	MaxFrameSize           int                       `yaml:"max_frame_size"`           // 最大帧大小（字节），为0时使用默认值16MB
+	HealthCheckInterval    time.Duration             `yaml:"health_check_interval"`    // 健康检查间隔
+	RestartPolicy          RestartPolicy             `yaml:"restart_policy"`           // 重启策略，默认on-failure
+	RestartBackoff         time.Duration             `yaml:"restart_backoff"`          // 首次重启的等待时间，之后按指数增长
+	MaxRestartBackoff      time.Duration             `yaml:"max_restart_backoff"`      // 重启等待时间上限
+	CrashLoopThreshold     int                       `yaml:"crash_loop_threshold"`     // 统计窗口内崩溃达到该次数时进入降级状态
+	CrashLoopWindow        time.Duration             `yaml:"crash_loop_window"`        // 崩溃次数统计窗口
+	DegradedRetryInterval  time.Duration             `yaml:"degraded_retry_interval"`  // 降级状态下后台重试的间隔
+	Args                   []string                  `yaml:"args"`                     // 启动参数
+	Functions              []string                  `yaml:"functions"`                // 插件提供的函数列表
+	RateLimit              *RateLimitConfig          `yaml:"rate_limit"`               // 该插件各函数默认的限流配置，为nil时使用系统的限流配置
+	CircuitBreaker         *CircuitBreakerConfig     `yaml:"circuit_breaker"`          // 插件级熔断器，统计该插件的全部调用，为nil时不启用
+	Resources              *ResourceLimits           `yaml:"resources"`                // 每个实例进程的资源限制，为nil时不限制
+	FunctionPolicies       map[string]FunctionPolicy `yaml:"function_policies"`        // 按函数名配置的调用策略，键为函数名或通配符模式（如"payment_*"）
+	Environment            map[string]string         `yaml:"environment"`              // 环境变量
+}
+
+// FunctionPolicy 函数调用策略
+type FunctionPolicy struct {
+	Timeout    time.Duration `yaml:"timeout"`     // 单次调用的超时时间，未配置时只受调用方截止时间和系统默认调用超时约束
+	MaxRetries *int          `yaml:"max_retries"` // 幂等函数在实例崩溃或连接断开后的最大重试次数，未配置时为2，配置为0时不重试
+	Backoff    time.Duration `yaml:"backoff"`     // 首次重试前的等待时间，之后每次翻倍，默认100毫秒
+	Idempotent bool          `yaml:"idempotent"`  // 函数是否幂等，只有幂等函数会被重试
+
+	CircuitBreaker *CircuitBreakerConfig `yaml:"circuit_breaker"` // 该函数独立的熔断器，为nil时只受插件级熔断器约束
+	RateLimit      *RateLimitConfig      `yaml:"rate_limit"`      // 该函数的限流配置，为nil时使用插件或系统的限流配置
+}
+
+// CircuitBreakerConfig 熔断器配置
+// 连续失败次数或统计窗口内的错误率达到阈值时熔断，熔断期间调用直接失败，
+// OpenTimeout后进入半开状态放行少量探测调用，探测全部成功后恢复
+type CircuitBreakerConfig struct {
+	ConsecutiveFailures int           `yaml:"consecutive_failures"` // 连续失败达到该次数时熔断，默认5
+	ErrorRate           float64       `yaml:"error_rate"`           // 统计窗口内错误率达到该值时熔断（0~1），为0时不按错误率熔断
+	MinRequests         int           `yaml:"min_requests"`         // 按错误率判断前统计窗口内至少需要的调用数，默认10
+	Window              time.Duration `yaml:"window"`               // 错误率统计窗口，默认1分钟
+	OpenTimeout         time.Duration `yaml:"open_timeout"`         // 熔断后进入半开状态前的等待时间，默认30秒
+	HalfOpenRequests    int           `yaml:"half_open_requests"`   // 半开状态允许通过的探测调用数，默认1
+}
+
+// GetConsecutiveFailures 获取触发熔断的连续失败次数，未配置时为5
+func (c *CircuitBreakerConfig) GetConsecutiveFailures() int {
+	if c.ConsecutiveFailures <= 0 {
+		return 5
+	}
+	return c.ConsecutiveFailures
+}
+
+// GetMinRequests 获取按错误率判断前至少需要的调用数，未配置时为10
+func (c *CircuitBreakerConfig) GetMinRequests() int {
+	if c.MinRequests <= 0 {
+		return 10
+	}
+	return c.MinRequests
+}
+
+// GetWindow 获取错误率统计窗口，未配置时为1分钟
+func (c *CircuitBreakerConfig) GetWindow() time.Duration {
+	if c.Window <= 0 {
+		return time.Minute
+	}
+	return c.Window
+}
+
+// GetOpenTimeout 获取熔断后进入半开状态前的等待时间，未配置时为30秒
+func (c *CircuitBreakerConfig) GetOpenTimeout() time.Duration {
+	if c.OpenTimeout <= 0 {
+		return 30 * time.Second
+	}
+	return c.OpenTimeout
+}
+
+// GetHalfOpenRequests 获取半开状态允许通过的探测调用数，未配置时为1
+func (c *CircuitBreakerConfig) GetHalfOpenRequests() int {
+	if c.HalfOpenRequests <= 0 {
+		return 1
+	}
+	return c.HalfOpenRequests
+}
+
+// validate 检查熔断器配置
+func (c *CircuitBreakerConfig) validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.ErrorRate < 0 || c.ErrorRate > 1 {
+		return fmt.Errorf("熔断错误率 %v 必须在0到1之间", c.ErrorRate)
+	}
+	if c.ConsecutiveFailures < 0 || c.MinRequests < 0 || c.Window < 0 || c.OpenTimeout < 0 || c.HalfOpenRequests < 0 {
+		return fmt.Errorf("熔断器配置不能包含负数")
+	}
+	return nil
+}
+
+// ResourceLimits 实例进程的资源限制
+// Linux上使用cgroup v2：每个插件池在CgroupParent下拥有一个子树，每个实例进程位于其中独立的子cgroup；
+// 未配置CgroupParent或cgroup不可用时退化为setrlimit，只能限制内存（RLIMIT_DATA），
+// CPU配额和进程数不生效，并在实例状态的limits.unenforced中列出
+type ResourceLimits struct {
+	MemoryMax    int64   `yaml:"memory_max"`    // 单个实例的内存上限（字节），超过时进程被OOM终止，为0时不限制
+	CPUQuota     float64 `yaml:"cpu_quota"`     // 单个实例可用的CPU核数，例如0.5表示半个核，为0时不限制
+	PidsMax      int64   `yaml:"pids_max"`      // 单个实例内的最大进程（线程）数，为0时不限制
+	CgroupParent string  `yaml:"cgroup_parent"` // 创建插件池子树的cgroup路径（相对cgroup v2挂载点），需要已委派给主机进程且不含进程；为空时不使用cgroup
+}
+
+// validate 检查资源限制
+func (r *ResourceLimits) validate() error {
+	if r == nil {
+		return nil
+	}
+	if r.MemoryMax < 0 || r.CPUQuota < 0 || r.PidsMax < 0 {
+		return fmt.Errorf("资源限制不能为负数")
+	}
+	return nil
+}
+
+// RateLimitConfig 令牌桶限流配置，每个函数独立计数 / Token bucket rate limit, counted per function
+type RateLimitConfig struct {
+	Rate      float64         `yaml:"rate"`       // 每秒补充的令牌数，即每秒允许的调用数 / Tokens added per second
+	Burst     int             `yaml:"burst"`      // 令牌桶容量，允许的突发调用数，默认为Rate向上取整 / Bucket size, defaults to ceil(Rate)
+	PerCaller bool            `yaml:"per_caller"` // 按调用方（CallOptions.CallerID）分别限流 / Limit each caller ID separately
+	Policy    RateLimitPolicy `yaml:"policy"`     // 令牌耗尽时的处理策略，默认wait / Policy when out of tokens, default wait
+}
+
+// GetBurst 获取令牌桶容量，未配置时为Rate向上取整且至少为1 / Get the bucket size
+func (r *RateLimitConfig) GetBurst() int {
+	if r.Burst > 0 {
+		return r.Burst
+	}
+	return max(int(math.Ceil(r.Rate)), 1)
+}
+
+// GetPolicy 获取令牌耗尽时的处理策略，未配置时为wait / Get the policy, wait by default
+func (r *RateLimitConfig) GetPolicy() RateLimitPolicy {
+	if r.Policy == "" {
+		return RateLimitWait
+	}
+	return r.Policy
+}
+
+// validate 检查限流配置
+func (r *RateLimitConfig) validate() error {
+	if r == nil {
+		return nil
+	}
+	if r.Rate <= 0 {
+		return fmt.Errorf("限流速率必须大于0")
+	}
+	if r.Burst < 0 {
+		return fmt.Errorf("限流突发数不能为负数")
+	}
+	switch r.Policy {
+	case "", RateLimitWait, RateLimitReject:
+	default:
+		return fmt.Errorf("限流策略 %s 不支持", r.Policy)
+	}
+	return nil
 }
 
 // SystemConfig 系统配置 / System Configuration
@@ -38,14 +238,48 @@ type SystemConfig struct {
 
 // SystemSettings 系统设置 / System Settings
 type SystemSettings struct {
-	LogLevel           string `yaml:"log_level"`            // 日志级别 / Log level
-	LogFile            string `yaml:"log_file"`             // 日志文件路径 / Log file path
-	MaxConcurrentCalls int    `yaml:"max_concurrent_calls"` // 最大并发调用数 / Max concurrent calls
-	CallTimeout        string `yaml:"call_timeout"`         // 调用超时时间 / Call timeout
-	EnableMetrics      bool   `yaml:"enable_metrics"`       // 启用性能指标收集 / Enable metrics collection
-	MetricsPort        int    `yaml:"metrics_port"`         // 指标服务端口 / Metrics service port
-	EnableAuth         bool   `yaml:"enable_auth"`          // 启用认证 / Enable authentication
-	AuthToken          string `yaml:"auth_token"`           // 认证令牌 / Authentication token
+	LogLevel           string           `yaml:"log_level"`            // 日志级别 / Log level
+	LogFile            string           `yaml:"log_file"`             // 日志文件路径 / Log file path
+	MaxConcurrentCalls int              `yaml:"max_concurrent_calls"` // 最大并发调用数，为0时不限制 / Max concurrent calls, 0 means unlimited
+	CallTimeout        string           `yaml:"call_timeout"`         // 调用超时时间，如"30s"，默认30秒，为"0"时不限制 / Call timeout, e.g. "30s", default 30s, "0" means unlimited
+	AdmissionPolicy    AdmissionPolicy  `yaml:"admission_policy"`     // 超过并发上限时的处理策略，默认queue / Policy for calls over the limit, default queue
+	RateLimit          *RateLimitConfig `yaml:"rate_limit"`           // 所有插件函数默认的限流配置 / Default rate limit for every plugin function
+	StartupParallelism int              `yaml:"startup_parallelism"`  // 同时启动的插件池数，默认4 / Plugin pools started concurrently, default 4
+	EnableMetrics      bool             `yaml:"enable_metrics"`       // 启用性能指标收集 / Enable metrics collection
+	MetricsPort        int              `yaml:"metrics_port"`         // 指标服务端口 / Metrics service port
+	EnableAuth         bool             `yaml:"enable_auth"`          // 启用认证 / Enable authentication
+	AuthToken          string           `yaml:"auth_token"`           // 认证令牌 / Authentication token
+}
+
+// GetCallTimeout 解析默认调用超时时间，未配置时为30秒，配置为"0"时返回0（不限制） / Parse the default call timeout, 30s when unset, 0 (unlimited) when set to "0"
+func (s *SystemSettings) GetCallTimeout() (time.Duration, error) {
+	if s.CallTimeout == "" {
+		return 30 * time.Second, nil
+	}
+	timeout, err := time.ParseDuration(s.CallTimeout)
+	if err != nil {
+		return 0, fmt.Errorf("调用超时时间 %q 格式错误: %w", s.CallTimeout, err)
+	}
+	if timeout < 0 {
+		return 0, fmt.Errorf("调用超时时间 %q 不能为负数", s.CallTimeout)
+	}
+	return timeout, nil
+}
+
+// GetAdmissionPolicy 获取超过并发上限时的处理策略，未配置时为queue / Get the admission policy, queue by default
+func (s *SystemSettings) GetAdmissionPolicy() AdmissionPolicy {
+	if s.AdmissionPolicy == "" {
+		return AdmissionQueue
+	}
+	return s.AdmissionPolicy
+}
+
+// GetStartupParallelism 获取同时启动的插件池数，未配置时为4 / Get how many plugin pools start concurrently, 4 by default
+func (s *SystemSettings) GetStartupParallelism() int {
+	if s.StartupParallelism <= 0 {
+		return 4
+	}
+	return s.StartupParallelism
 }
 
 // PlatformConfig 平台特定配置 / Platform-specific Configuration
@@ -81,6 +315,24 @@ func ValidateConfig(config *SystemConfig) error {
 		return fmt.Errorf("至少需要配置一个插件")
 	}
 
+	if config.System.MaxConcurrentCalls < 0 {
+		return fmt.Errorf("最大并发调用数不能为负数")
+	}
+	if config.System.StartupParallelism < 0 {
+		return fmt.Errorf("启动并行度不能为负数")
+	}
+	if _, err := config.System.GetCallTimeout(); err != nil {
+		return err
+	}
+	if err := config.System.RateLimit.validate(); err != nil {
+		return err
+	}
+	switch config.System.AdmissionPolicy {
+	case "", AdmissionQueue, AdmissionReject:
+	default:
+		return fmt.Errorf("准入策略 %s 不支持", config.System.AdmissionPolicy)
+	}
+
 	for name, pluginConfig := range config.Plugins {
 		switch pluginConfig.Type {
 		case PluginTypeBinary:
@@ -107,10 +359,72 @@ func ValidateConfig(config *SystemConfig) error {
 		if pluginConfig.HealthCheckInterval <= 0 {
 			pluginConfig.HealthCheckInterval = 30 * time.Second
 		}
+		if pluginConfig.GetMinInstances() > pluginConfig.MaxInstances {
+			return fmt.Errorf("插件 %s 的最少实例数 %d 超过最大实例数 %d", name, pluginConfig.GetMinInstances(), pluginConfig.MaxInstances)
+		}
+		if pluginConfig.MaxQueueLength < 0 {
+			return fmt.Errorf("插件 %s 的最大排队数不能为负数", name)
+		}
+		if pluginConfig.MaxConcurrentCalls < 0 {
+			return fmt.Errorf("插件 %s 的最大并发调用数不能为负数", name)
+		}
+		if pluginConfig.StartupParallelism < 0 {
+			return fmt.Errorf("插件 %s 的启动并行度不能为负数", name)
+		}
+		if pluginConfig.ReservedInstances < 0 || (pluginConfig.ReservedInstances > 0 && pluginConfig.ReservedInstances >= pluginConfig.MaxInstances) {
+			return fmt.Errorf("插件 %s 的保留实例数 %d 必须小于最大实例数 %d", name, pluginConfig.ReservedInstances, pluginConfig.MaxInstances)
+		}
+		if pluginConfig.StarvationTimeout < 0 {
+			return fmt.Errorf("插件 %s 的饥饿超时不能为负数", name)
+		}
+		if pluginConfig.MaxCallsPerInstance < 0 || pluginConfig.MaxLifetime < 0 {
+			return fmt.Errorf("插件 %s 的实例最大调用数和最长运行时间不能为负数", name)
+		}
+		if pluginConfig.MaxRSS < 0 || pluginConfig.MaxCPUTime < 0 || pluginConfig.ResourceSampleInterval < 0 {
+			return fmt.Errorf("插件 %s 的资源上限和采样间隔不能为负数", name)
+		}
+		for pattern, policy := range pluginConfig.FunctionPolicies {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("插件 %s 的函数策略 %s 模式错误: %w", name, pattern, err)
+			}
+			if policy.Timeout < 0 || (policy.MaxRetries != nil && *policy.MaxRetries < 0) || policy.Backoff < 0 {
+				return fmt.Errorf("插件 %s 的函数策略 %s 不能包含负数", name, pattern)
+			}
+			if err := policy.CircuitBreaker.validate(); err != nil {
+				return fmt.Errorf("插件 %s 的函数策略 %s: %w", name, pattern, err)
+			}
+			if err := policy.RateLimit.validate(); err != nil {
+				return fmt.Errorf("插件 %s 的函数策略 %s: %w", name, pattern, err)
+			}
+		}
+		if err := pluginConfig.CircuitBreaker.validate(); err != nil {
+			return fmt.Errorf("插件 %s: %w", name, err)
+		}
+		if err := pluginConfig.Resources.validate(); err != nil {
+			return fmt.Errorf("插件 %s: %w", name, err)
+		}
+		if err := pluginConfig.RateLimit.validate(); err != nil {
+			return fmt.Errorf("插件 %s: %w", name, err)
+		}
+		switch pluginConfig.AdmissionPolicy {
+		case "", AdmissionQueue, AdmissionReject:
+		default:
+			return fmt.Errorf("插件 %s 的准入策略 %s 不支持", name, pluginConfig.AdmissionPolicy)
+		}
+		switch pluginConfig.RestartPolicy {
+		case "":
+			pluginConfig.RestartPolicy = RestartOnFailure
+		case RestartAlways, RestartOnFailure, RestartNever:
+		default:
+			return fmt.Errorf("插件 %s 的重启策略 %s 不支持", name, pluginConfig.RestartPolicy)
+		}
 
 		if len(pluginConfig.Functions) == 0 {
 			return fmt.Errorf("插件 %s 必须至少提供一个函数", name)
 		}
+
+		// pluginConfig是副本，写回后默认值才会生效
+		config.Plugins[name] = pluginConfig
 	}
 
 	return nil
@@ -129,3 +443,171 @@ func (p *PluginConfig) GetPluginCommand() (string, []string) {
 		return "", nil
 	}
 }
+
+// GetHealthCheckInterval 获取健康检查间隔，未配置时为30秒
+func (p *PluginConfig) GetHealthCheckInterval() time.Duration {
+	if p.HealthCheckInterval <= 0 {
+		return 30 * time.Second
+	}
+	return p.HealthCheckInterval
+}
+
+// GetMinInstances 获取最少保留的实例数，未配置时等于PoolSize
+func (p *PluginConfig) GetMinInstances() int {
+	if p.MinInstances == nil {
+		return p.PoolSize
+	}
+	if *p.MinInstances < 0 {
+		return 0
+	}
+	return *p.MinInstances
+}
+
+// GetTargetUtilization 获取自动扩缩容的目标槽位利用率，未配置或超出(0,1]时为0.7
+func (p *PluginConfig) GetTargetUtilization() float64 {
+	if p.TargetUtilization <= 0 || p.TargetUtilization > 1 {
+		return 0.7
+	}
+	return p.TargetUtilization
+}
+
+// GetScaleDownDelay 获取缩容前需要持续低负载的时间，未配置时为30秒
+func (p *PluginConfig) GetScaleDownDelay() time.Duration {
+	if p.ScaleDownDelay <= 0 {
+		return 30 * time.Second
+	}
+	return p.ScaleDownDelay
+}
+
+// GetRestartPolicy 获取重启策略，未配置时为on-failure
+func (p *PluginConfig) GetRestartPolicy() RestartPolicy {
+	if p.RestartPolicy == "" {
+		return RestartOnFailure
+	}
+	return p.RestartPolicy
+}
+
+// GetRestartBackoff 获取首次重启的等待时间，未配置时为500毫秒
+func (p *PluginConfig) GetRestartBackoff() time.Duration {
+	if p.RestartBackoff <= 0 {
+		return 500 * time.Millisecond
+	}
+	return p.RestartBackoff
+}
+
+// GetMaxRestartBackoff 获取重启等待时间上限，未配置时为30秒
+func (p *PluginConfig) GetMaxRestartBackoff() time.Duration {
+	if p.MaxRestartBackoff <= 0 {
+		return 30 * time.Second
+	}
+	return p.MaxRestartBackoff
+}
+
+// GetCrashLoopThreshold 获取进入降级状态的崩溃次数，未配置时为5次
+func (p *PluginConfig) GetCrashLoopThreshold() int {
+	if p.CrashLoopThreshold <= 0 {
+		return 5
+	}
+	return p.CrashLoopThreshold
+}
+
+// GetCrashLoopWindow 获取崩溃次数统计窗口，未配置时为1分钟
+func (p *PluginConfig) GetCrashLoopWindow() time.Duration {
+	if p.CrashLoopWindow <= 0 {
+		return time.Minute
+	}
+	return p.CrashLoopWindow
+}
+
+// GetDegradedRetryInterval 获取降级状态下后台重试的间隔，未配置时为1分钟
+func (p *PluginConfig) GetDegradedRetryInterval() time.Duration {
+	if p.DegradedRetryInterval <= 0 {
+		return time.Minute
+	}
+	return p.DegradedRetryInterval
+}
+
+// GetStartupParallelism 获取启动插件池时同时启动的实例数，未配置时为4
+func (p *PluginConfig) GetStartupParallelism() int {
+	if p.StartupParallelism <= 0 {
+		return 4
+	}
+	return p.StartupParallelism
+}
+
+// GetInstanceConcurrency 获取单个实例允许同时在途的调用数，multiplex为插件是否支持多路复用
+// 不支持多路复用的插件同一时间只处理一个调用；支持时未配置则为16
+func (p *PluginConfig) GetInstanceConcurrency(multiplex bool) int {
+	if !multiplex {
+		return 1
+	}
+	if p.InstanceConcurrency <= 0 {
+		return 16
+	}
+	return p.InstanceConcurrency
+}
+
+// GetAcquireTimeout 获取等待可用实例的最长时间，未配置时为5秒
+func (p *PluginConfig) GetAcquireTimeout() time.Duration {
+	if p.AcquireTimeout <= 0 {
+		return 5 * time.Second
+	}
+	return p.AcquireTimeout
+}
+
+// GetResourceSampleInterval 获取资源采样间隔，未配置时为10秒
+func (p *PluginConfig) GetResourceSampleInterval() time.Duration {
+	if p.ResourceSampleInterval <= 0 {
+		return 10 * time.Second
+	}
+	return p.ResourceSampleInterval
+}
+
+// GetStarvationTimeout 获取低优先级调用的最长让位时间，未配置时为1秒
+func (p *PluginConfig) GetStarvationTimeout() time.Duration {
+	if p.StarvationTimeout <= 0 {
+		return time.Second
+	}
+	return p.StarvationTimeout
+}
+
+// GetAdmissionPolicy 获取在途调用数达到插件上限时的处理策略，未配置时为系统的准入策略
+func (p *PluginConfig) GetAdmissionPolicy(system AdmissionPolicy) AdmissionPolicy {
+	if p.AdmissionPolicy == "" {
+		return system
+	}
+	return p.AdmissionPolicy
+}
+
+// GetFunctionPolicy 获取函数的调用策略并填充默认值
+// 精确匹配函数名的策略优先，其次是匹配的通配符模式中最长的一个（长度相同时取字典序较小的）
+func (p *PluginConfig) GetFunctionPolicy(functionName string) FunctionPolicy {
+	policy, exists := p.FunctionPolicies[functionName]
+	if !exists {
+		matched := ""
+		for pattern, candidate := range p.FunctionPolicies {
+			if ok, _ := path.Match(pattern, functionName); !ok {
+				continue
+			}
+			if !exists || len(pattern) > len(matched) || (len(pattern) == len(matched) && pattern < matched) {
+				exists = true
+				matched = pattern
+				policy = candidate
+			}
+		}
+	}
+
+	// 返回的MaxRetries总是非nil，不与配置共享指针
+	retries := 2
+	if policy.MaxRetries != nil {
+		retries = *policy.MaxRetries
+	}
+	if !policy.Idempotent {
+		retries = 0
+	}
+	policy.MaxRetries = &retries
+	if policy.Backoff <= 0 {
+		policy.Backoff = 100 * time.Millisecond
+	}
+	return policy
+}
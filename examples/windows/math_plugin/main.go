@@ -9,11 +9,11 @@ import (
 
 // Add 加法函数
 func Add(params map[string]interface{}) (interface{}, error) {
-	a, ok := params["a"].(float64)
+	a, ok := sdk.ToFloat64(params["a"])
 	if !ok {
 		return nil, fmt.Errorf("参数a缺失或类型错误")
 	}
-	b, ok := params["b"].(float64)
+	b, ok := sdk.ToFloat64(params["b"])
 	if !ok {
 		return nil, fmt.Errorf("参数b缺失或类型错误")
 	}
@@ -22,11 +22,11 @@ func Add(params map[string]interface{}) (interface{}, error) {
 
 // Subtract 减法函数
 func Subtract(params map[string]interface{}) (interface{}, error) {
-	a, ok := params["a"].(float64)
+	a, ok := sdk.ToFloat64(params["a"])
 	if !ok {
 		return nil, fmt.Errorf("参数a缺失或类型错误")
 	}
-	b, ok := params["b"].(float64)
+	b, ok := sdk.ToFloat64(params["b"])
 	if !ok {
 		return nil, fmt.Errorf("参数b缺失或类型错误")
 	}
@@ -35,11 +35,11 @@ func Subtract(params map[string]interface{}) (interface{}, error) {
 
 // Multiply 乘法函数
 func Multiply(params map[string]interface{}) (interface{}, error) {
-	a, ok := params["a"].(float64)
+	a, ok := sdk.ToFloat64(params["a"])
 	if !ok {
 		return nil, fmt.Errorf("参数a缺失或类型错误")
 	}
-	b, ok := params["b"].(float64)
+	b, ok := sdk.ToFloat64(params["b"])
 	if !ok {
 		return nil, fmt.Errorf("参数b缺失或类型错误")
 	}
@@ -48,11 +48,11 @@ func Multiply(params map[string]interface{}) (interface{}, error) {
 
 // Divide 除法函数
 func Divide(params map[string]interface{}) (interface{}, error) {
-	a, ok := params["a"].(float64)
+	a, ok := sdk.ToFloat64(params["a"])
 	if !ok {
 		return nil, fmt.Errorf("参数a缺失或类型错误")
 	}
-	b, ok := params["b"].(float64)
+	b, ok := sdk.ToFloat64(params["b"])
 	if !ok {
 		return nil, fmt.Errorf("参数b缺失或类型错误")
 	}
@@ -64,11 +64,11 @@ func Divide(params map[string]interface{}) (interface{}, error) {
 
 // Power 幂运算函数
 func Power(params map[string]interface{}) (interface{}, error) {
-	base, ok := params["base"].(float64)
+	base, ok := sdk.ToFloat64(params["base"])
 	if !ok {
 		return nil, fmt.Errorf("参数base缺失或类型错误")
 	}
-	exponent, ok := params["exponent"].(float64)
+	exponent, ok := sdk.ToFloat64(params["exponent"])
 	if !ok {
 		return nil, fmt.Errorf("参数exponent缺失或类型错误")
 	}
@@ -77,7 +77,7 @@ func Power(params map[string]interface{}) (interface{}, error) {
 
 // SquareRoot 平方根函数
 func SquareRoot(params map[string]interface{}) (interface{}, error) {
-	num, ok := params["num"].(float64)
+	num, ok := sdk.ToFloat64(params["num"])
 	if !ok {
 		return nil, fmt.Errorf("参数num缺失或类型错误")
 	}
@@ -126,4 +126,4 @@ func main() {
 
 	// 等待插件运行直到停止
 	sdk.Wait()
-}
\ No newline at end of file
+}
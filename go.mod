@@ -5,6 +5,5 @@ go 1.24.2
 require (
 	github.com/Microsoft/go-winio v0.6.2
 	github.com/google/uuid v1.3.0
+	golang.org/x/sys v0.10.0
 )
-
-require golang.org/x/sys v0.10.0 // indirect
@@ -0,0 +1,91 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/hoonfeng/goproc/config"
+)
+
+// admissionLimiter 并发调用准入控制
+// 在途调用数达到上限时按策略拒绝或排队，排队的调用在ctx结束时放弃
+type admissionLimiter struct {
+	scope  string                 // 限制范围，用于错误信息
+	limit  int                    // 允许同时在途的调用数
+	policy config.AdmissionPolicy // 超过上限时的处理策略
+	tokens chan struct{}          // 每个元素代表一个在途调用
+
+	waiting  int64 // 正在排队的调用数
+	admitted int64 // 已准入的调用总数
+	rejected int64 // 被拒绝的调用总数
+	timeouts int64 // 排队超时或被取消的调用总数
+}
+
+// newAdmissionLimiter 创建准入控制，limit不大于0时返回nil，表示不限制
+func newAdmissionLimiter(scope string, limit int, policy config.AdmissionPolicy) *admissionLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &admissionLimiter{
+		scope:  scope,
+		limit:  limit,
+		policy: policy,
+		tokens: make(chan struct{}, limit),
+	}
+}
+
+// acquire 申请一个在途调用名额，成功后调用方必须调用release
+func (l *admissionLimiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	select {
+	case l.tokens <- struct{}{}:
+		atomic.AddInt64(&l.admitted, 1)
+		return nil
+	default:
+	}
+
+	if l.policy == config.AdmissionReject {
+		atomic.AddInt64(&l.rejected, 1)
+		return fmt.Errorf("%w: %s 在途调用数已达上限 %d", ErrTooManyCalls, l.scope, l.limit)
+	}
+
+	atomic.AddInt64(&l.waiting, 1)
+	defer atomic.AddInt64(&l.waiting, -1)
+
+	select {
+	case l.tokens <- struct{}{}:
+		atomic.AddInt64(&l.admitted, 1)
+		return nil
+	case <-ctx.Done():
+		atomic.AddInt64(&l.timeouts, 1)
+		return fmt.Errorf("%w: %s 排队等待准入失败: %w", ErrTooManyCalls, l.scope, ctx.Err())
+	}
+}
+
+// release 归还一个在途调用名额
+func (l *admissionLimiter) release() {
+	if l == nil {
+		return
+	}
+	<-l.tokens
+}
+
+// status 准入控制状态输出，未限制时返回nil
+func (l *admissionLimiter) status() map[string]interface{} {
+	if l == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"limit":     l.limit,
+		"policy":    string(l.policy),
+		"in_flight": len(l.tokens),
+		"waiting":   atomic.LoadInt64(&l.waiting),
+		"admitted":  atomic.LoadInt64(&l.admitted),
+		"rejected":  atomic.LoadInt64(&l.rejected),
+		"timeouts":  atomic.LoadInt64(&l.timeouts),
+	}
+}
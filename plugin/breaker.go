@@ -0,0 +1,318 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hoonfeng/goproc/config"
+	"github.com/hoonfeng/goproc/sdk"
+)
+
+// 熔断器状态
+const (
+	CircuitClosed   = "closed"    // 正常放行
+	CircuitOpen     = "open"      // 熔断中，调用直接失败
+	CircuitHalfOpen = "half-open" // 放行少量探测调用，根据结果恢复或重新熔断
+)
+
+// breakerBuckets 错误率统计窗口划分的桶数
+const breakerBuckets = 10
+
+// breakerBucket 统计窗口中一个时间段内的调用结果
+type breakerBucket struct {
+	start    time.Time
+	total    int
+	failures int
+}
+
+// circuitBreaker 熔断器
+type circuitBreaker struct {
+	name   string // 熔断范围，用于错误信息和状态输出
+	config *config.CircuitBreakerConfig
+
+	mutex       sync.Mutex
+	state       string
+	consecutive int                           // 连续失败次数
+	buckets     [breakerBuckets]breakerBucket // 错误率统计窗口
+	openedAt    time.Time                     // 最近一次熔断的时间
+	probes      int                           // 半开状态下已放行且未结束的探测调用数
+	successes   int                           // 半开状态下成功的探测调用数
+	lastError   string                        // 最近一次计入失败的错误
+	opened      int64                         // 熔断总次数
+	rejected    int64                         // 熔断期间被拒绝的调用总数
+}
+
+// newCircuitBreaker 创建熔断器，cfg为nil时返回nil，表示不启用
+func newCircuitBreaker(name string, cfg *config.CircuitBreakerConfig) *circuitBreaker {
+	if cfg == nil {
+		return nil
+	}
+	return &circuitBreaker{name: name, config: cfg, state: CircuitClosed}
+}
+
+// allow 判断调用是否可以通过，通过后调用方必须用调用结果调用done
+func (b *circuitBreaker) allow() (done func(error), err error) {
+	if b == nil {
+		return func(error) {}, nil
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := time.Now()
+	if b.state == CircuitOpen {
+		retryAt := b.openedAt.Add(b.config.GetOpenTimeout())
+		if now.Before(retryAt) {
+			b.rejected++
+			return nil, fmt.Errorf("%w: %s 将在 %s 后重试，最近一次错误: %s",
+				ErrCircuitOpen, b.name, retryAt.Sub(now).Round(time.Millisecond), b.lastError)
+		}
+		b.state = CircuitHalfOpen
+		b.probes = 0
+		b.successes = 0
+	}
+
+	if b.state == CircuitHalfOpen {
+		if b.probes >= b.config.GetHalfOpenRequests() {
+			b.rejected++
+			return nil, fmt.Errorf("%w: %s 正在探测恢复", ErrCircuitOpen, b.name)
+		}
+		b.probes++
+		return func(err error) { b.record(err, true) }, nil
+	}
+
+	return func(err error) { b.record(err, false) }, nil
+}
+
+// record 记录一次调用结果
+func (b *circuitBreaker) record(err error, probe bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	failed, counted := breakerOutcome(err)
+
+	// 半开状态：任何失败都重新熔断，探测全部成功后恢复；不计入统计的结果只归还探测名额
+	if probe {
+		if b.state != CircuitHalfOpen {
+			return
+		}
+		b.probes--
+		if !counted {
+			return
+		}
+		if failed {
+			b.lastError = err.Error()
+			b.trip()
+			return
+		}
+		b.successes++
+		if b.successes >= b.config.GetHalfOpenRequests() {
+			b.reset()
+		}
+		return
+	}
+
+	if !counted || b.state != CircuitClosed {
+		return
+	}
+
+	bucket := b.bucket(time.Now())
+	bucket.total++
+	if !failed {
+		b.consecutive = 0
+		return
+	}
+	bucket.failures++
+	b.consecutive++
+	b.lastError = err.Error()
+
+	if b.consecutive >= b.config.GetConsecutiveFailures() {
+		b.trip()
+		return
+	}
+	if b.config.ErrorRate > 0 {
+		total, failures := b.windowCounts(time.Now())
+		if total >= b.config.GetMinRequests() && float64(failures)/float64(total) >= b.config.ErrorRate {
+			b.trip()
+		}
+	}
+}
+
+// trip 进入熔断状态
+func (b *circuitBreaker) trip() {
+	b.state = CircuitOpen
+	b.openedAt = time.Now()
+	b.opened++
+}
+
+// reset 恢复正常状态并清空统计
+func (b *circuitBreaker) reset() {
+	b.state = CircuitClosed
+	b.consecutive = 0
+	b.probes = 0
+	b.successes = 0
+	b.buckets = [breakerBuckets]breakerBucket{}
+}
+
+// bucket 返回当前时间所在的统计桶，过期的桶会被重置
+func (b *circuitBreaker) bucket(now time.Time) *breakerBucket {
+	width := b.config.GetWindow() / breakerBuckets
+	if width <= 0 {
+		width = time.Nanosecond
+	}
+	start := now.Truncate(width)
+	bucket := &b.buckets[(start.UnixNano()/int64(width))%breakerBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = breakerBucket{start: start}
+	}
+	return bucket
+}
+
+// windowCounts 统计窗口内的调用数和失败数
+func (b *circuitBreaker) windowCounts(now time.Time) (total int, failures int) {
+	window := b.config.GetWindow()
+	for _, bucket := range b.buckets {
+		if now.Sub(bucket.start) < window {
+			total += bucket.total
+			failures += bucket.failures
+		}
+	}
+	return total, failures
+}
+
+// breakerOutcome 判断调用结果是否计入熔断统计以及是否算作失败
+// 调用方取消、本地排队或限流导致的失败不反映插件的状况，不计入统计；
+// 插件明确返回的业务错误（参数错误、资源不存在等）说明插件工作正常，算作成功
+func breakerOutcome(err error) (failed bool, counted bool) {
+	if err == nil {
+		return false, true
+	}
+
+	var remote *RemoteError
+	if errors.As(err, &remote) {
+		switch remote.Code {
+		case sdk.ErrorCodeInvalidArgument, sdk.ErrorCodeNotFound, sdk.ErrorCodeFunctionNotFound:
+			return false, true
+		case sdk.ErrorCodeCanceled:
+			return false, false
+		}
+		return true, true
+	}
+
+	if errors.Is(err, ErrTimeout) || errors.Is(err, ErrInstanceCrashed) || errors.Is(err, ErrConnectionLost) {
+		return true, true
+	}
+	return false, false
+}
+
+// status 熔断器状态输出，未启用时返回nil
+func (b *circuitBreaker) status() map[string]interface{} {
+	if b == nil {
+		return nil
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	state := b.state
+	if state == CircuitOpen && !time.Now().Before(b.openedAt.Add(b.config.GetOpenTimeout())) {
+		// 下一次调用将作为探测调用放行
+		state = CircuitHalfOpen
+	}
+	total, failures := b.windowCounts(time.Now())
+
+	status := map[string]interface{}{
+		"state":                state,
+		"consecutive_failures": b.consecutive,
+		"window_requests":      total,
+		"window_failures":      failures,
+		"opened_count":         b.opened,
+		"rejected_count":       b.rejected,
+	}
+	if !b.openedAt.IsZero() {
+		status["opened_at"] = b.openedAt.Format(time.RFC3339)
+	}
+	if b.lastError != "" {
+		status["last_error"] = b.lastError
+	}
+	return status
+}
+
+// isOpen 熔断器是否处于熔断或半开状态
+func (b *circuitBreaker) isOpen() bool {
+	if b == nil {
+		return false
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.state != CircuitClosed
+}
+
+// functionBreaker 获取函数独立的熔断器，函数策略未配置熔断器时返回nil
+func (pp *PluginPool) functionBreaker(functionName string, policy config.FunctionPolicy) *circuitBreaker {
+	if policy.CircuitBreaker == nil {
+		return nil
+	}
+
+	pp.breakerMutex.Lock()
+	defer pp.breakerMutex.Unlock()
+
+	breaker, exists := pp.breakers[functionName]
+	if !exists {
+		breaker = newCircuitBreaker(fmt.Sprintf("插件 %s 的函数 %s", pp.PluginName, functionName), policy.CircuitBreaker)
+		pp.breakers[functionName] = breaker
+	}
+	return breaker
+}
+
+// allowCall 依次检查插件级和函数级熔断器，返回的函数用于记录调用结果
+func (pp *PluginPool) allowCall(functionName string, policy config.FunctionPolicy) (func(error), error) {
+	pluginDone, err := pp.breaker.allow()
+	if err != nil {
+		return nil, err
+	}
+	functionDone, err := pp.functionBreaker(functionName, policy).allow()
+	if err != nil {
+		// 本次调用没有真正执行，不计入插件级统计
+		pluginDone(context.Canceled)
+		return nil, err
+	}
+	return func(err error) {
+		functionDone(err)
+		pluginDone(err)
+	}, nil
+}
+
+// breakerStatus 熔断器状态输出，没有启用任何熔断器时返回nil
+func (pp *PluginPool) breakerStatus() map[string]interface{} {
+	pp.breakerMutex.Lock()
+	breakers := make(map[string]*circuitBreaker, len(pp.breakers))
+	for name, breaker := range pp.breakers {
+		breakers[name] = breaker
+	}
+	pp.breakerMutex.Unlock()
+
+	if pp.breaker == nil && len(breakers) == 0 {
+		return nil
+	}
+
+	functions := make(map[string]interface{}, len(breakers))
+	open := make([]string, 0)
+	for name, breaker := range breakers {
+		functions[name] = breaker.status()
+		if breaker.isOpen() {
+			open = append(open, name)
+		}
+	}
+	sort.Strings(open)
+
+	return map[string]interface{}{
+		"plugin":         pp.breaker.status(),
+		"functions":      functions,
+		"open_functions": open,
+	}
+}
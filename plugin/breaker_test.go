@@ -0,0 +1,233 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hoonfeng/goproc/config"
+	"github.com/hoonfeng/goproc/sdk"
+)
+
+var (
+	errPluginFailure  = ErrInstanceCrashed
+	errBusinessResult = &RemoteError{Code: sdk.ErrorCodeInvalidArgument, Message: "参数错误"}
+)
+
+// breakerState 熔断器当前的状态
+func breakerState(b *circuitBreaker) string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.state
+}
+
+// expireOpen 把熔断时间提前OpenTimeout，下一次调用即进入半开状态，不必真的等待
+func expireOpen(b *circuitBreaker) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.openedAt = b.openedAt.Add(-b.config.GetOpenTimeout())
+}
+
+// callBreaker 通过熔断器完成一次调用并记录结果，返回调用是否被放行
+func callBreaker(b *circuitBreaker, result error) bool {
+	done, err := b.allow()
+	if err != nil {
+		return false
+	}
+	done(result)
+	return true
+}
+
+func TestCircuitBreakerConsecutiveFailures(t *testing.T) {
+	breaker := newCircuitBreaker("测试", &config.CircuitBreakerConfig{ConsecutiveFailures: 3})
+
+	// 成功的调用清零连续失败次数；业务错误算作成功，取消不计入
+	for _, result := range []error{errPluginFailure, errPluginFailure, nil, errPluginFailure, errBusinessResult, errPluginFailure, context.Canceled, errPluginFailure} {
+		callBreaker(breaker, result)
+	}
+	if state := breakerState(breaker); state != CircuitClosed {
+		t.Fatalf("失败没有连续达到3次时状态 = %s", state)
+	}
+
+	callBreaker(breaker, errPluginFailure)
+	if state := breakerState(breaker); state != CircuitOpen {
+		t.Fatalf("连续失败3次后状态 = %s, 期望 %s", state, CircuitOpen)
+	}
+	if _, err := breaker.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("熔断期间调用返回 %v, 期望 ErrCircuitOpen", err)
+	}
+}
+
+func TestCircuitBreakerErrorRate(t *testing.T) {
+	breaker := newCircuitBreaker("测试", &config.CircuitBreakerConfig{ConsecutiveFailures: 100, ErrorRate: 0.5, MinRequests: 4})
+
+	// 调用数达到MinRequests之前，错误率再高也不熔断
+	callBreaker(breaker, errPluginFailure)
+	callBreaker(breaker, nil)
+	callBreaker(breaker, errPluginFailure)
+	if state := breakerState(breaker); state != CircuitClosed {
+		t.Fatalf("只有3次调用时状态 = %s", state)
+	}
+
+	callBreaker(breaker, errPluginFailure)
+	if state := breakerState(breaker); state != CircuitOpen {
+		t.Fatalf("4次调用中3次失败后状态 = %s, 期望 %s", state, CircuitOpen)
+	}
+}
+
+func TestCircuitBreakerHalfOpenSingleProbe(t *testing.T) {
+	breaker := newCircuitBreaker("测试", &config.CircuitBreakerConfig{ConsecutiveFailures: 1, OpenTimeout: time.Minute})
+	callBreaker(breaker, errPluginFailure)
+	expireOpen(breaker)
+
+	// 熔断超时后同时到达的调用中只有一个作为探测被放行
+	const callers = 20
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	probes := make(chan func(error), callers)
+	var rejected atomic.Int64
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			done, err := breaker.allow()
+			if err != nil {
+				if !errors.Is(err, ErrCircuitOpen) {
+					t.Errorf("被拒绝的调用返回 %v, 期望 ErrCircuitOpen", err)
+				}
+				rejected.Add(1)
+				return
+			}
+			probes <- done
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(probes)
+
+	if len(probes) != 1 || rejected.Load() != callers-1 {
+		t.Fatalf("放行了 %d 个探测、拒绝了 %d 个调用, 期望只放行1个", len(probes), rejected.Load())
+	}
+	if state := breakerState(breaker); state != CircuitHalfOpen {
+		t.Fatalf("探测进行中状态 = %s, 期望 %s", state, CircuitHalfOpen)
+	}
+	probe := <-probes
+
+	// 探测结束之前其他调用仍被拒绝，探测成功后恢复放行
+	if callBreaker(breaker, nil) {
+		t.Fatal("探测进行中放行了第二个调用")
+	}
+	probe(nil)
+	if state := breakerState(breaker); state != CircuitClosed {
+		t.Fatalf("探测成功后状态 = %s, 期望 %s", state, CircuitClosed)
+	}
+	for i := 0; i < 3; i++ {
+		if !callBreaker(breaker, nil) {
+			t.Fatal("恢复后调用被拒绝")
+		}
+	}
+}
+
+func TestCircuitBreakerProbeResult(t *testing.T) {
+	tests := []struct {
+		name      string
+		result    error
+		wantState string
+		nextProbe bool // 之后的调用是否立即作为新的探测被放行
+	}{
+		{name: "探测失败重新熔断", result: errPluginFailure, wantState: CircuitOpen, nextProbe: false},
+		{name: "探测被取消归还名额", result: context.Canceled, wantState: CircuitHalfOpen, nextProbe: true},
+		{name: "探测返回业务错误视为恢复", result: errBusinessResult, wantState: CircuitClosed, nextProbe: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breaker := newCircuitBreaker("测试", &config.CircuitBreakerConfig{ConsecutiveFailures: 1, OpenTimeout: time.Minute})
+			callBreaker(breaker, errPluginFailure)
+			expireOpen(breaker)
+
+			if !callBreaker(breaker, tt.result) {
+				t.Fatal("熔断超时后探测调用被拒绝")
+			}
+			if state := breakerState(breaker); state != tt.wantState {
+				t.Fatalf("探测结果为 %v 时状态 = %s, 期望 %s", tt.result, state, tt.wantState)
+			}
+			if got := callBreaker(breaker, nil); got != tt.nextProbe {
+				t.Fatalf("之后的调用被放行: %v, 期望 %v", got, tt.nextProbe)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerHalfOpenRequests(t *testing.T) {
+	breaker := newCircuitBreaker("测试", &config.CircuitBreakerConfig{ConsecutiveFailures: 1, OpenTimeout: time.Minute, HalfOpenRequests: 2})
+	callBreaker(breaker, errPluginFailure)
+	expireOpen(breaker)
+
+	// 配置了多个探测时全部成功才恢复
+	first, err := breaker.allow()
+	if err != nil {
+		t.Fatalf("第一个探测被拒绝: %v", err)
+	}
+	second, err := breaker.allow()
+	if err != nil {
+		t.Fatalf("第二个探测被拒绝: %v", err)
+	}
+	if callBreaker(breaker, nil) {
+		t.Fatal("探测名额用完后仍放行了调用")
+	}
+	first(nil)
+	if state := breakerState(breaker); state != CircuitHalfOpen {
+		t.Fatalf("只有一个探测成功时状态 = %s, 期望 %s", state, CircuitHalfOpen)
+	}
+	second(nil)
+	if state := breakerState(breaker); state != CircuitClosed {
+		t.Fatalf("全部探测成功后状态 = %s, 期望 %s", state, CircuitClosed)
+	}
+}
+
+func TestBreakerOutcome(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantFailed  bool
+		wantCounted bool
+	}{
+		{"成功", nil, false, true},
+		{"超时", ErrTimeout, true, true},
+		{"实例崩溃", ErrInstanceCrashed, true, true},
+		{"连接断开", ErrConnectionLost, true, true},
+		{"插件内部错误", &RemoteError{Code: sdk.ErrorCodeInternal}, true, true},
+		{"参数错误", &RemoteError{Code: sdk.ErrorCodeInvalidArgument}, false, true},
+		{"资源不存在", &RemoteError{Code: sdk.ErrorCodeNotFound}, false, true},
+		{"插件端取消", &RemoteError{Code: sdk.ErrorCodeCanceled}, false, false},
+		{"调用方取消", context.Canceled, false, false},
+		{"排队已满", ErrQueueFull, false, false},
+		{"限流", ErrRateLimited, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failed, counted := breakerOutcome(tt.err)
+			if failed != tt.wantFailed || counted != tt.wantCounted {
+				t.Errorf("breakerOutcome(%v) = (%v, %v), 期望 (%v, %v)", tt.err, failed, counted, tt.wantFailed, tt.wantCounted)
+			}
+		})
+	}
+}
+
+func TestNilCircuitBreaker(t *testing.T) {
+	var breaker *circuitBreaker
+	done, err := breaker.allow()
+	if err != nil {
+		t.Fatalf("未启用的熔断器返回错误: %v", err)
+	}
+	done(errPluginFailure)
+	if breaker.isOpen() || breaker.status() != nil {
+		t.Error("未启用的熔断器不应处于熔断状态或输出状态")
+	}
+}
@@ -0,0 +1,73 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hoonfeng/goproc/sdk"
+)
+
+// 调用失败的错误类型，可用errors.Is判断
+var (
+	ErrPluginNotFound   = errors.New("插件不存在")
+	ErrFunctionNotFound = errors.New("函数不存在")
+	ErrTimeout          = errors.New("等待响应超时")
+	ErrInstanceCrashed  = errors.New("插件实例已崩溃")
+	ErrConnectionLost   = errors.New("插件实例连接已断开")
+	ErrPoolExhausted    = errors.New("插件池没有可用实例")
+	ErrPoolDegraded     = errors.New("插件池处于降级状态")
+	ErrQueueFull        = errors.New("等待队列已满")
+	ErrTooManyCalls     = errors.New("并发调用数超过限制")
+	ErrCircuitOpen      = errors.New("熔断器已打开")
+	ErrRateLimited      = errors.New("调用频率超过限制")
+)
+
+// 排队获取槽位时的内部错误
+var (
+	errQueueClosed = errors.New("插件池已停止")     // 插件池停止后仍在排队的调用返回该错误
+	errRouteLost   = errors.New("路由的目标实例已失效") // 等待的指定实例被移除，需要重新路由
+)
+
+// RemoteError 插件返回的错误，可用errors.As获取错误码、附加信息和插件端调用栈
+type RemoteError struct {
+	Instance  string                 // 返回错误的插件实例ID
+	Function  string                 // 调用的函数名
+	Code      string                 // 错误码，取值见sdk.ErrorCode*
+	Message   string                 // 错误描述
+	Details   map[string]interface{} // 附加信息
+	Retryable bool                   // 插件认为该错误可以重试
+	Stack     string                 // 插件端调用栈（可选）
+}
+
+// newRemoteError 根据错误消息创建RemoteError，兼容只有错误字符串的插件
+func newRemoteError(instanceID string, functionName string, msg *sdk.Message) *RemoteError {
+	coded := sdk.ErrorFromMessage(msg)
+	return &RemoteError{
+		Instance:  instanceID,
+		Function:  functionName,
+		Code:      coded.Code,
+		Message:   coded.Message,
+		Details:   coded.Details,
+		Retryable: coded.Retryable,
+		Stack:     coded.Stack,
+	}
+}
+
+// Error 实现error接口
+func (e *RemoteError) Error() string {
+	if e.Code == sdk.ErrorCodeUnknown {
+		return fmt.Sprintf("插件返回错误: %s", e.Message)
+	}
+	return fmt.Sprintf("插件返回错误: [%s] %s", e.Code, e.Message)
+}
+
+// Is 让插件报告的函数不存在和超时可以用errors.Is(err, ErrFunctionNotFound)等方式判断
+func (e *RemoteError) Is(target error) bool {
+	switch target {
+	case ErrFunctionNotFound:
+		return e.Code == sdk.ErrorCodeFunctionNotFound
+	case ErrTimeout:
+		return e.Code == sdk.ErrorCodeTimeout
+	}
+	return false
+}
@@ -0,0 +1,273 @@
+package plugin
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hoonfeng/goproc/config"
+)
+
+const (
+	healthHistoryLimit   = 10              // 每个实例保留的健康检查记录数
+	evictionHistoryLimit = 20              // 插件池保留的实例移除记录数
+	healthCheckTimeout   = 5 * time.Second // 单次ping的最长等待时间
+)
+
+// HealthRecord 健康检查记录
+type HealthRecord struct {
+	Time    time.Time     // 检查时间
+	Healthy bool          // 是否通过检查
+	Latency time.Duration // ping往返耗时
+	Error   string        // 未通过检查的原因
+}
+
+// EvictionRecord 实例移除记录
+type EvictionRecord struct {
+	Time     time.Time // 移除时间
+	Instance string    // 被移除的实例ID
+	Reason   string    // 移除原因
+	Exit     *ExitInfo // 因进程退出而移除时的退出信息
+}
+
+// recordHealth 记录一次健康检查结果并更新健康状态
+func (pi *PluginInstance) recordHealth(record HealthRecord) {
+	pi.Mutex.Lock()
+	defer pi.Mutex.Unlock()
+
+	pi.IsHealthy = record.Healthy
+	pi.healthHistory = append(pi.healthHistory, record)
+	if len(pi.healthHistory) > healthHistoryLimit {
+		pi.healthHistory = pi.healthHistory[len(pi.healthHistory)-healthHistoryLimit:]
+	}
+}
+
+// isIdle 实例当前没有在途调用
+func (pi *PluginInstance) isIdle() bool {
+	return atomic.LoadInt64(&pi.inFlight) == 0
+}
+
+// healthHistoryStatus 把健康检查记录转换为状态输出格式
+func healthHistoryStatus(history []HealthRecord) []map[string]interface{} {
+	status := make([]map[string]interface{}, 0, len(history))
+	for _, record := range history {
+		item := map[string]interface{}{
+			"time":       record.Time.Format(time.RFC3339),
+			"healthy":    record.Healthy,
+			"latency_ms": record.Latency.Milliseconds(),
+		}
+		if record.Error != "" {
+			item["error"] = record.Error
+		}
+		status = append(status, item)
+	}
+	return status
+}
+
+// superviseHealth 健康检查协程：按间隔检查实例，直到stop被关闭
+func (pp *PluginPool) superviseHealth(interval time.Duration, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			pp.checkHealth(interval)
+		}
+	}
+}
+
+// checkHealth 对空闲实例发送ping，移除未通过检查或连接已断开的实例，并补足池大小
+// 有在途调用的实例不发送ping，避免与正常调用争抢
+// 未通过检查的实例与崩溃的实例一样计入崩溃统计，按重启退避启动替换实例，频繁失败时进入降级状态
+func (pp *PluginPool) checkHealth(interval time.Duration) {
+	timeout := healthCheckTimeout
+	if interval < timeout {
+		timeout = interval
+	}
+
+	pp.Mutex.RLock()
+	instances := make([]*PluginInstance, 0, len(pp.Instances))
+	for _, instance := range pp.Instances {
+		instances = append(instances, instance)
+	}
+	pp.Mutex.RUnlock()
+
+	var (
+		wg          sync.WaitGroup
+		failedMutex sync.Mutex
+		failed      []string // 未通过检查的实例的移除原因
+	)
+	for _, instance := range instances {
+		instance.Mutex.RLock()
+		isConnected := instance.IsConnected
+		instance.Mutex.RUnlock()
+
+		if isConnected && !instance.isIdle() {
+			continue
+		}
+
+		wg.Add(1)
+		go func(instance *PluginInstance) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := instance.ping(timeout)
+			record := HealthRecord{
+				Time:    start,
+				Healthy: err == nil,
+				Latency: time.Since(start),
+			}
+			if err != nil {
+				record.Error = err.Error()
+			}
+			instance.recordHealth(record)
+
+			if err != nil {
+				reason := "健康检查失败: " + err.Error()
+				pp.evictInstance(instance, reason, nil)
+
+				failedMutex.Lock()
+				failed = append(failed, reason)
+				failedMutex.Unlock()
+			}
+		}(instance)
+	}
+	wg.Wait()
+
+	pp.recycleExpired()
+
+	if pp.Config.GetRestartPolicy() == config.RestartNever {
+		return
+	}
+
+	pp.Mutex.Lock()
+	if !pp.IsRunning {
+		pp.Mutex.Unlock()
+		return
+	}
+	if len(failed) > 0 {
+		var delay time.Duration
+		for _, reason := range failed {
+			delay = pp.recordCrashLocked(reason)
+		}
+		if pp.state == PoolStateRunning {
+			pp.scheduleRestartLocked(delay)
+		}
+		pp.Mutex.Unlock()
+		return
+	}
+	restartPending := time.Now().Before(pp.nextRestart)
+	pp.Mutex.Unlock()
+
+	// 实例数因其他原因（如替换实例启动失败）低于MinInstances时补足，已安排的重启仍在退避时不提前补充
+	if !restartPending {
+		pp.replenish()
+	}
+}
+
+// evictInstance 从池中移除实例并停止它，可用队列中属于该实例的槽位随之清除
+// exit为实例进程的退出信息，实例仍在运行时为nil
+func (pp *PluginPool) evictInstance(instance *PluginInstance, reason string, exit *ExitInfo) {
+	pp.Mutex.Lock()
+	if _, exists := pp.Instances[instance.ID]; !exists || !pp.IsRunning {
+		pp.Mutex.Unlock()
+		return
+	}
+	delete(pp.Instances, instance.ID)
+	pp.ring.remove(instance.ID)
+
+	pp.evictedCount++
+	pp.evictions = append(pp.evictions, EvictionRecord{
+		Time:     time.Now(),
+		Instance: instance.ID,
+		Reason:   reason,
+		Exit:     exit,
+	})
+	if len(pp.evictions) > evictionHistoryLimit {
+		pp.evictions = pp.evictions[len(pp.evictions)-evictionHistoryLimit:]
+	}
+	pp.Mutex.Unlock()
+
+	instance.Mutex.Lock()
+	instance.IsHealthy = false
+	instance.Mutex.Unlock()
+
+	pp.purgeAvailable()
+
+	// 无响应的进程需要等待优雅退出超时，异步停止以免阻塞健康检查和替换
+	go instance.Stop()
+}
+
+// purgeAvailable 清除空闲槽位中已移除或不健康实例的槽位
+func (pp *PluginPool) purgeAvailable() {
+	pp.slots.purge(pp.isUsable)
+}
+
+// isUsable 实例仍在池中且健康、已连接，并且没有被替换
+func (pp *PluginPool) isUsable(instance *PluginInstance) bool {
+	if atomic.LoadInt32(&instance.recycling) != 0 {
+		return false
+	}
+
+	pp.Mutex.RLock()
+	_, exists := pp.Instances[instance.ID]
+	pp.Mutex.RUnlock()
+
+	if !exists {
+		return false
+	}
+
+	instance.Mutex.RLock()
+	defer instance.Mutex.RUnlock()
+	return instance.IsHealthy && instance.IsConnected
+}
+
+// replenish 创建新实例，直到实例数达到MinInstances（未配置时为PoolSize），降级状态下不补充
+// 健康检查和进程监控可能同时补充实例，串行执行以免超出目标数量
+func (pp *PluginPool) replenish() error {
+	pp.replenishMutex.Lock()
+	defer pp.replenishMutex.Unlock()
+
+	for {
+		pp.Mutex.RLock()
+		active := pp.IsRunning && pp.state == PoolStateRunning
+		count := len(pp.Instances)
+		pp.Mutex.RUnlock()
+
+		if !active || count >= pp.Config.GetMinInstances() {
+			return nil
+		}
+
+		if _, err := pp.createNewInstance(false); err != nil {
+			return err
+		}
+	}
+}
+
+// evictionStatus 把实例移除记录转换为状态输出格式
+func evictionStatus(evictions []EvictionRecord) []map[string]interface{} {
+	status := make([]map[string]interface{}, 0, len(evictions))
+	for _, record := range evictions {
+		item := map[string]interface{}{
+			"time":     record.Time.Format(time.RFC3339),
+			"instance": record.Instance,
+			"reason":   record.Reason,
+		}
+		if record.Exit != nil {
+			item["exit_code"] = record.Exit.ExitCode
+			if record.Exit.Signal != "" {
+				item["signal"] = record.Exit.Signal
+			}
+			if record.Exit.OOMKilled {
+				item["oom_killed"] = true
+			}
+		}
+		status = append(status, item)
+	}
+	return status
+}
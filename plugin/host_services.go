@@ -0,0 +1,153 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/hoonfeng/goproc/sdk"
+)
+
+// HostFunction 主机服务函数类型，供插件通过CallHost回调
+type HostFunction func(ctx context.Context, params map[string]interface{}) (interface{}, error)
+
+// HostServices 主机服务注册表
+// 插件处理调用时可以反向调用这里注册的函数，例如读取配置、访问数据库或记录审计日志
+type HostServices struct {
+	functions map[string]HostFunction
+	Mutex     sync.RWMutex
+}
+
+// NewHostServices 创建主机服务注册表
+func NewHostServices() *HostServices {
+	return &HostServices{
+		functions: make(map[string]HostFunction),
+	}
+}
+
+// Register 注册主机服务函数
+func (hs *HostServices) Register(name string, fn HostFunction) error {
+	hs.Mutex.Lock()
+	defer hs.Mutex.Unlock()
+
+	if _, exists := hs.functions[name]; exists {
+		return fmt.Errorf("主机服务 %s 已注册", name)
+	}
+
+	hs.functions[name] = fn
+	return nil
+}
+
+// Unregister 注销主机服务函数
+func (hs *HostServices) Unregister(name string) {
+	hs.Mutex.Lock()
+	defer hs.Mutex.Unlock()
+
+	delete(hs.functions, name)
+}
+
+// Names 获取已注册的主机服务名称
+func (hs *HostServices) Names() []string {
+	hs.Mutex.RLock()
+	defer hs.Mutex.RUnlock()
+
+	names := make([]string, 0, len(hs.functions))
+	for name := range hs.functions {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Call 调用主机服务函数
+func (hs *HostServices) Call(ctx context.Context, name string, params map[string]interface{}) (interface{}, error) {
+	hs.Mutex.RLock()
+	fn, exists := hs.functions[name]
+	hs.Mutex.RUnlock()
+
+	if !exists {
+		return nil, sdk.Errorf(sdk.ErrorCodeNotFound, "主机服务 %s 不存在", name)
+	}
+
+	return fn(ctx, params)
+}
+
+// handleHostCall 处理插件发起的主机服务调用，并把结果以相同的消息ID回复给插件
+func (pi *PluginInstance) handleHostCall(msg *sdk.Message) {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if msg.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), time.Duration(msg.Timeout)*time.Millisecond)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+
+	pi.hostCallsMutex.Lock()
+	pi.hostCalls[msg.ID] = cancel
+	pi.hostCallsMutex.Unlock()
+
+	defer func() {
+		pi.hostCallsMutex.Lock()
+		delete(pi.hostCalls, msg.ID)
+		pi.hostCallsMutex.Unlock()
+		cancel()
+	}()
+
+	result, err := pi.callHostService(ctx, msg)
+
+	reply := &sdk.Message{
+		ID: msg.ID,
+	}
+	if err != nil {
+		reply.Type = sdk.MessageTypeError
+		reply.ErrorInfo = sdk.ErrorInfoFrom(err)
+		reply.Error = reply.ErrorInfo.Message
+	} else {
+		reply.Type = sdk.MessageTypeResult
+		reply.Result = result
+	}
+	pi.sendMessage(reply)
+}
+
+// callHostService 执行主机服务，服务函数panic时转换为内部错误回复给插件，不影响主机进程
+func (pi *PluginInstance) callHostService(ctx context.Context, msg *sdk.Message) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = nil
+			err = &sdk.Error{
+				Code:    sdk.ErrorCodeInternal,
+				Message: fmt.Sprintf("主机服务 %s 执行异常: %v", msg.Function, r),
+				Stack:   string(debug.Stack()),
+			}
+		}
+	}()
+
+	if pi.HostServices == nil {
+		return nil, sdk.Errorf(sdk.ErrorCodeNotFound, "主机服务 %s 不存在", msg.Function)
+	}
+	return pi.HostServices.Call(ctx, msg.Function, msg.Params)
+}
+
+// cancelHostCall 插件放弃等待时取消对应的主机服务调用
+func (pi *PluginInstance) cancelHostCall(messageID string) {
+	pi.hostCallsMutex.Lock()
+	cancel, exists := pi.hostCalls[messageID]
+	pi.hostCallsMutex.Unlock()
+
+	if exists {
+		cancel()
+	}
+}
+
+// cancelAllHostCalls 连接断开时取消所有进行中的主机服务调用
+func (pi *PluginInstance) cancelAllHostCalls() {
+	pi.hostCallsMutex.Lock()
+	defer pi.hostCallsMutex.Unlock()
+
+	for _, cancel := range pi.hostCalls {
+		cancel()
+	}
+}
@@ -0,0 +1,151 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hoonfeng/goproc/config"
+	"github.com/hoonfeng/goproc/sdk"
+)
+
+// hostCallCount 进行中的主机服务调用数
+func (pi *PluginInstance) hostCallCount() int {
+	pi.hostCallsMutex.Lock()
+	defer pi.hostCallsMutex.Unlock()
+	return len(pi.hostCalls)
+}
+
+func TestHostCallReply(t *testing.T) {
+	services := NewHostServices()
+	services.Register("echo", func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		return params["v"], nil
+	})
+	services.Register("panic", func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		panic("服务异常")
+	})
+
+	tests := []struct {
+		name      string
+		services  *HostServices
+		function  string
+		wantType  sdk.MessageType
+		wantCode  string
+		wantValue interface{}
+	}{
+		{name: "正常返回", services: services, function: "echo", wantType: sdk.MessageTypeResult, wantValue: "x"},
+		{name: "服务不存在", services: services, function: "missing", wantType: sdk.MessageTypeError, wantCode: sdk.ErrorCodeNotFound},
+		{name: "未提供主机服务", function: "echo", wantType: sdk.MessageTypeError, wantCode: sdk.ErrorCodeNotFound},
+		{name: "服务panic", services: services, function: "panic", wantType: sdk.MessageTypeError, wantCode: sdk.ErrorCodeInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance, plugin := newPipeInstance(t, &config.PluginConfig{})
+			instance.HostServices = tt.services
+
+			plugin.send(&sdk.Message{Type: sdk.MessageTypeHostCall, ID: "host-1", Function: tt.function, Params: map[string]interface{}{"v": "x"}})
+			reply := plugin.receive()
+			if reply.ID != "host-1" || reply.Type != tt.wantType {
+				t.Fatalf("回复 = %s %s, 期望 host-1 %s", reply.ID, reply.Type, tt.wantType)
+			}
+			if tt.wantType == sdk.MessageTypeResult {
+				if reply.Result != tt.wantValue {
+					t.Errorf("结果 = %v, 期望 %v", reply.Result, tt.wantValue)
+				}
+				return
+			}
+			if reply.ErrorInfo == nil || reply.ErrorInfo.Code != tt.wantCode {
+				t.Fatalf("错误信息 = %+v, 期望错误码 %s", reply.ErrorInfo, tt.wantCode)
+			}
+			if tt.wantCode == sdk.ErrorCodeInternal && !strings.Contains(reply.ErrorInfo.Stack, "callHostService") {
+				t.Errorf("panic的错误信息未附带调用栈: %q", reply.ErrorInfo.Stack)
+			}
+		})
+	}
+}
+
+func TestHostCallContext(t *testing.T) {
+	services := NewHostServices()
+	started := make(chan struct{}, 1)
+	services.Register("wait", func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		started <- struct{}{}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	tests := []struct {
+		name     string
+		timeout  int64
+		cancel   bool
+		wantCode string
+	}{
+		{name: "超时后取消", timeout: 30, wantCode: sdk.ErrorCodeTimeout},
+		{name: "插件发送取消消息", cancel: true, wantCode: sdk.ErrorCodeCanceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance, plugin := newPipeInstance(t, &config.PluginConfig{})
+			instance.HostServices = services
+
+			plugin.send(&sdk.Message{Type: sdk.MessageTypeHostCall, ID: "host-1", Function: "wait", Timeout: tt.timeout})
+			select {
+			case <-started:
+			case <-time.After(time.Second):
+				t.Fatal("主机服务未被调用")
+			}
+			if tt.cancel {
+				plugin.send(&sdk.Message{Type: sdk.MessageTypeCancel, ID: "host-1"})
+			}
+
+			reply := plugin.receive()
+			if reply.Type != sdk.MessageTypeError || reply.ErrorInfo == nil || reply.ErrorInfo.Code != tt.wantCode {
+				t.Fatalf("回复 = %s %+v, 期望错误码 %s", reply.Type, reply.ErrorInfo, tt.wantCode)
+			}
+
+			// 回复之后调用记录随之删除
+			deadline := time.Now().Add(time.Second)
+			for instance.hostCallCount() != 0 {
+				if time.Now().After(deadline) {
+					t.Fatalf("回复后仍有 %d 个主机服务调用记录", instance.hostCallCount())
+				}
+				time.Sleep(time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestHostCallCanceledOnDisconnect(t *testing.T) {
+	services := NewHostServices()
+	canceled := make(chan error, 1)
+	services.Register("wait", func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		<-ctx.Done()
+		canceled <- ctx.Err()
+		return nil, ctx.Err()
+	})
+
+	instance, plugin := newPipeInstance(t, &config.PluginConfig{})
+	instance.HostServices = services
+
+	plugin.send(&sdk.Message{Type: sdk.MessageTypeHostCall, ID: "host-1", Function: "wait"})
+	deadline := time.Now().Add(time.Second)
+	for instance.hostCallCount() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("主机服务调用未登记")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	plugin.conn.Close()
+
+	select {
+	case err := <-canceled:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("连接断开后ctx错误 = %v, 期望 context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("连接断开后主机服务的ctx未被取消")
+	}
+}
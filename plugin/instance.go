@@ -2,18 +2,26 @@ package plugin
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hoonfeng/goproc/config"
 	"github.com/hoonfeng/goproc/sdk"
 )
 
+// readyFallback 没有收到就绪信号时开始尝试连接前的等待时间，兼容不支持就绪信号的插件
+const readyFallback = 100 * time.Millisecond
+
+// terminateTimeout 优雅关闭失败后，向进程组发送SIGTERM到发送SIGKILL之间的等待时间
+const terminateTimeout = 3 * time.Second
+
 // PluginInstance 插件实例
 type PluginInstance struct {
 	ID            string
@@ -24,11 +32,48 @@ type PluginInstance struct {
 	Address       string
 	IsRunning     bool
 	IsConnected   bool
+	IsHealthy     bool // 最近一次健康检查是否通过，不健康的实例会被健康检查协程移除
 	Functions     []string
 	LastUsed      time.Time
 	Mutex         sync.RWMutex
-	ConnMutex     sync.Mutex // 连接级别的互斥锁，确保同一时间只有一个操作使用连接
+	ConnMutex     sync.Mutex // 连接写锁，确保同一时间只有一个帧写入连接
 	Communication CommunicationChannel
+	HostServices  *HostServices // 插件可回调的主机服务，为nil时拒绝所有回调
+
+	ProtocolVersion int      // 注册时协商的协议版本
+	Capabilities    []string // 注册时协商的协议能力
+
+	protocol     *MessageProtocol
+	codec        sdk.Codec               // 注册时协商的编解码器
+	pending      map[string]*pendingCall // 等待响应的调用表，按消息ID索引
+	pendingMutex sync.Mutex
+	readerClosed bool           // 读取协程已退出，不再接受新的调用
+	readerDone   chan struct{}  // 读取协程退出时关闭
+	callSeq      uint64         // 消息ID序号
+	inFlight     int64          // 在途调用数
+	calls        int64          // 本次启动后分配给该实例的调用数
+	recycling    int32          // 非0表示正在被替换，不再分配新的调用，也不会重复替换
+	startedAt    time.Time      // 本次启动完成的时间
+	usage        *ResourceUsage // 最近一次采样的资源占用
+	limits       *processLimits // 进程的资源限制，未配置时为nil
+	ready        chan struct{}  // 插件通过就绪管道报告监听器已创建时关闭，平台不支持时为nil
+
+	hostCalls      map[string]context.CancelFunc // 进行中的主机服务调用，按消息ID索引
+	hostCallsMutex sync.Mutex
+
+	healthHistory []HealthRecord // 最近的健康检查记录，按时间顺序
+
+	exited   chan struct{}                    // 进程退出时关闭，此后exitInfo可读
+	exitInfo *ExitInfo                        // 进程退出信息
+	stopping int32                            // 非0表示正在Stop，进程退出属于预期
+	onExit   func(*PluginInstance, *ExitInfo) // 进程意外退出时的回调，由插件池设置
+}
+
+// pendingCall 等待响应的调用
+type pendingCall struct {
+	ch     chan *sdk.Message
+	stream bool  // 流式调用会收到多条消息，直到结束消息才从等待表移除
+	err    error // 通道被关闭的原因，为空表示连接断开
 }
 
 // NewPluginInstance 创建新的插件实例
@@ -42,6 +87,9 @@ func NewPluginInstance(pluginName string, config *config.PluginConfig, instanceI
 		Functions:     make([]string, 0),
 		LastUsed:      time.Now(),
 		Communication: NewCommunicationChannel(),
+		pending:       make(map[string]*pendingCall),
+		hostCalls:     make(map[string]context.CancelFunc),
+		codec:         sdk.JSONCodec,
 	}
 }
 
@@ -57,6 +105,10 @@ func (pi *PluginInstance) Start() error {
 	// 生成通信地址
 	pi.Address = pi.Communication.GenerateAddress(pi.PluginName, pi.ID)
 
+	// 注册阶段始终使用JSON
+	pi.codec = sdk.JSONCodec
+	atomic.StoreInt32(&pi.stopping, 0)
+
 	// 启动插件进程
 	if err := pi.startProcess(); err != nil {
 		pi.Mutex.Unlock()
@@ -91,13 +143,44 @@ func (pi *PluginInstance) Start() error {
 	pi.Mutex.Lock()
 	pi.IsRunning = true
 	pi.IsConnected = true
+	pi.IsHealthy = true
+	pi.startedAt = time.Now()
+	pi.usage = nil
+	atomic.StoreInt64(&pi.calls, 0)
 	pi.Mutex.Unlock()
 
+	// 启动读取协程，按消息ID将响应分发给等待中的调用
+	pi.startReader()
+
 	return nil
 }
 
 // startProcess 启动插件进程
 func (pi *PluginInstance) startProcess() error {
+	// 按配置限制进程的资源占用，Linux上进程直接在实例的cgroup中启动
+	limits := prepareLimits(pi.PluginName, pi.ID, pi.Config.Resources)
+
+	err := pi.launch(limits)
+	// 无法直接在cgroup中启动时退化为rlimit，重新构造命令启动一次
+	if err != nil && limits.fallback(err) {
+		err = pi.launch(limits)
+	}
+	if err != nil {
+		limits.release()
+		return err
+	}
+	limits.started()
+	pi.limits = limits
+
+	// 由进程监控协程负责Wait，其他地方通过exited等待进程退出
+	pi.exited = make(chan struct{})
+	go pi.waitProcess(pi.Process, pi.exited, limits)
+
+	return nil
+}
+
+// launch 按配置构造插件进程的命令并启动，exec.Cmd不能重复Start，每次启动都重新构造
+func (pi *PluginInstance) launch(limits *processLimits) error {
 	command, args := pi.Config.GetPluginCommand()
 
 	// 添加通信地址参数
@@ -108,6 +191,10 @@ func (pi *PluginInstance) startProcess() error {
 	// 设置环境变量
 	env := os.Environ()
 	env = append(env, fmt.Sprintf("GOPROC_PLUGIN_ADDRESS=%s", pi.Address))
+	env = append(env, fmt.Sprintf("GOPROC_HOST_PID=%d", os.Getpid()))
+	if pi.Config.MaxFrameSize > 0 {
+		env = append(env, fmt.Sprintf("GOPROC_MAX_FRAME_SIZE=%d", pi.Config.MaxFrameSize))
+	}
 
 	// 添加配置中的环境变量
 	for key, value := range pi.Config.Environment {
@@ -116,63 +203,76 @@ func (pi *PluginInstance) startProcess() error {
 
 	pi.Process.Env = env
 
+	// 插件通过继承的管道报告就绪，主机不必等待固定时间或轮询连接
+	readyReader, readyWriter, err := attachReadyPipe(pi.Process)
+	if err != nil {
+		return fmt.Errorf("创建就绪管道失败: %w", err)
+	}
+
 	// 设置标准输出和错误输出
 	pi.Process.Stdout = os.Stdout
 	pi.Process.Stderr = os.Stderr
 
 	// 设置独立的工作目录，避免权限冲突
-	if pi.Process.Dir == "" {
-		pi.Process.Dir = filepath.Dir(command)
-	}
+	pi.Process.Dir = filepath.Dir(command)
+
+	// 插件进程及其子进程位于独立的进程组，停止时整组终止，主机退出时插件进程随之退出
+	configureProcessGroup(pi.Process)
+	limits.apply(pi.Process)
 
 	// 启动进程
-	if err := pi.Process.Start(); err != nil {
+	err = startCommand(pi.Process)
+	if readyWriter != nil {
+		// 子进程已继承写端，关闭主机的副本，插件进程退出后读端随之读到EOF
+		readyWriter.Close()
+	}
+	if err != nil {
+		if readyReader != nil {
+			readyReader.Close()
+		}
 		return fmt.Errorf("启动进程失败: %w", err)
 	}
-
+	pi.ready = watchReady(readyReader)
 	return nil
 }
 
+// watchReady 在后台读取就绪管道，读到插件写入的字节时关闭返回的通道；reader为nil时返回nil
+// 插件进程退出后管道读到EOF，读取协程随之结束
+func watchReady(reader *os.File) chan struct{} {
+	if reader == nil {
+		return nil
+	}
+
+	ready := make(chan struct{})
+	go func() {
+		defer reader.Close()
+		buf := make([]byte, 1)
+		if n, _ := reader.Read(buf); n > 0 {
+			close(ready)
+		}
+	}()
+	return ready
+}
+
 // waitForProcessReady 等待进程启动就绪
 // Wait for process to be ready
+// 支持就绪信号的插件创建监听器后立即返回；不支持的插件等待readyFallback后由connectToPlugin重试连接
 func (pi *PluginInstance) waitForProcessReady() error {
-	// 设置最大等待时间为500ms，比原来的1秒快很多
-	// Set maximum wait time to 500ms, much faster than original 1 second
-	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
-	defer cancel()
+	if pi.Process.Process == nil {
+		return fmt.Errorf("进程对象为空")
+	}
 
-	// 检查进程状态的间隔时间
-	// Interval for checking process status
-	checkInterval := 10 * time.Millisecond
-	startTime := time.Now()
+	timer := time.NewTimer(readyFallback)
+	defer timer.Stop()
 
-	for {
-		select {
-		case <-ctx.Done():
-			return fmt.Errorf("等待进程启动超时")
-		default:
-			// 检查进程是否还在运行
-			// Check if process is still running
-			if pi.Process.Process != nil {
-				// 检查进程是否已退出
-				// Check if process has exited
-				if processState := pi.Process.ProcessState; processState != nil && processState.Exited() {
-					return fmt.Errorf("进程已退出")
-				}
-				
-				// 给进程一个最小的启动时间（100ms），然后就认为可以尝试连接了
-				// Give process a minimum startup time (100ms), then consider it ready for connection attempts
-				if time.Since(startTime) >= 100*time.Millisecond {
-					return nil
-				}
-				
-				// 短暂等待后继续检查
-				// Wait briefly before checking again
-				time.Sleep(checkInterval)
-			} else {
-				return fmt.Errorf("进程对象为空")
-			}
-		}
+	select {
+	case <-pi.ready:
+		return nil
+	case <-pi.exited:
+		return fmt.Errorf("进程已退出: %s", pi.exitInfo)
+	case <-timer.C:
+		// 插件不支持就绪信号或启动较慢，开始尝试连接
+		return nil
 	}
 }
 
@@ -184,6 +284,8 @@ func (pi *PluginInstance) connectToPlugin() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	ready := pi.ready
+
 	// 尝试连接插件进程
 	// Attempt to connect to plugin process
 	for {
@@ -196,12 +298,21 @@ func (pi *PluginInstance) connectToPlugin() error {
 			conn, err := pi.Communication.Dial(pi.Address)
 			if err == nil {
 				pi.Conn = conn
+				pi.protocol = NewMessageProtocol(conn)
+				pi.protocol.SetMaxFrameSize(pi.Config.MaxFrameSize)
 				return nil
 			}
 
-			// 连接失败，等待后重试（从500ms减少到100ms）
+			// 连接失败，等待后重试（从500ms减少到100ms）；收到就绪信号或进程退出时不再等待
 			// Connection failed, wait before retry (reduced from 500ms to 100ms)
-			time.Sleep(100 * time.Millisecond)
+			select {
+			case <-ready:
+				// 就绪通道关闭后不再参与等待
+				ready = nil
+			case <-pi.exited:
+				return fmt.Errorf("进程已退出: %s", pi.exitInfo)
+			case <-time.After(100 * time.Millisecond):
+			}
 		}
 	}
 }
@@ -209,7 +320,9 @@ func (pi *PluginInstance) connectToPlugin() error {
 // waitForRegistration 等待插件注册
 // Wait for plugin registration
 func (pi *PluginInstance) waitForRegistration() error {
-	protocol := NewMessageProtocol(pi.Conn)
+	protocol := pi.protocol
+	// 注册完成后由读取协程接管连接，需清除读取超时
+	defer pi.Conn.SetReadDeadline(time.Time{})
 
 	// 设置总超时（10秒，比原来的30秒更合理）
 	// Set total timeout (10 seconds, more reasonable than original 30 seconds)
@@ -239,7 +352,7 @@ func (pi *PluginInstance) waitForRegistration() error {
 
 		msg, err := sdk.DecodeMessage(data)
 		if err != nil {
-			continue // 继续等待有效消息
+			return fmt.Errorf("%w: %v", ErrMalformedFrame, err)
 		}
 
 		// 检查是否为注册消息
@@ -251,34 +364,35 @@ func (pi *PluginInstance) waitForRegistration() error {
 			}
 
 			// 处理不同类型的functions字段
-			var functionNames []string
-
-			switch functions := functionsParam.(type) {
-			case []interface{}:
-				// 处理[]interface{}类型
-				functionNames = make([]string, len(functions))
-				for i, fn := range functions {
-					if name, ok := fn.(string); ok {
-						functionNames[i] = name
-					}
-				}
-			case []string:
-				// 处理[]string类型
-				functionNames = functions
-			default:
-				continue
-			}
+			functionNames := parseStringList(functionsParam)
 
 			if len(functionNames) > 0 {
 				pi.RegisterFunctions(functionNames)
 
-				// 发送注册确认消息
+				// 协商协议版本、能力和编解码器，旧版本插件不声明这些字段，按版本1处理并使用JSON
+				offeredVersion, _ := sdk.ToInt64(msg.Params["protocol_version"])
+				version := sdk.NegotiateVersion(int(offeredVersion))
+				capabilities := sdk.NegotiateCapabilities(parseStringList(msg.Params["capabilities"]))
+				codec := sdk.NegotiateCodec(pi.offeredCodecs(msg.Params["codecs"]))
+
+				// 发送注册确认消息（仍使用JSON），之后切换到协商的编解码器
 				ackMsg := &sdk.Message{
 					Type: sdk.MessageTypeRegisterAck,
+					Params: map[string]interface{}{
+						"protocol_version": version,
+						"capabilities":     capabilities,
+						"codec":            codec.Name(),
+					},
 				}
 				if err := pi.sendMessage(ackMsg); err != nil {
 					return err
 				}
+
+				pi.Mutex.Lock()
+				pi.ProtocolVersion = version
+				pi.Capabilities = capabilities
+				pi.codec = codec
+				pi.Mutex.Unlock()
 				return nil
 			}
 		}
@@ -286,8 +400,64 @@ func (pi *PluginInstance) waitForRegistration() error {
 	}
 }
 
+// parseStringList 解析注册消息中的字符串列表字段
+func parseStringList(param interface{}) []string {
+	switch values := param.(type) {
+	case []interface{}:
+		// 处理[]interface{}类型
+		list := make([]string, 0, len(values))
+		for _, value := range values {
+			if name, ok := value.(string); ok {
+				list = append(list, name)
+			}
+		}
+		return list
+	case []string:
+		// 处理[]string类型
+		return values
+	default:
+		return nil
+	}
+}
+
+// HasCapability 检查注册时是否协商了指定的协议能力
+func (pi *PluginInstance) HasCapability(name string) bool {
+	pi.Mutex.RLock()
+	defer pi.Mutex.RUnlock()
+
+	return sdk.HasCapability(pi.Capabilities, name)
+}
+
+// Concurrency 获取实例允许同时在途的调用数
+// 插件未声明支持多路复用时，同一时间只向其发送一个调用
+func (pi *PluginInstance) Concurrency() int {
+	return pi.Config.GetInstanceConcurrency(pi.HasCapability(sdk.CapabilityMultiplex))
+}
+
+// offeredCodecs 解析插件提供的编解码器候选列表，配置中限定了编解码器时只保留该编解码器
+func (pi *PluginInstance) offeredCodecs(param interface{}) []string {
+	offered := parseStringList(param)
+
+	if pi.Config.Codec == "" {
+		return offered
+	}
+	for _, name := range offered {
+		if name == pi.Config.Codec {
+			return []string{name}
+		}
+	}
+	return nil
+}
+
 // CallFunction 调用插件函数
 func (pi *PluginInstance) CallFunction(functionName string, params map[string]interface{}) (interface{}, error) {
+	return pi.CallFunctionContext(context.Background(), functionName, params)
+}
+
+// CallFunctionContext 调用插件函数，ctx取消或超时后向插件发送取消消息
+// 同一实例上可以有多个调用同时在途，响应由读取协程按消息ID分发
+// 超时只取决于ctx的截止时间，默认调用超时由PluginManager按SystemSettings.CallTimeout设置
+func (pi *PluginInstance) CallFunctionContext(ctx context.Context, functionName string, params map[string]interface{}) (interface{}, error) {
 	// 优化锁操作：一次性检查所有前置条件，减少锁的获取和释放次数
 	// Optimize lock operations: check all preconditions at once, reduce lock acquisition/release frequency
 	pi.Mutex.RLock()
@@ -296,134 +466,310 @@ func (pi *PluginInstance) CallFunction(functionName string, params map[string]in
 	pi.Mutex.RUnlock()
 
 	if !isConnected {
-		return nil, fmt.Errorf("插件实例 %s 未连接", pi.ID)
+		return nil, fmt.Errorf("%w: 插件实例 %s 未连接", ErrConnectionLost, pi.ID)
 	}
 
 	if !hasFunc {
-		return nil, fmt.Errorf("插件实例 %s 不支持函数 %s", pi.ID, functionName)
+		return nil, fmt.Errorf("%w: 插件实例 %s 不支持函数 %s", ErrFunctionNotFound, pi.ID, functionName)
 	}
 
-	// 获取连接级别的互斥锁，确保同一时间只有一个操作使用连接
-	pi.ConnMutex.Lock()
-	defer pi.ConnMutex.Unlock()
+	atomic.AddInt64(&pi.inFlight, 1)
+	defer atomic.AddInt64(&pi.inFlight, -1)
 
-	// 生成消息ID
-	messageID := fmt.Sprintf("call-%d", time.Now().UnixNano())
+	// 生成消息ID并登记到等待表
+	messageID := pi.nextMessageID("call")
+	call, err := pi.registerPending(messageID, 1, false)
+	if err != nil {
+		return nil, err
+	}
+	defer pi.removePending(messageID)
 
-	// 构造调用消息
+	// 构造调用消息，剩余超时时间随调用一起发送
 	callMsg := &sdk.Message{
 		Type:     sdk.MessageTypeCall,
 		ID:       messageID,
 		Function: functionName,
 		Params:   params,
 	}
+	if deadline, ok := ctx.Deadline(); ok {
+		callMsg.Timeout = time.Until(deadline).Milliseconds()
+		if callMsg.Timeout <= 0 {
+			return nil, fmt.Errorf("%w: %w", ErrTimeout, context.DeadlineExceeded)
+		}
+	}
 
 	// 发送消息
 	if err := pi.sendMessage(callMsg); err != nil {
 		return nil, fmt.Errorf("发送调用消息失败: %w", err)
 	}
 
-	// 接收响应（设置30秒超时）
-	// Receive response with 30-second timeout
-	pi.Conn.SetReadDeadline(time.Now().Add(30 * time.Second))
-	defer pi.Conn.SetReadDeadline(time.Time{}) // 清除超时设置
+	// 等待响应或ctx结束
+	// Wait for response or context completion
+	select {
+	case msg, ok := <-call.ch:
+		if !ok {
+			if call.err != nil {
+				return nil, call.err
+			}
+			return nil, fmt.Errorf("接收响应失败: %w: 插件实例 %s 连接已断开", ErrInstanceCrashed, pi.ID)
+		}
 
-	protocol := NewMessageProtocol(pi.Conn)
+		pi.Mutex.Lock()
+		pi.LastUsed = time.Now()
+		pi.Mutex.Unlock()
 
-	// 使用高效的阻塞读取，避免轮询式等待
-	// Use efficient blocking read, avoid polling-style waiting
-	for {
-		// 直接阻塞读取消息，依赖连接级别的超时
-		// Directly block read message, rely on connection-level timeout
-		data, err := protocol.ReceiveMessage()
-		if err != nil {
-			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-				//fmt.Printf("[Instance] 等待响应超时，消息ID: %s\n", messageID)
-				return nil, fmt.Errorf("等待响应超时")
-			}
-			//fmt.Printf("[Instance] 接收消息错误: %v\n", err)
-			return nil, fmt.Errorf("接收响应失败: %w", err)
+		switch msg.Type {
+		case sdk.MessageTypeResult:
+			return msg.Result, nil
+		case sdk.MessageTypeError:
+			return nil, newRemoteError(pi.ID, functionName, msg)
+		default:
+			return nil, fmt.Errorf("收到未知的响应类型: %s", msg.Type)
+		}
+	case <-ctx.Done():
+		// 通知插件放弃执行，避免继续消耗资源
+		if pi.HasCapability(sdk.CapabilityCancel) {
+			pi.sendMessage(&sdk.Message{
+				Type: sdk.MessageTypeCancel,
+				ID:   messageID,
+			})
 		}
 
-		msg, err := sdk.DecodeMessage(data)
-		if err != nil {
-			//fmt.Printf("[Instance] 解码消息错误: %v\n", err)
-			continue // 解码错误继续等待
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("%w: %w", ErrTimeout, ctx.Err())
 		}
+		return nil, fmt.Errorf("调用已取消: %w", ctx.Err())
+	}
+}
 
-		//fmt.Printf("[Instance] 收到消息: ID=%s, Type=%s\n", msg.ID, msg.Type)
+// CallStreamContext 以流式方式调用插件函数，返回的Stream按顺序产出插件发送的数据块
+// 插件最多可以发送授予额度内的数据块，调用方每取走一个数据块才归还额度，
+// 因此消费缓慢时插件会被阻塞，主机端不会无限缓冲
+// ctx取消或超时后向插件发送取消消息；流结束或关闭后调用onDone（可为nil）
+func (pi *PluginInstance) CallStreamContext(ctx context.Context, functionName string, params map[string]interface{}, onDone func()) (*Stream, error) {
+	pi.Mutex.RLock()
+	isConnected := pi.IsConnected && pi.Conn != nil
+	hasFunc := pi.hasFunction(functionName)
+	pi.Mutex.RUnlock()
 
-		// 检查消息ID是否匹配
-		if msg.ID == messageID {
-			pi.LastUsed = time.Now()
+	if !isConnected {
+		return nil, fmt.Errorf("%w: 插件实例 %s 未连接", ErrConnectionLost, pi.ID)
+	}
 
-			if msg.Type == sdk.MessageTypeResult {
-				//fmt.Printf("[Instance] 收到结果响应: %v\n", msg.Result)
-				return msg.Result, nil
-			} else if msg.Type == sdk.MessageTypeError {
-				//fmt.Printf("[Instance] 收到错误响应: %s\n", msg.Error)
-				return nil, fmt.Errorf("插件返回错误: %s", msg.Error)
-			} else {
-				//fmt.Printf("[Instance] 收到未知的响应类型: %s\n", msg.Type)
-				return nil, fmt.Errorf("收到未知的响应类型: %s", msg.Type)
-			}
-		}
+	if !hasFunc {
+		return nil, fmt.Errorf("%w: 插件实例 %s 不支持函数 %s", ErrFunctionNotFound, pi.ID, functionName)
+	}
 
-		// 处理心跳消息
-		if msg.Type == sdk.MessageTypePing {
-			// 发送pong响应
-			pongMsg := &sdk.Message{
-				Type: sdk.MessageTypePong,
-			}
-			pongData, _ := sdk.EncodeMessage(pongMsg)
-			protocol.SendMessage(pongData)
-			continue
+	messageID := pi.nextMessageID("stream")
+	// 额度内的数据块加上结束消息，保证读取协程分发时不会阻塞
+	call, err := pi.registerPending(messageID, defaultStreamWindow+1, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// 插件不支持流式结果时按普通调用发送，结果作为唯一的数据块返回
+	callMsg := &sdk.Message{
+		Type:     sdk.MessageTypeCall,
+		ID:       messageID,
+		Function: functionName,
+		Params:   params,
+	}
+	if pi.HasCapability(sdk.CapabilityStreaming) {
+		callMsg.Stream = true
+		callMsg.Credit = defaultStreamWindow
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		callMsg.Timeout = time.Until(deadline).Milliseconds()
+		if callMsg.Timeout <= 0 {
+			pi.removePending(messageID)
+			return nil, fmt.Errorf("%w: %w", ErrTimeout, context.DeadlineExceeded)
 		}
 	}
+
+	atomic.AddInt64(&pi.inFlight, 1)
+
+	if err := pi.sendMessage(callMsg); err != nil {
+		pi.removePending(messageID)
+		atomic.AddInt64(&pi.inFlight, -1)
+		return nil, fmt.Errorf("发送调用消息失败: %w", err)
+	}
+
+	return newStream(ctx, pi, messageID, functionName, call, func() {
+		pi.removePending(messageID)
+		atomic.AddInt64(&pi.inFlight, -1)
+
+		pi.Mutex.Lock()
+		pi.LastUsed = time.Now()
+		pi.Mutex.Unlock()
+
+		if onDone != nil {
+			onDone()
+		}
+	}), nil
 }
 
 // sendMessage 发送消息
+// 编码失败和超长的消息原样返回错误，连接仍可继续使用；写入连接失败时返回ErrConnectionLost，
+// 并关闭连接让读取协程使在途调用失败，健康检查随后会驱逐该实例
 func (pi *PluginInstance) sendMessage(msg *sdk.Message) error {
-	data, err := sdk.EncodeMessage(msg)
+	data, err := pi.codec.Encode(msg)
 	if err != nil {
 		return err
 	}
 
-	// 使用消息协议发送
-	protocol := NewMessageProtocol(pi.Conn)
-	return protocol.SendMessage(data)
+	// 多个调用共享同一连接，写入时加锁保证帧完整
+	pi.ConnMutex.Lock()
+	defer pi.ConnMutex.Unlock()
+
+	err = pi.protocol.SendMessage(data)
+	if err == nil || errors.Is(err, ErrFrameTooLarge) || errors.Is(err, ErrMalformedFrame) {
+		return err
+	}
+
+	// 写入失败后帧可能只写了一部分，连接已无法继续同步
+	// 调用方可能持有pi.Mutex（如Stop），这里只关闭连接，由读取协程标记为断开并唤醒在途调用
+	pi.Conn.Close()
+	return fmt.Errorf("%w: 插件实例 %s: %w", ErrConnectionLost, pi.ID, err)
+}
+
+// nextMessageID 生成实例内唯一的消息ID
+func (pi *PluginInstance) nextMessageID(prefix string) string {
+	return fmt.Sprintf("%s-%d", prefix, atomic.AddUint64(&pi.callSeq, 1))
+}
+
+// addPending 登记等待响应的消息ID
+func (pi *PluginInstance) addPending(messageID string) (chan *sdk.Message, error) {
+	call, err := pi.registerPending(messageID, 1, false)
+	if err != nil {
+		return nil, err
+	}
+	return call.ch, nil
+}
+
+// registerPending 登记等待表项，capacity为通道容量
+func (pi *PluginInstance) registerPending(messageID string, capacity int, stream bool) (*pendingCall, error) {
+	pi.pendingMutex.Lock()
+	defer pi.pendingMutex.Unlock()
+
+	if pi.readerClosed {
+		return nil, fmt.Errorf("%w: 插件实例 %s", ErrConnectionLost, pi.ID)
+	}
+
+	call := &pendingCall{
+		ch:     make(chan *sdk.Message, capacity),
+		stream: stream,
+	}
+	pi.pending[messageID] = call
+	return call, nil
 }
 
-// waitForResponse 等待响应（保留旧方法，但不再使用）
-func (pi *PluginInstance) waitForResponse(messageID string) (interface{}, error) {
-	protocol := NewMessageProtocol(pi.Conn)
+// removePending 移除等待表中的消息ID
+func (pi *PluginInstance) removePending(messageID string) {
+	pi.pendingMutex.Lock()
+	delete(pi.pending, messageID)
+	pi.pendingMutex.Unlock()
+}
 
-	// 设置读取超时
-	pi.Conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+// startReader 启动读取协程
+func (pi *PluginInstance) startReader() {
+	pi.pendingMutex.Lock()
+	pi.readerClosed = false
+	pi.readerDone = make(chan struct{})
+	pi.pendingMutex.Unlock()
+
+	go pi.readLoop(pi.protocol, pi.readerDone)
+}
+
+// readLoop 读取协程：持续读取连接上的消息，并按消息ID分发给等待中的调用
+func (pi *PluginInstance) readLoop(protocol *MessageProtocol, done chan struct{}) {
+	defer close(done)
 
 	for {
 		data, err := protocol.ReceiveMessage()
-		if err != nil {
-			return nil, err
+		var msg *sdk.Message
+		if err == nil {
+			msg, err = pi.codec.Decode(data)
+			if err != nil {
+				err = fmt.Errorf("%w: %v", ErrMalformedFrame, err)
+			}
 		}
 
-		msg, err := sdk.DecodeMessage(data)
 		if err != nil {
-			return nil, err
-		}
+			// 超长或格式错误的帧说明插件异常，无法再与其同步，关闭该实例
+			violation := errors.Is(err, ErrFrameTooLarge) || errors.Is(err, ErrMalformedFrame)
 
-		// 检查消息ID是否匹配
-		if msg.ID == messageID {
-			switch msg.Type {
-			case sdk.MessageTypeResult:
-				return msg.Result, nil
-			case sdk.MessageTypeError:
-				return nil, fmt.Errorf("插件返回错误: %s", msg.Error)
-			default:
-				return nil, fmt.Errorf("收到未知的响应类型: %s", msg.Type)
+			// 先标记为断开再唤醒在途调用，重试的调用不会再分配到该实例
+			pi.Mutex.Lock()
+			pi.IsConnected = false
+			pi.Mutex.Unlock()
+
+			if violation {
+				pi.closePending(fmt.Errorf("插件实例 %s 协议错误: %w", pi.ID, err))
+			} else {
+				pi.closePending(nil)
 			}
+			pi.cancelAllHostCalls()
+
+			// 终止进程，由进程监控协程按意外退出处理
+			if violation {
+				pi.Conn.Close()
+				pi.Process.Process.Kill()
+			}
+			return
 		}
-		// 不匹配的消息，继续等待目标消息
+
+		// 插件主动发起的请求，其余消息都是对主机请求的响应
+		switch msg.Type {
+		case sdk.MessageTypePing:
+			pi.sendMessage(&sdk.Message{
+				Type: sdk.MessageTypePong,
+				ID:   msg.ID,
+			})
+		case sdk.MessageTypeHostCall:
+			go pi.handleHostCall(msg)
+		case sdk.MessageTypeCancel:
+			pi.cancelHostCall(msg.ID)
+		default:
+			pi.dispatch(msg)
+		}
+	}
+}
+
+// dispatch 将响应交给对应的等待者，没有等待者的响应（如已超时的调用）直接丢弃
+// 进程监控协程可能同时调用closePending关闭等待通道，因此查找和发送都在持有pendingMutex时完成；
+// 通道带缓冲，发送不会阻塞
+func (pi *PluginInstance) dispatch(msg *sdk.Message) {
+	pi.pendingMutex.Lock()
+	defer pi.pendingMutex.Unlock()
+
+	call, exists := pi.pending[msg.ID]
+	if !exists {
+		return
+	}
+	if !call.stream || msg.Type != sdk.MessageTypeStreamChunk {
+		delete(pi.pending, msg.ID)
+	}
+
+	select {
+	case call.ch <- msg:
+	default:
+		// 插件发送的数据块超出了授予的额度，终止该流
+		delete(pi.pending, msg.ID)
+		call.err = fmt.Errorf("插件实例 %s 违反流量控制，发送的数据块超出额度", pi.ID)
+		close(call.ch)
+	}
+}
+
+// closePending 连接断开时让所有在途调用立即失败，reason为空表示连接断开
+func (pi *PluginInstance) closePending(reason error) {
+	pi.pendingMutex.Lock()
+	defer pi.pendingMutex.Unlock()
+
+	pi.readerClosed = true
+	for messageID, call := range pi.pending {
+		call.err = reason
+		close(call.ch)
+		delete(pi.pending, messageID)
 	}
 }
 
@@ -447,39 +793,77 @@ func (pi *PluginInstance) RegisterFunctions(functions []string) {
 
 // HealthCheck 健康检查
 func (pi *PluginInstance) HealthCheck() bool {
+	return pi.ping(5*time.Second) == nil
+}
+
+// ping 发送ping并等待pong
+// ping与在途调用共享连接，pong由读取协程按消息ID分发
+func (pi *PluginInstance) ping(timeout time.Duration) error {
 	pi.Mutex.RLock()
-	defer pi.Mutex.RUnlock()
+	isConnected := pi.IsConnected && pi.Conn != nil
+	pi.Mutex.RUnlock()
 
-	if !pi.IsConnected || pi.Conn == nil {
-		return false
+	if !isConnected {
+		return fmt.Errorf("%w: 插件实例 %s 连接已断开", ErrInstanceCrashed, pi.ID)
 	}
 
 	// 发送ping消息检查连接
+	pingID := pi.nextMessageID("healthcheck")
+	respChan, err := pi.addPending(pingID)
+	if err != nil {
+		return err
+	}
+	defer pi.removePending(pingID)
+
 	pingMsg := &sdk.Message{
 		Type: sdk.MessageTypePing,
-		ID:   fmt.Sprintf("healthcheck-%d", time.Now().UnixNano()),
+		ID:   pingID,
 	}
 
 	if err := pi.sendMessage(pingMsg); err != nil {
-		return false
+		return fmt.Errorf("发送ping失败: %w", err)
 	}
 
 	// 等待pong响应
-	_, err := pi.waitForResponse(pingMsg.ID)
-	return err == nil
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case msg, ok := <-respChan:
+		if !ok {
+			return fmt.Errorf("%w: 插件实例 %s 连接已断开", ErrInstanceCrashed, pi.ID)
+		}
+		if msg.Type != sdk.MessageTypePong {
+			return fmt.Errorf("收到无效的pong响应: %s", msg.Type)
+		}
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("%w: 等待pong超时", ErrTimeout)
+	}
 }
 
 // Stop 停止插件实例
 func (pi *PluginInstance) Stop() error {
-	pi.Mutex.Lock()
-	defer pi.Mutex.Unlock()
+	atomic.StoreInt32(&pi.stopping, 1)
 
+	// 在锁内标记为已停止并取出需要的字段，发送停止消息和等待进程退出都在锁外进行，
+	// 停止期间GetStatus、健康检查等不会被阻塞；并发的Stop看到IsRunning为false后直接返回
+	pi.Mutex.Lock()
 	if !pi.IsRunning {
+		pi.Mutex.Unlock()
 		return nil
 	}
+	connected := pi.IsConnected && pi.Conn != nil
+	conn := pi.Conn
+	process := pi.Process
+	exited := pi.exited
+	address := pi.Address
+	pi.IsRunning = false
+	pi.IsConnected = false
+	pi.Mutex.Unlock()
 
 	// 1. 先发送停止信号给插件进程（优雅关闭）
-	if pi.IsConnected && pi.Conn != nil {
+	if connected {
 		// 尝试发送停止消息
 		stopMsg := &sdk.Message{
 			Type: sdk.MessageTypeStop,
@@ -488,24 +872,14 @@ func (pi *PluginInstance) Stop() error {
 
 		pi.sendMessage(stopMsg) // 移除未使用的err变量
 
-		// 等待插件进程优雅退出（最多等待2秒）
-		done := make(chan bool, 1)
-		go func() {
-			if pi.Process != nil && pi.Process.Process != nil {
-				pi.Process.Wait() // 移除未使用的err变量
-				done <- true
-			} else {
-				done <- false
-			}
-		}()
-
+		// 等待插件进程优雅退出（最多等待2秒），进程由监控协程回收
 		select {
-		case <-done:
-			pi.IsRunning = false
-			pi.IsConnected = false
+		case <-exited:
+			// 关闭连接，读取协程随之退出
+			conn.Close()
 
 			// 清理通信资源
-			pi.Communication.Cleanup(pi.Address)
+			pi.Communication.Cleanup(address)
 
 			return nil
 		case <-time.After(2 * time.Second):
@@ -513,35 +887,34 @@ func (pi *PluginInstance) Stop() error {
 		}
 	}
 
-	// 2. 如果优雅关闭失败，强制终止进程
-	if pi.Process != nil && pi.Process.Process != nil {
+	// 2. 如果优雅关闭失败，先向整个进程组发送SIGTERM，超时后发送SIGKILL
+	if process != nil && process.Process != nil {
 		// 先关闭连接
-		if pi.Conn != nil {
-			pi.Conn.Close()
+		if conn != nil {
+			conn.Close()
 		}
 
-		// 终止进程
-		pi.Process.Process.Kill()
+		if terminateProcessGroup(process.Process) == nil {
+			select {
+			case <-exited:
+			case <-time.After(terminateTimeout):
+			}
+		}
 
-		// 等待进程结束
-		done := make(chan error, 1)
-		go func() {
-			done <- pi.Process.Wait()
-		}()
+		// 组长已退出时仍需清理遗留的子进程
+		killProcessGroup(process.Process)
 
+		// 等待进程结束
 		select {
 		case <-time.After(5 * time.Second):
 			// 强制终止
-		case <-done:
+		case <-exited:
 			// 进程结束
 		}
 	}
 
 	// 3. 清理通信资源
-	pi.Communication.Cleanup(pi.Address)
-
-	pi.IsRunning = false
-	pi.IsConnected = false
+	pi.Communication.Cleanup(address)
 
 	return nil
 }
@@ -556,8 +929,21 @@ func (pi *PluginInstance) GetStatus() map[string]interface{} {
 		"plugin_name":  pi.PluginName,
 		"is_running":   pi.IsRunning,
 		"is_connected": pi.IsConnected,
+		"is_healthy":   pi.IsHealthy,
 		"functions":    pi.Functions,
 		"last_used":    pi.LastUsed.Format(time.RFC3339),
 		"address":      pi.Address,
+		"in_flight":    atomic.LoadInt64(&pi.inFlight),
+		"calls":        atomic.LoadInt64(&pi.calls),
+		"started_at":   pi.startedAt.Format(time.RFC3339),
+		"resources":    usageStatus(pi.usage),
+		"limits":       pi.limits.status(),
+
+		"protocol_version": pi.ProtocolVersion,
+		"capabilities":     pi.Capabilities,
+		"codec":            pi.codec.Name(),
+
+		"health_history": healthHistoryStatus(pi.healthHistory),
+		"exit":           exitStatus(pi.exitedInfo()),
 	}
 }
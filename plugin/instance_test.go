@@ -0,0 +1,332 @@
+package plugin
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hoonfeng/goproc/config"
+	"github.com/hoonfeng/goproc/sdk"
+)
+
+// fakePlugin 通过net.Pipe与实例相连的模拟插件，测试直接读写插件端的帧
+type fakePlugin struct {
+	t    *testing.T
+	conn net.Conn
+}
+
+// newPipeInstance 创建已完成注册、连接到模拟插件的实例
+func newPipeInstance(t *testing.T, cfg *config.PluginConfig, capabilities ...string) (*PluginInstance, *fakePlugin) {
+	t.Helper()
+	return newPipeInstanceID(t, "test-1", cfg, capabilities...)
+}
+
+// newPipeInstanceID 以指定的实例ID创建连接到模拟插件的实例
+func newPipeInstanceID(t *testing.T, id string, cfg *config.PluginConfig, capabilities ...string) (*PluginInstance, *fakePlugin) {
+	t.Helper()
+
+	hostConn, pluginConn := net.Pipe()
+	instance := NewPluginInstance("test", cfg, id)
+	instance.Conn = hostConn
+	instance.protocol = NewMessageProtocol(hostConn)
+	instance.IsRunning = true
+	instance.IsConnected = true
+	instance.IsHealthy = true
+	instance.Functions = []string{"echo"}
+	instance.Capabilities = capabilities
+	instance.startReader()
+
+	t.Cleanup(func() {
+		pluginConn.Close()
+		hostConn.Close()
+		<-instance.readerDone
+	})
+	return instance, &fakePlugin{t: t, conn: pluginConn}
+}
+
+// receive 读取实例发给插件的下一条消息
+func (p *fakePlugin) receive() *sdk.Message {
+	p.t.Helper()
+
+	p.conn.SetReadDeadline(time.Now().Add(time.Second))
+	data, err := sdk.ReadFrame(p.conn, sdk.DefaultMaxFrameSize)
+	if err != nil {
+		p.t.Fatalf("插件读取消息失败: %v", err)
+	}
+	msg, err := sdk.JSONCodec.Decode(data)
+	if err != nil {
+		p.t.Fatalf("插件解码消息失败: %v", err)
+	}
+	return msg
+}
+
+// send 插件向实例发送一条消息
+func (p *fakePlugin) send(msg *sdk.Message) {
+	p.t.Helper()
+
+	data, err := sdk.JSONCodec.Encode(msg)
+	if err != nil {
+		p.t.Fatalf("插件编码消息失败: %v", err)
+	}
+	p.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	if err := sdk.WriteFrame(p.conn, data, sdk.DefaultMaxFrameSize); err != nil {
+		p.t.Fatalf("插件发送消息失败: %v", err)
+	}
+}
+
+// pendingCount 等待表中的调用数
+func (pi *PluginInstance) pendingCount() int {
+	pi.pendingMutex.Lock()
+	defer pi.pendingMutex.Unlock()
+	return len(pi.pending)
+}
+
+func TestPendingDemuxOutOfOrder(t *testing.T) {
+	instance, plugin := newPipeInstance(t, &config.PluginConfig{}, sdk.CapabilityMultiplex)
+
+	const calls = 5
+	type callResult struct {
+		n      int
+		result interface{}
+		err    error
+	}
+	results := make(chan callResult, calls)
+	for n := 0; n < calls; n++ {
+		go func(n int) {
+			result, err := instance.CallFunction("echo", map[string]interface{}{"n": n})
+			results <- callResult{n: n, result: result, err: err}
+		}(n)
+	}
+
+	// 收齐全部调用后按相反顺序响应，每个结果只能交给发出对应调用的调用方
+	received := make([]*sdk.Message, 0, calls)
+	for i := 0; i < calls; i++ {
+		received = append(received, plugin.receive())
+	}
+	for i := len(received) - 1; i >= 0; i-- {
+		msg := received[i]
+		plugin.send(&sdk.Message{Type: sdk.MessageTypeResult, ID: msg.ID, Result: msg.Params["n"]})
+	}
+
+	for i := 0; i < calls; i++ {
+		select {
+		case r := <-results:
+			if r.err != nil {
+				t.Fatalf("调用 %d 返回错误: %v", r.n, r.err)
+			}
+			if r.result != float64(r.n) {
+				t.Errorf("调用 %d 收到结果 %v", r.n, r.result)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("等待调用结果超时")
+		}
+	}
+	if count := instance.pendingCount(); count != 0 {
+		t.Errorf("全部调用完成后等待表中仍有 %d 项", count)
+	}
+}
+
+func TestPendingLateResponse(t *testing.T) {
+	instance, plugin := newPipeInstance(t, &config.PluginConfig{}, sdk.CapabilityMultiplex, sdk.CapabilityCancel)
+
+	// 超时的调用从等待表移除，并通知插件取消
+	done := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := instance.CallFunctionContext(ctx, "echo", nil)
+		done <- err
+	}()
+	late := plugin.receive()
+	if cancel := plugin.receive(); cancel.Type != sdk.MessageTypeCancel || cancel.ID != late.ID {
+		t.Fatalf("超时后收到 %s %s, 期望取消 %s", cancel.Type, cancel.ID, late.ID)
+	}
+	if err := <-done; !errors.Is(err, ErrTimeout) {
+		t.Fatalf("超时的调用返回 %v, 期望 ErrTimeout", err)
+	}
+	if count := instance.pendingCount(); count != 0 {
+		t.Fatalf("超时后等待表中仍有 %d 项", count)
+	}
+
+	// 迟到的响应被丢弃，不会交给之后的调用
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		next := plugin.receive()
+		plugin.send(&sdk.Message{Type: sdk.MessageTypeResult, ID: late.ID, Result: "late"})
+		plugin.send(&sdk.Message{Type: sdk.MessageTypeResult, ID: next.ID, Result: "next"})
+	}()
+	result, err := instance.CallFunction("echo", nil)
+	wg.Wait()
+	if err != nil || result != "next" {
+		t.Fatalf("之后的调用返回 (%v, %v), 期望 next", result, err)
+	}
+}
+
+func TestPendingClosedOnDisconnect(t *testing.T) {
+	instance, plugin := newPipeInstance(t, &config.PluginConfig{}, sdk.CapabilityMultiplex)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := instance.CallFunction("echo", nil)
+		done <- err
+	}()
+	plugin.receive()
+	plugin.conn.Close()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrInstanceCrashed) {
+			t.Fatalf("连接断开后返回 %v, 期望 ErrInstanceCrashed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("连接断开后调用未返回")
+	}
+	if _, err := instance.CallFunction("echo", nil); !errors.Is(err, ErrConnectionLost) {
+		t.Fatalf("断开后的调用返回 %v, 期望 ErrConnectionLost", err)
+	}
+}
+
+func TestInstanceConcurrency(t *testing.T) {
+	tests := []struct {
+		name         string
+		configured   int
+		capabilities []string
+		want         int
+	}{
+		{"不支持多路复用", 0, nil, 1},
+		{"不支持多路复用时忽略配置", 8, nil, 1},
+		{"支持多路复用时默认大于1", 0, []string{sdk.CapabilityMultiplex}, 16},
+		{"支持多路复用时使用配置", 4, []string{sdk.CapabilityMultiplex}, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := NewPluginInstance("test", &config.PluginConfig{InstanceConcurrency: tt.configured}, "test-1")
+			instance.Capabilities = tt.capabilities
+			if got := instance.Concurrency(); got != tt.want {
+				t.Errorf("Concurrency() = %d, 期望 %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStopDoesNotHoldLock(t *testing.T) {
+	instance, plugin := newPipeInstance(t, &config.PluginConfig{})
+	exited := make(chan struct{})
+	instance.exited = exited
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- instance.Stop()
+	}()
+	if msg := plugin.receive(); msg.Type != sdk.MessageTypeStop {
+		t.Fatalf("收到 %s, 期望停止消息", msg.Type)
+	}
+
+	// 等待插件退出期间可以读取状态，并发的Stop直接返回
+	status := make(chan map[string]interface{}, 1)
+	go func() {
+		status <- instance.GetStatus()
+	}()
+	select {
+	case s := <-status:
+		if s["is_running"] != false {
+			t.Errorf("停止中的实例 is_running = %v", s["is_running"])
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("Stop等待插件退出时GetStatus被阻塞")
+	}
+	if err := instance.Stop(); err != nil {
+		t.Fatalf("并发的Stop返回 %v", err)
+	}
+
+	close(exited)
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Fatalf("Stop返回 %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("插件退出后Stop未返回")
+	}
+}
+
+// TestHelperProcess 不是真正的测试，作为模拟插件进程被其他测试启动，启动后一直等待直到被终止
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("GOPROC_TEST_HELPER_PROCESS") != "1" {
+		return
+	}
+	time.Sleep(time.Minute)
+	os.Exit(0)
+}
+
+// startHelperProcess 启动模拟插件进程，测试结束时确保其退出
+func startHelperProcess(t *testing.T) (*exec.Cmd, chan error) {
+	t.Helper()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperProcess$")
+	cmd.Env = append(os.Environ(), "GOPROC_TEST_HELPER_PROCESS=1")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("启动模拟插件进程失败: %v", err)
+	}
+
+	waited := make(chan error, 1)
+	go func() {
+		waited <- cmd.Wait()
+	}()
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+	})
+	return cmd, waited
+}
+
+func TestOversizedFrameKillsPlugin(t *testing.T) {
+	instance, plugin := newPipeInstance(t, &config.PluginConfig{}, sdk.CapabilityMultiplex)
+	cmd, waited := startHelperProcess(t)
+	instance.Process = cmd
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := instance.CallFunction("echo", nil)
+		done <- err
+	}()
+	plugin.receive()
+
+	// 只发送声明长度超出上限的帧头，主机在读取帧体之前就应关闭实例
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, sdk.DefaultMaxFrameSize+1)
+	plugin.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	if _, err := plugin.conn.Write(header); err != nil {
+		t.Fatalf("发送帧头失败: %v", err)
+	}
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrFrameTooLarge) {
+			t.Fatalf("在途调用返回 %v, 期望 ErrFrameTooLarge", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("收到超长帧后在途调用未返回")
+	}
+
+	select {
+	case err := <-waited:
+		if err == nil || cmd.ProcessState.Success() {
+			t.Fatalf("插件进程正常退出 (%v), 期望被终止", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("收到超长帧后插件进程未被终止")
+	}
+
+	if _, err := instance.CallFunction("echo", nil); !errors.Is(err, ErrConnectionLost) {
+		t.Fatalf("关闭后的调用返回 %v, 期望 ErrConnectionLost", err)
+	}
+}
@@ -0,0 +1,49 @@
+package plugin
+
+import (
+	"os"
+
+	"github.com/hoonfeng/goproc/config"
+)
+
+// 实例进程资源限制的生效方式
+const (
+	limitModeCgroup = "cgroup" // 进程位于实例独立的cgroup v2中
+	limitModeRlimit = "rlimit" // 未配置CgroupParent或cgroup不可用，只通过setrlimit限制内存
+	limitModeNone   = "none"   // 当前平台不支持资源限制
+)
+
+// processLimits 实例进程的资源限制
+type processLimits struct {
+	config *config.ResourceLimits
+	mode   string   // 生效方式，取值见limitMode*
+	dir    string   // 实例的cgroup目录，mode为cgroup时有效
+	fd     *os.File // 启动进程时使用的cgroup目录句柄，进程启动后关闭
+	reason string   // 没有使用cgroup的原因
+	// unenforced 已配置但当前方式无法生效的限制
+	unenforced []string
+}
+
+// status 资源限制的状态输出，未配置资源限制时返回nil
+func (l *processLimits) status() map[string]interface{} {
+	if l == nil {
+		return nil
+	}
+
+	status := map[string]interface{}{
+		"mode":       l.mode,
+		"memory_max": l.config.MemoryMax,
+		"cpu_quota":  l.config.CPUQuota,
+		"pids_max":   l.config.PidsMax,
+	}
+	if l.dir != "" {
+		status["cgroup"] = l.dir
+	}
+	if l.reason != "" {
+		status["reason"] = l.reason
+	}
+	if len(l.unenforced) > 0 {
+		status["unenforced"] = l.unenforced
+	}
+	return status
+}
@@ -0,0 +1,296 @@
+//go:build linux
+// +build linux
+
+package plugin
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hoonfeng/goproc/config"
+)
+
+const (
+	cgroupMount     = "/sys/fs/cgroup" // cgroup v2挂载点
+	cgroupCPUPeriod = 100000           // cpu.max的调度周期（微秒）
+	rlimitShell     = "/bin/sh"        // 退化模式下在exec插件之前设置rlimit的shell
+)
+
+// cgroupMutex 串行化父cgroup的准备工作，并行启动的实例不会同时启用控制器
+var cgroupMutex sync.Mutex
+
+// prepareLimits 为即将启动的进程准备资源限制，未配置时返回nil
+// 配置了CgroupParent且cgroup v2可用时创建实例的cgroup，进程通过CgroupFD直接在其中启动；否则退化为rlimit
+func prepareLimits(pluginName, instanceID string, cfg *config.ResourceLimits) *processLimits {
+	if cfg == nil {
+		return nil
+	}
+
+	limits := &processLimits{config: cfg}
+	dir, err := createInstanceCgroup(pluginName, instanceID, cfg)
+	if err != nil {
+		limits.useRlimit(err.Error())
+		return limits
+	}
+	fd, err := os.Open(dir)
+	if err != nil {
+		os.Remove(dir)
+		limits.useRlimit(fmt.Sprintf("打开cgroup目录失败: %v", err))
+		return limits
+	}
+
+	limits.mode = limitModeCgroup
+	limits.dir = dir
+	limits.fd = fd
+	return limits
+}
+
+// useRlimit 退化为rlimit：只能限制内存，CPU配额和进程数不生效并在状态中列出
+func (l *processLimits) useRlimit(reason string) {
+	l.mode = limitModeRlimit
+	l.reason = reason
+	l.unenforced = nil
+	if l.config.MemoryMax > 0 {
+		if _, err := os.Stat(rlimitShell); err != nil {
+			l.unenforced = append(l.unenforced, "memory_max")
+			l.reason += fmt.Sprintf("；%s 不可用，无法设置内存上限", rlimitShell)
+		}
+	}
+	if l.config.CPUQuota > 0 {
+		l.unenforced = append(l.unenforced, "cpu_quota")
+	}
+	if l.config.PidsMax > 0 {
+		l.unenforced = append(l.unenforced, "pids_max")
+	}
+}
+
+// apply 把资源限制应用到即将启动的命令
+// cgroup模式下进程直接在实例的cgroup中启动；rlimit模式下通过shell先设置RLIMIT_DATA再exec插件，
+// 限制在插件开始执行之前生效，进程号不变
+func (l *processLimits) apply(cmd *exec.Cmd) {
+	if l == nil {
+		return
+	}
+
+	switch l.mode {
+	case limitModeCgroup:
+		if cmd.SysProcAttr == nil {
+			cmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		cmd.SysProcAttr.UseCgroupFD = true
+		cmd.SysProcAttr.CgroupFD = int(l.fd.Fd())
+	case limitModeRlimit:
+		// 命令本身无效时保留原来的错误，由Start返回
+		if l.config.MemoryMax <= 0 || cmd.Err != nil || slices.Contains(l.unenforced, "memory_max") {
+			return
+		}
+		// RLIMIT_DATA自Linux 4.7起包含匿名映射，比RLIMIT_AS更接近实际内存占用，
+		// 不会因为运行时预留的大块虚拟地址空间而失败；ulimit -d的单位为KB
+		script := fmt.Sprintf(`ulimit -d %d && exec "$0" "$@"`, (l.config.MemoryMax+1023)/1024)
+		cmd.Args = append([]string{rlimitShell, "-c", script, cmd.Path}, cmd.Args[1:]...)
+		cmd.Path = rlimitShell
+	}
+}
+
+// fallback 进程无法直接在cgroup中启动时（内核不支持clone3或CLONE_INTO_CGROUP、被seccomp拦截等），
+// 删除实例的cgroup并退化为rlimit，返回是否需要重新构造命令启动；未使用cgroup时返回false
+func (l *processLimits) fallback(startErr error) bool {
+	if l == nil || l.mode != limitModeCgroup {
+		return false
+	}
+
+	l.release()
+	l.dir = ""
+	l.useRlimit(fmt.Sprintf("无法在cgroup中启动进程: %v", startErr))
+	return true
+}
+
+// started 进程启动后关闭cgroup目录句柄
+func (l *processLimits) started() {
+	if l != nil && l.fd != nil {
+		l.fd.Close()
+		l.fd = nil
+	}
+}
+
+// oomKilled 实例cgroup中是否有进程因超出内存上限被OOM终止
+func (l *processLimits) oomKilled() bool {
+	if l == nil || l.dir == "" {
+		return false
+	}
+
+	data, err := os.ReadFile(filepath.Join(l.dir, "memory.events"))
+	if err != nil {
+		return false
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			count, _ := strconv.ParseInt(fields[1], 10, 64)
+			return count > 0
+		}
+	}
+	return false
+}
+
+// release 进程退出后删除实例的cgroup
+func (l *processLimits) release() {
+	if l == nil {
+		return
+	}
+	if l.fd != nil {
+		l.fd.Close()
+		l.fd = nil
+	}
+	if l.dir == "" {
+		return
+	}
+
+	// 进程被回收后内核可能还在清理cgroup，短暂重试
+	for i := 0; i < 50; i++ {
+		if err := os.Remove(l.dir); err == nil || os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// createInstanceCgroup 在插件池的子树下创建实例的cgroup并写入资源限制
+func createInstanceCgroup(pluginName, instanceID string, cfg *config.ResourceLimits) (string, error) {
+	if _, err := os.Stat(filepath.Join(cgroupMount, "cgroup.controllers")); err != nil {
+		return "", fmt.Errorf("系统未使用cgroup v2")
+	}
+
+	poolDir, err := poolCgroupDir(pluginName, cfg)
+	if err != nil {
+		return "", err
+	}
+
+	cgroupMutex.Lock()
+	err = preparePoolCgroup(poolDir, cfg)
+	cgroupMutex.Unlock()
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(poolDir, instanceID)
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return "", fmt.Errorf("创建实例cgroup %s 失败: %w", dir, err)
+	}
+	if err := writeCgroupLimits(dir, cfg); err != nil {
+		os.Remove(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// preparePoolCgroup 创建插件池的子树并在父cgroup和子树中启用需要的控制器
+// 控制器需要在每一级父cgroup的subtree_control中启用，子cgroup才能设置对应的限制
+func preparePoolCgroup(poolDir string, cfg *config.ResourceLimits) error {
+	parent := filepath.Dir(poolDir)
+	controllers := cgroupControllers(cfg)
+	if err := enableControllers(parent, controllers); err != nil {
+		return err
+	}
+	if err := os.Mkdir(poolDir, 0755); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("创建插件池cgroup %s 失败: %w", poolDir, err)
+	}
+	return enableControllers(poolDir, controllers)
+}
+
+// poolCgroupDir 插件池子树的目录，位于CgroupParent之下
+// 主机不会移动自身或其他进程所在的cgroup，未配置CgroupParent时不使用cgroup
+func poolCgroupDir(pluginName string, cfg *config.ResourceLimits) (string, error) {
+	if cfg.CgroupParent == "" {
+		return "", fmt.Errorf("未配置CgroupParent，使用cgroup需要指定已委派给主机进程且不含进程的cgroup")
+	}
+	return filepath.Join(cgroupMount, cfg.CgroupParent, "goproc-"+pluginName), nil
+}
+
+// cgroupControllers 资源限制需要的控制器
+func cgroupControllers(cfg *config.ResourceLimits) []string {
+	controllers := make([]string, 0, 3)
+	if cfg.MemoryMax > 0 {
+		controllers = append(controllers, "memory")
+	}
+	if cfg.CPUQuota > 0 {
+		controllers = append(controllers, "cpu")
+	}
+	if cfg.PidsMax > 0 {
+		controllers = append(controllers, "pids")
+	}
+	return controllers
+}
+
+// enableControllers 在cgroup的subtree_control中启用控制器，已启用的控制器不再写入
+func enableControllers(dir string, controllers []string) error {
+	path := filepath.Join(dir, "cgroup.subtree_control")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取 %s 失败: %w", path, err)
+	}
+	enabled := strings.Fields(string(data))
+
+	for _, controller := range controllers {
+		if slices.Contains(enabled, controller) {
+			continue
+		}
+		if err := os.WriteFile(path, []byte("+"+controller), 0); err != nil {
+			if errors.Is(err, syscall.EBUSY) {
+				return fmt.Errorf("在 %s 启用 %s 控制器失败，该cgroup中仍有进程，CgroupParent需要是已委派且不含进程的cgroup: %w", dir, controller, err)
+			}
+			return fmt.Errorf("在 %s 启用 %s 控制器失败: %w", dir, controller, err)
+		}
+	}
+	return nil
+}
+
+// writeCgroupLimits 把资源限制写入实例的cgroup
+func writeCgroupLimits(dir string, cfg *config.ResourceLimits) error {
+	limits := make(map[string]string, 4)
+	if cfg.MemoryMax > 0 {
+		limits["memory.max"] = strconv.FormatInt(cfg.MemoryMax, 10)
+	}
+	if cfg.CPUQuota > 0 {
+		limits["cpu.max"] = fmt.Sprintf("%d %d", int64(cfg.CPUQuota*cgroupCPUPeriod), cgroupCPUPeriod)
+	}
+	if cfg.PidsMax > 0 {
+		limits["pids.max"] = strconv.FormatInt(cfg.PidsMax, 10)
+	}
+
+	for name, value := range limits {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(value), 0); err != nil {
+			return fmt.Errorf("写入 %s 失败: %w", filepath.Join(dir, name), err)
+		}
+	}
+
+	// 禁止使用交换分区，使超出内存上限的进程被OOM终止而不是变慢；系统未启用交换分区时该文件不存在
+	if cfg.MemoryMax > 0 {
+		os.WriteFile(filepath.Join(dir, "memory.swap.max"), []byte("0"), 0)
+	}
+	return nil
+}
+
+// removePoolCgroup 插件池停止后删除其cgroup子树，仍有实例cgroup时删除失败并保留
+func removePoolCgroup(pluginName string, cfg *config.ResourceLimits) {
+	if cfg == nil {
+		return
+	}
+	if dir, err := poolCgroupDir(pluginName, cfg); err == nil {
+		cgroupMutex.Lock()
+		os.Remove(dir)
+		cgroupMutex.Unlock()
+	}
+}
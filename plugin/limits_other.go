@@ -0,0 +1,56 @@
+//go:build !linux
+// +build !linux
+
+package plugin
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+
+	"github.com/hoonfeng/goproc/config"
+)
+
+// prepareLimits 当前平台不支持资源限制，只在状态中说明原因
+func prepareLimits(pluginName, instanceID string, cfg *config.ResourceLimits) *processLimits {
+	if cfg == nil {
+		return nil
+	}
+	limits := &processLimits{config: cfg, mode: limitModeNone, reason: fmt.Sprintf("当前平台 %s 不支持资源限制", runtime.GOOS)}
+	if cfg.MemoryMax > 0 {
+		limits.unenforced = append(limits.unenforced, "memory_max")
+	}
+	if cfg.CPUQuota > 0 {
+		limits.unenforced = append(limits.unenforced, "cpu_quota")
+	}
+	if cfg.PidsMax > 0 {
+		limits.unenforced = append(limits.unenforced, "pids_max")
+	}
+	return limits
+}
+
+// apply 当前平台不需要处理
+func (l *processLimits) apply(cmd *exec.Cmd) {
+}
+
+// fallback 当前平台不使用cgroup
+func (l *processLimits) fallback(startErr error) bool {
+	return false
+}
+
+// started 当前平台不需要处理
+func (l *processLimits) started() {
+}
+
+// oomKilled 当前平台无法判断进程是否被OOM终止
+func (l *processLimits) oomKilled() bool {
+	return false
+}
+
+// release 当前平台不需要处理
+func (l *processLimits) release() {
+}
+
+// removePoolCgroup 当前平台不需要处理
+func removePoolCgroup(pluginName string, cfg *config.ResourceLimits) {
+}
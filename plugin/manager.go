@@ -1,18 +1,31 @@
 package plugin
 
 import (
+	"context"
 	"fmt"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/hoonfeng/goproc/config"
 )
 
 // PluginManager 插件管理器
 type PluginManager struct {
-	Config   *config.SystemConfig
-	Pools    map[string]*PluginPool
-	Mutex    sync.RWMutex
+	Config    *config.SystemConfig
+	Pools     map[string]*PluginPool
+	Mutex     sync.RWMutex
 	IsRunning bool
+
+	// HostServices 插件可回调的主机服务，在Start之前注册
+	HostServices *HostServices
+
+	admission       *admissionLimiter            // 全局准入控制，未配置上限时为nil
+	pluginAdmission map[string]*admissionLimiter // 各插件的准入控制，插件重启后沿用
+	callTimeout     time.Duration                // 调用方未设置截止时间时使用的默认超时
+
+	rateLimiters map[string]*rateLimiter // 各函数的限流器，键为"插件.函数"
+	rateMutex    sync.Mutex
 }
 
 // NewPluginManager 创建新的插件管理器
@@ -21,6 +34,11 @@ func NewPluginManager(config *config.SystemConfig) *PluginManager {
 		Config:    config,
 		Pools:     make(map[string]*PluginPool),
 		IsRunning: false,
+
+		HostServices: NewHostServices(),
+
+		pluginAdmission: make(map[string]*admissionLimiter),
+		rateLimiters:    make(map[string]*rateLimiter),
 	}
 }
 
@@ -28,87 +46,239 @@ func NewPluginManager(config *config.SystemConfig) *PluginManager {
 func (pm *PluginManager) Start() error {
 	pm.Mutex.Lock()
 	defer pm.Mutex.Unlock()
-	
+
 	if pm.IsRunning {
 		return fmt.Errorf("插件管理器已经在运行")
 	}
-	
+
 	// 验证配置
 	if err := config.ValidateConfig(pm.Config); err != nil {
 		return fmt.Errorf("配置验证失败: %w", err)
 	}
-	
-	// 创建并启动所有插件池
+
+	// 全局并发上限和默认调用超时
+	pm.callTimeout, _ = pm.Config.System.GetCallTimeout()
+	pm.admission = newAdmissionLimiter("插件管理器", pm.Config.System.MaxConcurrentCalls, pm.Config.System.GetAdmissionPolicy())
+
+	// 创建并并发启动所有插件池，同时启动的插件池数不超过StartupParallelism
+	pools := make(map[string]*PluginPool, len(pm.Config.Plugins))
 	for pluginName, pluginConfig := range pm.Config.Plugins {
-		pool := NewPluginPool(pluginName, &pluginConfig)
-		
-		if err := pool.Start(); err != nil {
-			continue
-		}
-		
-		pm.Pools[pluginName] = pool
+		pools[pluginName] = pm.newPool(pluginName, &pluginConfig)
+	}
+
+	var wg sync.WaitGroup
+	var startedMutex sync.Mutex
+	sem := make(chan struct{}, pm.Config.System.GetStartupParallelism())
+	for pluginName, pool := range pools {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := pool.Start(); err != nil {
+				return
+			}
+
+			startedMutex.Lock()
+			pm.Pools[pluginName] = pool
+			startedMutex.Unlock()
+		}()
 	}
-	
+	wg.Wait()
+
 	if len(pm.Pools) == 0 {
 		return fmt.Errorf("没有成功启动任何插件池")
 	}
-	
+
 	pm.IsRunning = true
-	
+
 	return nil
 }
 
+// newPool 创建由管理器持有的插件池
+func (pm *PluginManager) newPool(pluginName string, pluginConfig *config.PluginConfig) *PluginPool {
+	pool := NewPluginPool(pluginName, pluginConfig)
+	pool.HostServices = pm.HostServices
+	if pluginConfig.Autoscale {
+		pool.ScalingPolicy = NewTargetUtilizationPolicy(pluginConfig)
+	}
+
+	// 上限和策略未变化时沿用原有的准入控制，重启插件池期间的在途调用仍然计入上限
+	policy := pluginConfig.GetAdmissionPolicy(pm.Config.System.GetAdmissionPolicy())
+	if limiter := pm.pluginAdmission[pluginName]; limiter == nil || limiter.limit != pluginConfig.MaxConcurrentCalls || limiter.policy != policy {
+		pm.pluginAdmission[pluginName] = newAdmissionLimiter("插件 "+pluginName, pluginConfig.MaxConcurrentCalls, policy)
+	}
+	return pool
+}
+
+// withCallTimeout 调用方未设置截止时间时使用配置的默认调用超时
+func (pm *PluginManager) withCallTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || pm.callTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, pm.callTimeout)
+}
+
+// admit 依次申请插件和全局的在途调用名额，返回的函数用于归还名额
+// 先申请插件名额，排队等待某个插件的调用不会占用全局名额，避免单个插件的突发流量挤占其他插件
+func (pm *PluginManager) admit(ctx context.Context, limiter *admissionLimiter) (func(), error) {
+	if err := limiter.acquire(ctx); err != nil {
+		return nil, err
+	}
+	if err := pm.admission.acquire(ctx); err != nil {
+		limiter.release()
+		return nil, err
+	}
+	return func() {
+		pm.admission.release()
+		limiter.release()
+	}, nil
+}
+
 // CallFunction 调用插件函数
 func (pm *PluginManager) CallFunction(pluginName string, functionName string, params map[string]interface{}) (interface{}, error) {
+	return pm.CallFunctionContext(context.Background(), pluginName, functionName, params)
+}
+
+// CallFunctionContext 调用插件函数，ctx取消或超时后插件端的调用也会被取消
+// 调用方未设置截止时间时使用SystemSettings.CallTimeout；在途调用数超过上限时按AdmissionPolicy拒绝或排队
+func (pm *PluginManager) CallFunctionContext(ctx context.Context, pluginName string, functionName string, params map[string]interface{}) (interface{}, error) {
+	return pm.CallFunctionWithOptions(ctx, pluginName, functionName, params, CallOptions{})
+}
+
+// CallFunctionWithOptions 按调用选项调用插件函数
+// 先按限流配置取得令牌，再申请并发名额，等待令牌的调用不占用并发名额
+func (pm *PluginManager) CallFunctionWithOptions(ctx context.Context, pluginName string, functionName string, params map[string]interface{}, opts CallOptions) (interface{}, error) {
 	pm.Mutex.RLock()
 	pool, exists := pm.Pools[pluginName]
+	limiter := pm.pluginAdmission[pluginName]
 	pm.Mutex.RUnlock()
-	
+
 	if !exists {
-		return nil, fmt.Errorf("插件 %s 不存在", pluginName)
+		return nil, fmt.Errorf("%w: %s", ErrPluginNotFound, pluginName)
 	}
-	
+
 	if !pm.IsRunning {
 		return nil, fmt.Errorf("插件管理器未运行")
 	}
-	
+
+	ctx, cancel := pm.withCallTimeout(ctx)
+	defer cancel()
+
+	// 限流
+	if err := pm.functionRateLimiter(pool, functionName).wait(ctx, opts.CallerID); err != nil {
+		return nil, fmt.Errorf("调用函数 %s 失败: %w", functionName, err)
+	}
+
+	// 准入控制
+	release, err := pm.admit(ctx, limiter)
+	if err != nil {
+		return nil, fmt.Errorf("调用函数 %s 失败: %w", functionName, err)
+	}
+	defer release()
+
 	// 调用函数
-	result, err := pool.CallFunction(functionName, params)
+	result, err := pool.CallFunctionWithOptions(ctx, functionName, params, opts)
 	if err != nil {
 		return nil, fmt.Errorf("调用函数 %s 失败: %w", functionName, err)
 	}
-	
+
 	return result, nil
 }
 
+// CallStream 以流式方式调用插件函数，通过返回的Stream逐块读取结果
+// 流在结束或关闭前一直占用准入名额；默认调用超时不作用于流，流的生命周期由ctx决定
+func (pm *PluginManager) CallStream(ctx context.Context, pluginName string, functionName string, params map[string]interface{}) (*Stream, error) {
+	return pm.CallStreamWithOptions(ctx, pluginName, functionName, params, CallOptions{})
+}
+
+// CallStreamWithOptions 按调用选项以流式方式调用插件函数
+func (pm *PluginManager) CallStreamWithOptions(ctx context.Context, pluginName string, functionName string, params map[string]interface{}, opts CallOptions) (*Stream, error) {
+	pm.Mutex.RLock()
+	pool, exists := pm.Pools[pluginName]
+	limiter := pm.pluginAdmission[pluginName]
+	pm.Mutex.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrPluginNotFound, pluginName)
+	}
+
+	if !pm.IsRunning {
+		return nil, fmt.Errorf("插件管理器未运行")
+	}
+
+	if err := pm.functionRateLimiter(pool, functionName).wait(ctx, opts.CallerID); err != nil {
+		return nil, fmt.Errorf("调用函数 %s 失败: %w", functionName, err)
+	}
+
+	release, err := pm.admit(ctx, limiter)
+	if err != nil {
+		return nil, fmt.Errorf("调用函数 %s 失败: %w", functionName, err)
+	}
+
+	stream, err := pool.callStream(ctx, functionName, params, opts, release)
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("调用函数 %s 失败: %w", functionName, err)
+	}
+
+	return stream, nil
+}
+
 // GetPluginStatus 获取插件状态
 func (pm *PluginManager) GetPluginStatus(pluginName string) (map[string]interface{}, error) {
 	pm.Mutex.RLock()
 	pool, exists := pm.Pools[pluginName]
 	pm.Mutex.RUnlock()
-	
+
 	if !exists {
-		return nil, fmt.Errorf("插件 %s 不存在", pluginName)
+		return nil, fmt.Errorf("%w: %s", ErrPluginNotFound, pluginName)
 	}
-	
-	return pool.GetStatus(), nil
+
+	status := pool.GetStatus()
+	pm.Mutex.RLock()
+	status["admission"] = pm.pluginAdmission[pluginName].status()
+	pm.Mutex.RUnlock()
+	return status, nil
 }
 
 // GetAllStatus 获取所有插件状态
 func (pm *PluginManager) GetAllStatus() map[string]interface{} {
 	pm.Mutex.RLock()
 	defer pm.Mutex.RUnlock()
-	
+
 	status := make(map[string]interface{})
-	
+	degraded := make([]string, 0)
+	openCircuits := make([]string, 0)
+
 	for pluginName, pool := range pm.Pools {
-		status[pluginName] = pool.GetStatus()
+		poolStatus := pool.GetStatus()
+		poolStatus["admission"] = pm.pluginAdmission[pluginName].status()
+		status[pluginName] = poolStatus
+		if poolStatus["state"] == PoolStateDegraded {
+			degraded = append(degraded, pluginName)
+		}
+		if pool.breaker.isOpen() {
+			openCircuits = append(openCircuits, pluginName)
+		}
+		if breakers, ok := poolStatus["circuit_breakers"].(map[string]interface{}); ok {
+			openFunctions, _ := breakers["open_functions"].([]string)
+			for _, functionName := range openFunctions {
+				openCircuits = append(openCircuits, pluginName+"."+functionName)
+			}
+		}
 	}
-	
+
 	return map[string]interface{}{
-		"is_running": pm.IsRunning,
-		"total_plugins": len(pm.Pools),
-		"plugins": status,
+		"is_running":       pm.IsRunning,
+		"total_plugins":    len(pm.Pools),
+		"degraded_plugins": degraded,
+		"open_circuits":    openCircuits,
+		"plugins":          status,
+		"admission":        pm.admission.status(),
+		"call_timeout":     pm.callTimeout.String(),
+		"rate_limits":      pm.rateLimitStatus(),
 	}
 }
 
@@ -116,19 +286,19 @@ func (pm *PluginManager) GetAllStatus() map[string]interface{} {
 func (pm *PluginManager) Stop() {
 	pm.Mutex.Lock()
 	defer pm.Mutex.Unlock()
-	
+
 	if !pm.IsRunning {
 		return
 	}
-	
+
 	// 停止所有插件池
 	for _, pool := range pm.Pools {
 		pool.Stop()
 	}
-	
+
 	// 清空插件池映射
 	pm.Pools = make(map[string]*PluginPool)
-	
+
 	pm.IsRunning = false
 }
 
@@ -136,33 +306,33 @@ func (pm *PluginManager) Stop() {
 func (pm *PluginManager) RestartPlugin(pluginName string) error {
 	pm.Mutex.Lock()
 	defer pm.Mutex.Unlock()
-	
+
 	if !pm.IsRunning {
 		return fmt.Errorf("插件管理器未运行")
 	}
-	
+
 	pool, exists := pm.Pools[pluginName]
 	if !exists {
-		return fmt.Errorf("插件 %s 不存在", pluginName)
+		return fmt.Errorf("%w: %s", ErrPluginNotFound, pluginName)
 	}
-	
+
 	// 停止插件池
 	pool.Stop()
-	
+
 	// 重新创建插件池
 	pluginConfig, exists := pm.Config.Plugins[pluginName]
 	if !exists {
 		return fmt.Errorf("插件 %s 的配置不存在", pluginName)
 	}
-	
-	newPool := NewPluginPool(pluginName, &pluginConfig)
+
+	newPool := pm.newPool(pluginName, &pluginConfig)
 	if err := newPool.Start(); err != nil {
 		return fmt.Errorf("重启插件池 %s 失败: %w", pluginName, err)
 	}
-	
+
 	// 更新插件池
 	pm.Pools[pluginName] = newPool
-	
+
 	return nil
 }
 
@@ -170,27 +340,27 @@ func (pm *PluginManager) RestartPlugin(pluginName string) error {
 func (pm *PluginManager) AddPlugin(pluginName string, pluginConfig config.PluginConfig) error {
 	pm.Mutex.Lock()
 	defer pm.Mutex.Unlock()
-	
+
 	if !pm.IsRunning {
 		return fmt.Errorf("插件管理器未运行")
 	}
-	
+
 	if _, exists := pm.Pools[pluginName]; exists {
 		return fmt.Errorf("插件 %s 已存在", pluginName)
 	}
-	
+
 	// 更新配置
 	pm.Config.Plugins[pluginName] = pluginConfig
-	
+
 	// 创建并启动插件池
-	pool := NewPluginPool(pluginName, &pluginConfig)
+	pool := pm.newPool(pluginName, &pluginConfig)
 	if err := pool.Start(); err != nil {
 		delete(pm.Config.Plugins, pluginName)
 		return fmt.Errorf("启动插件池 %s 失败: %w", pluginName, err)
 	}
-	
+
 	pm.Pools[pluginName] = pool
-	
+
 	return nil
 }
 
@@ -198,22 +368,31 @@ func (pm *PluginManager) AddPlugin(pluginName string, pluginConfig config.Plugin
 func (pm *PluginManager) RemovePlugin(pluginName string) error {
 	pm.Mutex.Lock()
 	defer pm.Mutex.Unlock()
-	
+
 	if !pm.IsRunning {
 		return fmt.Errorf("插件管理器未运行")
 	}
-	
+
 	pool, exists := pm.Pools[pluginName]
 	if !exists {
-		return fmt.Errorf("插件 %s 不存在", pluginName)
+		return fmt.Errorf("%w: %s", ErrPluginNotFound, pluginName)
 	}
-	
+
 	// 停止插件池
 	pool.Stop()
-	
+
 	// 从配置和池中移除
 	delete(pm.Config.Plugins, pluginName)
 	delete(pm.Pools, pluginName)
-	
+	delete(pm.pluginAdmission, pluginName)
+
+	pm.rateMutex.Lock()
+	for key := range pm.rateLimiters {
+		if strings.HasPrefix(key, pluginName+".") {
+			delete(pm.rateLimiters, key)
+		}
+	}
+	pm.rateMutex.Unlock()
+
 	return nil
-}
\ No newline at end of file
+}
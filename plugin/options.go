@@ -0,0 +1,44 @@
+package plugin
+
+// CallOptions 调用选项
+type CallOptions struct {
+	CallerID   string   // 调用方标识，限流配置了per_caller时按调用方分别计数
+	RoutingKey string   // 路由键，相同键的调用在实例存活时固定分配到同一实例，适用于在内存中缓存状态的插件
+	Priority   Priority // 优先级，插件池排队时优先服务高优先级的调用
+}
+
+// Priority 调用优先级
+type Priority int
+
+const (
+	PriorityLow    Priority = -1 // 低优先级，如批处理任务
+	PriorityNormal Priority = 0  // 默认优先级
+	PriorityHigh   Priority = 1  // 高优先级，如交互式请求，可以使用为高优先级保留的实例
+)
+
+// priorityClasses 优先级的数量
+const priorityClasses = 3
+
+// String 优先级名称
+func (p Priority) String() string {
+	switch p.class() {
+	case 0:
+		return "low"
+	case 2:
+		return "high"
+	default:
+		return "normal"
+	}
+}
+
+// class 优先级在调度队列中的下标，超出范围的值按最接近的优先级处理
+func (p Priority) class() int {
+	switch {
+	case p < PriorityNormal:
+		return 0
+	case p > PriorityNormal:
+		return 2
+	default:
+		return 1
+	}
+}
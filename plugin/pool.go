@@ -1,8 +1,11 @@
 package plugin
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hoonfeng/goproc/config"
@@ -11,41 +14,86 @@ import (
 )
 
 // PluginPool 插件池
+// 每个实例在槽位队列中占用InstanceConcurrency个槽位，同一实例可以同时承载多个调用
 type PluginPool struct {
 	PluginName   string
 	Config       *config.PluginConfig
 	Instances    map[string]*PluginInstance
-	Available    chan *PluginInstance
 	Mutex        sync.RWMutex
 	IsRunning    bool
 	MaxInstances int
-
-	// 简化的等待队列
-	waitQueue chan *PluginInstance // 直接存储等待的实例，而不是等待者通道
+	HostServices *HostServices // 实例可回调的主机服务
+
+	// ScalingPolicy 扩缩容策略，在Start之前设置；为nil时只在调用方路径上按需创建实例
+	ScalingPolicy ScalingPolicy
+
+	concurrency int        // 单个实例的并发槽位数
+	slots       *slotQueue // 空闲槽位和按到达顺序排队的调用方
+
+	stopCh       chan struct{}    // 关闭后健康检查和重启等后台协程退出
+	healthDone   chan struct{}    // 健康检查协程退出时关闭
+	evictedCount int              // 被移除的实例总数
+	crashCount   int              // 进程意外退出的实例总数
+	oomKillCount int              // 因超出内存上限被OOM终止的实例总数
+	reapedCount  int              // 因空闲被回收的实例总数
+	evictions    []EvictionRecord // 最近的实例移除记录
+
+	background     sync.WaitGroup // 替换崩溃实例的后台任务
+	replenishMutex sync.Mutex     // 串行补充实例
+
+	state         string      // 插件池状态，取值见PoolState*
+	crashTimes    []time.Time // 统计窗口内的崩溃时间
+	lastCrash     string      // 最近一次崩溃的原因
+	degradedSince time.Time   // 进入降级状态的时间
+	nextRestart   time.Time   // 下次计划重启的时间
+
+	starting        int           // 正在启动的实例数
+	waitTotal       int64         // 本评估周期内获取实例的总等待时间（纳秒）
+	waitCount       int64         // 本评估周期内需要等待的获取次数
+	scaleKick       chan struct{} // 通知扩缩容协程立即评估
+	lastMetrics     PoolMetrics   // 最近一次评估的负载指标
+	desired         int           // 最近一次评估的期望实例数
+	scaledDownCount int           // 被扩缩容策略回收的实例总数
+	scalePending    int           // 扩缩容协程发起、尚未结束的启动数
+	scaleFailures   int           // 扩缩容协程连续启动失败的次数
+	scaleRetryAt    time.Time     // 启动失败后按重启退避，到该时间之前不再扩容
+
+	retryCount int64 // 幂等调用的重试总数
+
+	ring        hashRing // 路由键使用的一致性哈希环，成员为池中的实例
+	routedCount int64    // 按路由键分配实例的调用总数
+
+	recycledCount   int             // 达到调用次数、运行时间或资源上限而被替换的实例总数
+	recycles        []RecycleRecord // 最近的实例替换记录
+	draining        int             // 正在被替换的实例数，包括等待替换实例启动和等待在途调用完成的实例
+	pendingRecycles int             // 替换实例的名额被占用、正在退避等待重试的替换数
+
+	breaker      *circuitBreaker            // 插件级熔断器，未配置时为nil
+	breakers     map[string]*circuitBreaker // 函数级熔断器，按函数名索引
+	breakerMutex sync.Mutex
 }
 
 // NewPluginPool 创建新的插件池
 func NewPluginPool(pluginName string, config *config.PluginConfig) *PluginPool {
-	// 可用队列容量设置为最大实例数，避免队列中有重复实例
-	queueCapacity := config.MaxInstances
-	if queueCapacity < 10 {
-		queueCapacity = 10 // 最小容量为10
-	}
-
-	// 简化的等待队列，容量为最大实例数
-	waitQueueCapacity := config.MaxInstances
-	if waitQueueCapacity < 10 {
-		waitQueueCapacity = 10
-	}
-
 	pool := &PluginPool{
 		PluginName:   pluginName,
 		Config:       config,
 		Instances:    make(map[string]*PluginInstance),
-		Available:    make(chan *PluginInstance, queueCapacity),
-		waitQueue:    make(chan *PluginInstance, waitQueueCapacity),
 		IsRunning:    false,
 		MaxInstances: config.MaxInstances,
+		concurrency:  config.GetInstanceConcurrency(false),
+		slots:        newSlotQueue(config.MaxQueueLength),
+		breaker:      newCircuitBreaker("插件 "+pluginName, config.CircuitBreaker),
+		breakers:     make(map[string]*circuitBreaker),
+		state:        PoolStateStopped,
+		scaleKick:    make(chan struct{}, 1),
+	}
+
+	// 保留实例的槽位只供高优先级调用使用，低优先级调用最多占用其余槽位
+	// 实例注册前按每个实例1个槽位计算，注册后按协商的并发数更新
+	pool.slots.starvation = config.GetStarvationTimeout()
+	if config.ReservedInstances > 0 {
+		pool.slots.lowLimit = config.MaxInstances - config.ReservedInstances
 	}
 
 	return pool
@@ -57,73 +105,182 @@ func (pp *PluginPool) Start() error {
 		return fmt.Errorf("插件池 %s 已经在运行", pp.PluginName)
 	}
 
-	// 创建初始实例（同步执行，不需要锁）
-	successCount := 0
-	for i := 0; i < pp.Config.PoolSize; i++ {
-		_, err := pp.createNewInstance()
-		if err != nil {
-			// 记录错误但不中断启动过程
-			continue
+	// 最少实例数为0时延迟到首次调用再启动实例
+	lazy := pp.Config.GetMinInstances() == 0
+
+	// 并发创建初始实例，同时启动的实例数不超过StartupParallelism
+	var successCount int64
+	if !lazy {
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, pp.Config.GetStartupParallelism())
+		for i := 0; i < pp.Config.PoolSize; i++ {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				// 记录错误但不中断启动过程
+				if _, err := pp.createNewInstance(false); err == nil {
+					atomic.AddInt64(&successCount, 1)
+				}
+			}()
 		}
-		successCount++
+		wg.Wait()
 	}
 
 	// 如果没有任何实例创建成功，返回错误
-	if successCount == 0 {
+	if successCount == 0 && !lazy {
 		errMsg := fmt.Errorf("插件池 %s 启动失败：无法创建任何插件实例", pp.PluginName)
 		return errMsg
 	}
 
+	pp.Mutex.Lock()
 	pp.IsRunning = true
+	pp.state = PoolStateRunning
+	pp.crashTimes = nil
+	pp.lastCrash = ""
+	pp.degradedSince = time.Time{}
+	pp.Mutex.Unlock()
+
+	// 启动健康检查协程，定期检查空闲实例并替换不健康的实例
+	pp.stopCh = make(chan struct{})
+	pp.healthDone = make(chan struct{})
+	go pp.superviseHealth(pp.Config.GetHealthCheckInterval(), pp.stopCh, pp.healthDone)
+
+	// 配置了空闲超时时启动回收协程
+	if idleTimeout := pp.Config.IdleTimeout; idleTimeout > 0 {
+		pp.background.Add(1)
+		go pp.reapIdle(idleTimeout)
+	}
+
+	// 定期采样实例进程的资源占用，超过上限的实例被替换
+	pp.background.Add(1)
+	go pp.sampleResources(pp.Config.GetResourceSampleInterval())
+
+	// 设置了扩缩容策略时在后台按负载调整实例数
+	if pp.ScalingPolicy != nil {
+		pp.background.Add(1)
+		go pp.superviseScaling(pp.ScalingPolicy)
+	}
 
 	return nil
 }
 
 // GetInstance 获取可用插件实例
 func (pp *PluginPool) GetInstance() (*PluginInstance, error) {
+	return pp.GetInstanceContext(context.Background())
+}
+
+// GetInstanceContext 获取可用插件实例，没有空闲槽位时按到达顺序排队
+// 排队时间不超过AcquireTimeout，ctx更早结束时以ctx为准；排队数达到MaxQueueLength时立即返回ErrQueueFull
+func (pp *PluginPool) GetInstanceContext(ctx context.Context) (*PluginInstance, error) {
+	return pp.acquire(ctx, CallOptions{})
+}
+
+// acquire 获取可用插件实例，设置了RoutingKey时按一致性哈希固定分配到同一实例
+// 排队时按Priority调度，使用完毕后必须以相同的优先级调用releaseInstance
+func (pp *PluginPool) acquire(ctx context.Context, opts CallOptions) (*PluginInstance, error) {
+	instance, err := pp.acquireSlot(ctx, opts)
+	if err == nil && instance != nil {
+		pp.countCall(instance)
+	}
+	return instance, err
+}
+
+// acquireSlot 获取一个实例槽位
+func (pp *PluginPool) acquireSlot(ctx context.Context, opts CallOptions) (*PluginInstance, error) {
 	if !pp.IsRunning {
 		return nil, fmt.Errorf("插件池 %s 未运行", pp.PluginName)
 	}
 
+	// 降级状态下直接失败
+	if err := pp.checkDegraded(); err != nil {
+		return nil, err
+	}
+
 	//fmt.Printf("[Pool] 正在获取实例，当前实例数: %d, 最大实例数: %d\n", len(pp.Instances), pp.MaxInstances)
 
-	// 首先尝试从可用队列获取实例（非阻塞）
-	select {
-	case instance := <-pp.Available:
-		//fmt.Printf("[Pool] 从可用队列获取实例: %s\n", instance.ID)
-		// 简化健康检查：只在必要时检查，避免频繁检查导致性能问题
-		// 如果实例最近被使用过，假设它是健康的
+	// 有路由键时只使用归属实例；池中还没有可用实例时按普通方式获取（首个实例在此启动）
+	if opts.RoutingKey != "" {
+		instance, routed, err := pp.acquireRouted(ctx, opts.RoutingKey, opts.Priority)
+		if routed {
+			if err == nil {
+				atomic.AddInt64(&pp.routedCount, 1)
+			}
+			return instance, err
+		}
+	}
+
+	// 首先尝试从可用队列获取实例（非阻塞），跳过已被移除或不健康实例的槽位
+	if instance, ok := pp.slots.tryGet(pp.isUsable, nil, opts.Priority); ok {
 		return instance, nil
-	default:
-		//fmt.Printf("[Pool] 可用队列为空\n")
-		// 队列为空，继续后续逻辑
+	}
+
+	// 记录获取实例的等待时间，供扩缩容策略参考
+	start := time.Now()
+	defer func() {
+		atomic.AddInt64(&pp.waitTotal, int64(time.Since(start)))
+		atomic.AddInt64(&pp.waitCount, 1)
+	}()
+
+	// 有扩缩容策略时由后台协程启动实例，调用方只等待槽位
+	if pp.ScalingPolicy != nil {
+		pp.kickScaler()
+		return pp.waitForSlot(ctx, nil, opts.Priority)
 	}
 
 	// 检查当前实例数量
 	pp.Mutex.RLock()
-	currentCount := len(pp.Instances)
+	currentCount := len(pp.Instances) + pp.starting
 	pp.Mutex.RUnlock()
 
-	if currentCount < pp.MaxInstances {
+	// 低优先级调用的名额用完时不再为其创建实例，剩余容量留给高优先级调用
+	if currentCount < pp.MaxInstances && pp.slots.reserve(opts.Priority) {
 		//fmt.Printf("[Pool] 创建新实例（当前: %d, 最大: %d）\n", currentCount, pp.MaxInstances)
 		// 未达到最大实例数，创建新实例
-		return pp.createNewInstance()
+		instance, err := pp.createNewInstance(true)
+		if err != nil {
+			pp.slots.done(opts.Priority)
+		}
+		return instance, err
 	} else {
 		//fmt.Printf("[Pool] 已达到最大实例数，等待可用实例\n")
 		// 已达到最大实例数，使用更智能的等待机制
-		return pp.waitForAvailableInstance()
+		return pp.waitForSlot(ctx, nil, opts.Priority)
 	}
 }
 
 // createNewInstance 创建新实例
-func (pp *PluginPool) createNewInstance() (*PluginInstance, error) {
-	pp.Mutex.RLock()
-	currentCount := len(pp.Instances)
-	pp.Mutex.RUnlock()
+// reserve为true时为调用方预留一个槽位，其余槽位放入槽位队列
+func (pp *PluginPool) createNewInstance(reserve bool) (*PluginInstance, error) {
+	return pp.startInstance(reserve, false)
+}
 
-	if currentCount >= pp.MaxInstances {
-		return nil, fmt.Errorf("已达到最大实例数 %d", pp.MaxInstances)
+// startInstance 启动实例并加入池中
+// replacing为true时创建的是替换实例，正在被替换的实例已不再分配调用，不计入最大实例数
+func (pp *PluginPool) startInstance(reserve bool, replacing bool) (*PluginInstance, error) {
+	// 正在启动的实例也计入实例数，避免并发创建时超出最大实例数
+	pp.Mutex.Lock()
+	limit := pp.MaxInstances
+	if replacing {
+		limit += pp.recyclingLocked()
+	}
+	if len(pp.Instances)+pp.starting >= limit {
+		pp.Mutex.Unlock()
+		return nil, fmt.Errorf("%w: 已达到最大实例数 %d", ErrPoolExhausted, pp.MaxInstances)
 	}
+	pp.starting++
+	pp.Mutex.Unlock()
+
+	started := false
+	defer func() {
+		if !started {
+			pp.Mutex.Lock()
+			pp.starting--
+			pp.Mutex.Unlock()
+		}
+	}()
 
 	// 使用UUID生成唯一实例ID，移除连字符以缩短长度
 	instanceUUID, err := uuid.NewRandom()
@@ -137,25 +294,50 @@ func (pp *PluginPool) createNewInstance() (*PluginInstance, error) {
 	instanceID := fmt.Sprintf("%s%s", pp.PluginName, uuidStr)
 
 	instance := NewPluginInstance(pp.PluginName, pp.Config, instanceID)
+	instance.HostServices = pp.HostServices
+	instance.onExit = pp.handleInstanceExit
 
 	// 先启动实例，如果失败则不添加到映射中
 	if err := instance.Start(); err != nil {
 		return nil, fmt.Errorf("启动实例 %s 失败: %w", instanceID, err)
 	}
 
+	// 槽位数取决于插件是否支持多路复用
+	slots := instance.Concurrency()
+
 	// 启动成功后再添加到实例映射
 	pp.Mutex.Lock()
 	pp.Instances[instanceID] = instance
+	pp.ring.add(instanceID)
+	pp.starting--
+	pp.concurrency = slots
+	started = true
 	pp.Mutex.Unlock()
 
-	// 将实例放入可用队列
-	pp.Available <- instance
+	// 将实例的槽位放入槽位队列，有调用方排队时直接交给排队者
+	if pp.Config.ReservedInstances > 0 {
+		pp.slots.setLowLimit((pp.MaxInstances - pp.Config.ReservedInstances) * slots)
+	}
+	if reserve {
+		slots--
+	}
+	for i := 0; i < slots; i++ {
+		pp.slots.put(instance)
+	}
 
 	return instance, nil
 }
 
-// ReturnInstance 归还插件实例
+// ReturnInstance 归还插件实例（释放一个槽位）
 func (pp *PluginPool) ReturnInstance(instance *PluginInstance) {
+	pp.releaseInstance(instance, PriorityNormal)
+}
+
+// releaseInstance 归还以指定优先级获取的实例
+func (pp *PluginPool) releaseInstance(instance *PluginInstance, priority Priority) {
+	// 无论实例是否仍在池中都要释放该优先级占用的名额
+	pp.slots.done(priority)
+
 	pp.Mutex.RLock()
 	if !pp.IsRunning {
 		pp.Mutex.RUnlock()
@@ -173,19 +355,8 @@ func (pp *PluginPool) ReturnInstance(instance *PluginInstance) {
 	// 简化健康检查：只在实例调用失败时进行健康检查
 	// 正常归还时假设实例是健康的
 
-	// 优先处理等待队列中的请求
-	select {
-	case pp.waitQueue <- instance:
-		// 成功放入等待队列
-	default:
-		// 等待队列已满，将实例放回可用队列
-		select {
-		case pp.Available <- instance:
-			// 成功归还
-		default:
-			// 队列已满，不归还（理论上不应该发生）
-		}
-	}
+	// 有调用方排队时直接交给队首，否则放回空闲槽位
+	pp.slots.put(instance)
 }
 
 // restartInstance 重启插件实例
@@ -203,21 +374,24 @@ func (pp *PluginPool) restartInstance(instance *PluginInstance) error {
 	return nil
 }
 
-// waitForAvailableInstance 等待可用实例（简化版本）
-func (pp *PluginPool) waitForAvailableInstance() (*PluginInstance, error) {
-	// 设置超时时间（5秒）
-	timeout := time.NewTimer(5 * time.Second)
-	defer timeout.Stop()
-
-	// 使用纯channel阻塞等待，移除default分支避免CPU忙等待
-	// Use pure channel blocking wait, remove default branch to avoid CPU busy waiting
-	select {
-	case instance := <-pp.Available:
-		return instance, nil
-	case instance := <-pp.waitQueue:
-		return instance, nil
-	case <-timeout.C:
-		return nil, fmt.Errorf("等待可用实例超时")
+// waitForSlot 排队等待可用槽位，直到AcquireTimeout或ctx结束；want不为nil时只等待该实例的槽位
+func (pp *PluginPool) waitForSlot(ctx context.Context, want *PluginInstance, priority Priority) (*PluginInstance, error) {
+	waitCtx, cancel := context.WithTimeout(ctx, pp.Config.GetAcquireTimeout())
+	defer cancel()
+
+	instance, err := pp.slots.get(waitCtx, pp.isUsable, want, priority)
+	switch {
+	case err == nil, errors.Is(err, errRouteLost):
+		return instance, err
+	case errors.Is(err, ErrQueueFull):
+		return nil, fmt.Errorf("%w: 插件池 %s 排队数已达上限 %d", ErrQueueFull, pp.PluginName, pp.Config.MaxQueueLength)
+	case errors.Is(err, errQueueClosed):
+		return nil, fmt.Errorf("插件池 %s 未运行", pp.PluginName)
+	case ctx.Err() != nil:
+		// 调用方的ctx先结束
+		return nil, ctx.Err()
+	default:
+		return nil, fmt.Errorf("%w: 等待可用实例超时", ErrPoolExhausted)
 	}
 }
 
@@ -232,15 +406,70 @@ func (pp *PluginPool) removeInstance(instanceID string) {
 
 		// 从实例映射中移除
 		delete(pp.Instances, instanceID)
+		pp.ring.remove(instanceID)
 	}
 }
 
 // CallFunction 调用插件函数
 func (pp *PluginPool) CallFunction(functionName string, params map[string]interface{}) (interface{}, error) {
+	return pp.CallFunctionContext(context.Background(), functionName, params)
+}
+
+// CallFunctionContext 调用插件函数，ctx取消或超时后插件端的调用也会被取消
+// 每次调用的超时时间取自函数策略，ctx和函数策略都未设置超时时不限制；幂等函数在实例崩溃或连接断开时换一个实例重试，非幂等函数只调用一次
+// 插件或函数的熔断器打开时直接返回ErrCircuitOpen
+func (pp *PluginPool) CallFunctionContext(ctx context.Context, functionName string, params map[string]interface{}) (interface{}, error) {
+	return pp.CallFunctionWithOptions(ctx, functionName, params, CallOptions{})
+}
+
+// CallFunctionWithOptions 按调用选项调用插件函数，设置了RoutingKey时相同键的调用固定分配到同一实例
+func (pp *PluginPool) CallFunctionWithOptions(ctx context.Context, functionName string, params map[string]interface{}, opts CallOptions) (interface{}, error) {
+	policy := pp.Config.GetFunctionPolicy(functionName)
+
+	done, err := pp.allowCall(functionName, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := pp.callWithRetry(ctx, functionName, params, policy, opts)
+	done(err)
+	return result, err
+}
+
+// callWithRetry 按函数策略调用插件函数，幂等函数失败后换一个实例重试
+func (pp *PluginPool) callWithRetry(ctx context.Context, functionName string, params map[string]interface{}, policy config.FunctionPolicy, opts CallOptions) (interface{}, error) {
+	backoff := policy.Backoff
+
+	for attempt := 0; ; attempt++ {
+		result, err := pp.callOnce(ctx, functionName, params, policy.Timeout, opts)
+		if err == nil || attempt >= *policy.MaxRetries || !isRetryable(err) {
+			return result, err
+		}
+
+		// 等待退避时间后重试，失败的实例已被标记为不可用，不会再被分配
+		atomic.AddInt64(&pp.retryCount, 1)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		}
+		backoff *= 2
+	}
+}
+
+// isRetryable 实例崩溃或连接断开导致的失败可以换一个实例重试
+func isRetryable(err error) bool {
+	return errors.Is(err, ErrInstanceCrashed) || errors.Is(err, ErrConnectionLost)
+}
+
+// callOnce 获取一个实例调用一次插件函数，timeout为本次调用的超时时间，为0时只受ctx的截止时间约束
+func (pp *PluginPool) callOnce(ctx context.Context, functionName string, params map[string]interface{}, timeout time.Duration, opts CallOptions) (interface{}, error) {
 	//fmt.Printf("[Pool] 调用函数: %s, 参数: %v\n", functionName, params)
 
 	// 获取实例
-	instance, err := pp.GetInstance()
+	instance, err := pp.acquire(ctx, opts)
 	if err != nil {
 		//fmt.Printf("[Pool] 获取实例失败: %v\n", err)
 		return nil, err
@@ -255,11 +484,17 @@ func (pp *PluginPool) CallFunction(functionName string, params map[string]interf
 	//fmt.Printf("[Pool] 获取实例成功: %s\n", instance.ID)
 
 	// 确保实例被归还
-	defer pp.ReturnInstance(instance)
+	defer pp.releaseInstance(instance, opts.Priority)
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 
 	// 调用函数
 	//fmt.Printf("[Pool] 在实例 %s 上调用函数: %s\n", instance.ID, functionName)
-	result, err := instance.CallFunction(functionName, params)
+	result, err := instance.CallFunctionContext(ctx, functionName, params)
 	if err != nil {
 		//fmt.Printf("[Pool] 函数调用失败: %v\n", err)
 		return nil, err
@@ -269,33 +504,91 @@ func (pp *PluginPool) CallFunction(functionName string, params map[string]interf
 	return result, nil
 }
 
+// CallStream 以流式方式调用插件函数
+// 实例在流结束或关闭前一直被占用，调用方必须读到流结束或调用Close
+func (pp *PluginPool) CallStream(ctx context.Context, functionName string, params map[string]interface{}) (*Stream, error) {
+	return pp.callStream(ctx, functionName, params, CallOptions{}, nil)
+}
+
+// callStream 以流式方式调用插件函数，流结束或关闭并归还实例后调用onDone（可为nil）
+func (pp *PluginPool) callStream(ctx context.Context, functionName string, params map[string]interface{}, opts CallOptions, onDone func()) (*Stream, error) {
+	instance, err := pp.acquire(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if instance == nil {
+		return nil, fmt.Errorf("获取到的插件实例为nil")
+	}
+
+	stream, err := instance.CallStreamContext(ctx, functionName, params, func() {
+		pp.releaseInstance(instance, opts.Priority)
+		if onDone != nil {
+			onDone()
+		}
+	})
+	if err != nil {
+		pp.releaseInstance(instance, opts.Priority)
+		return nil, err
+	}
+
+	return stream, nil
+}
+
 // GetStatus 获取插件池状态
 func (pp *PluginPool) GetStatus() map[string]interface{} {
 	pp.Mutex.RLock()
-	defer pp.Mutex.RUnlock()
+	instances := make([]*PluginInstance, 0, len(pp.Instances))
+	for _, instance := range pp.Instances {
+		instances = append(instances, instance)
+	}
+	pp.Mutex.RUnlock()
 
-	instancesStatus := make(map[string]interface{})
-	for id, instance := range pp.Instances {
-		instancesStatus[id] = instance.GetStatus()
+	// 实例状态需要获取实例锁，在不持有插件池锁时收集，停止中的实例不会阻塞插件池的其他操作
+	instancesStatus := make(map[string]interface{}, len(instances))
+	for _, instance := range instances {
+		instancesStatus[instance.ID] = instance.GetStatus()
 	}
 
-	// 计算可用实例数：通道中的实例数，但不能超过总实例数
-	// 由于通道可能有重复实例，我们需要确保可用实例数不超过总实例数
-	availableCount := len(pp.Available)
-	totalInstances := len(pp.Instances)
+	pp.Mutex.RLock()
+	defer pp.Mutex.RUnlock()
 
-	// 确保可用实例数不超过总实例数
-	if availableCount > totalInstances {
-		availableCount = totalInstances
+	// 计算可用槽位数：空闲槽位数，但不能超过全部实例的槽位总数
+	availableCount := pp.slots.freeCount()
+	totalInstances := len(instances)
+
+	if availableCount > totalInstances*pp.concurrency {
+		availableCount = totalInstances * pp.concurrency
 	}
 
+	queue := pp.slots.status()
+	queue["acquire_timeout"] = pp.Config.GetAcquireTimeout().String()
+
 	return map[string]interface{}{
 		"plugin_name":     pp.PluginName,
 		"is_running":      pp.IsRunning,
 		"total_instances": totalInstances,
 		"max_instances":   pp.MaxInstances,
 		"available_count": availableCount,
+		"concurrency":     pp.concurrency,
 		"instances":       instancesStatus,
+
+		"state":                 pp.state,
+		"restart":               pp.restartStatusLocked(),
+		"health_check_interval": pp.Config.GetHealthCheckInterval().String(),
+		"evicted_count":         pp.evictedCount,
+		"crash_count":           pp.crashCount,
+		"oom_kill_count":        pp.oomKillCount,
+		"reaped_count":          pp.reapedCount,
+		"min_instances":         pp.Config.GetMinInstances(),
+		"idle_timeout":          pp.Config.IdleTimeout.String(),
+		"scaling":               pp.scalingStatusLocked(),
+		"recycling":             pp.recycleStatusLocked(),
+		"queue":                 queue,
+		"retry_count":           atomic.LoadInt64(&pp.retryCount),
+		"routed_count":          atomic.LoadInt64(&pp.routedCount),
+		"circuit_breakers":      pp.breakerStatus(),
+		"evictions":             evictionStatus(pp.evictions),
 	}
 }
 
@@ -312,10 +605,18 @@ func (pp *PluginPool) Stop() {
 	// 设置停止标志（原子操作，不需要锁）
 	pp.Mutex.Lock()
 	pp.IsRunning = false
+	pp.state = PoolStateStopped
 	pp.Mutex.Unlock()
 
-	// 关闭等待队列，防止新的等待请求
-	close(pp.waitQueue)
+	// 等待健康检查和重启协程退出，避免其在停止过程中替换实例
+	if pp.stopCh != nil {
+		close(pp.stopCh)
+		<-pp.healthDone
+	}
+	pp.background.Wait()
+
+	// 关闭槽位队列，唤醒仍在排队的调用方并拒绝新的排队请求
+	pp.slots.close()
 
 	// 停止所有实例（不需要锁保护，因为IsRunning=false会阻止新操作）
 
@@ -333,8 +634,9 @@ func (pp *PluginPool) Stop() {
 	// 清空实例映射
 	pp.Mutex.Lock()
 	pp.Instances = make(map[string]*PluginInstance)
+	pp.ring = hashRing{}
 	pp.Mutex.Unlock()
 
-	// 关闭可用通道
-	close(pp.Available)
+	// 实例的cgroup已在进程退出后删除，最后删除插件池的子树
+	removePoolCgroup(pp.PluginName, pp.Config.Resources)
 }
@@ -0,0 +1,183 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hoonfeng/goproc/config"
+	"github.com/hoonfeng/goproc/sdk"
+)
+
+// newPipePool 创建包含n个模拟插件实例的运行中插件池，每个实例一个槽位
+func newPipePool(t *testing.T, cfg *config.PluginConfig, n int) (*PluginPool, []*fakePlugin) {
+	t.Helper()
+
+	cfg.MaxInstances = n
+	pool := NewPluginPool("test", cfg)
+	pool.IsRunning = true
+	pool.state = PoolStateRunning
+
+	plugins := make([]*fakePlugin, n)
+	for i := range plugins {
+		instance, plugin := newPipeInstanceID(t, fmt.Sprintf("test-%d", i+1), cfg)
+		pool.Instances[instance.ID] = instance
+		pool.ring.add(instance.ID)
+		pool.slots.put(instance)
+		plugins[i] = plugin
+	}
+	return pool, plugins
+}
+
+// serve 在后台处理实例发来的调用，handle返回nil时不回复
+// 后台协程不能调用t.Fatal，读写失败时直接退出
+func (p *fakePlugin) serve(handle func(p *fakePlugin, msg *sdk.Message) *sdk.Message) {
+	go func() {
+		for {
+			data, err := sdk.ReadFrame(p.conn, sdk.DefaultMaxFrameSize)
+			if err != nil {
+				return
+			}
+			msg, err := sdk.JSONCodec.Decode(data)
+			if err != nil {
+				return
+			}
+			reply := handle(p, msg)
+			if reply == nil {
+				continue
+			}
+			if data, err = sdk.JSONCodec.Encode(reply); err != nil {
+				return
+			}
+			if err := sdk.WriteFrame(p.conn, data, sdk.DefaultMaxFrameSize); err != nil {
+				return
+			}
+		}
+	}()
+}
+
+func TestPoolRetry(t *testing.T) {
+	noRetries := 0
+
+	// crash 收到调用后关闭连接，相当于插件进程崩溃
+	crash := func(p *fakePlugin, msg *sdk.Message) *sdk.Message {
+		p.conn.Close()
+		return nil
+	}
+	// fail 以插件返回的错误响应调用
+	fail := func(p *fakePlugin, msg *sdk.Message) *sdk.Message {
+		return &sdk.Message{Type: sdk.MessageTypeError, ID: msg.ID, ErrorInfo: &sdk.ErrorInfo{Code: sdk.ErrorCodeInternal, Message: "失败"}}
+	}
+
+	tests := []struct {
+		name        string
+		policy      config.FunctionPolicy
+		first       func(p *fakePlugin, msg *sdk.Message) *sdk.Message // 首个收到调用的实例的行为，之后的实例正常返回
+		wantErr     error
+		wantRemote  bool  // 期望返回插件端的错误
+		wantCalls   int64 // 插件收到的调用总数
+		wantRetries int64
+	}{
+		{name: "幂等函数在实例崩溃后重试", policy: config.FunctionPolicy{Idempotent: true}, first: crash, wantCalls: 2, wantRetries: 1},
+		{name: "非幂等函数不重试", policy: config.FunctionPolicy{}, first: crash, wantErr: ErrInstanceCrashed, wantCalls: 1},
+		{name: "重试次数为0时不重试", policy: config.FunctionPolicy{Idempotent: true, MaxRetries: &noRetries}, first: crash, wantErr: ErrInstanceCrashed, wantCalls: 1},
+		{name: "插件返回的错误不重试", policy: config.FunctionPolicy{Idempotent: true}, first: fail, wantRemote: true, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.policy.Backoff = 1
+			pool, plugins := newPipePool(t, &config.PluginConfig{
+				FunctionPolicies: map[string]config.FunctionPolicy{"echo": tt.policy},
+			}, 2)
+
+			var calls atomic.Int64
+			for _, plugin := range plugins {
+				plugin.serve(func(p *fakePlugin, msg *sdk.Message) *sdk.Message {
+					if msg.Type != sdk.MessageTypeCall {
+						return nil
+					}
+					if calls.Add(1) == 1 {
+						return tt.first(p, msg)
+					}
+					return &sdk.Message{Type: sdk.MessageTypeResult, ID: msg.ID, Result: "ok"}
+				})
+			}
+
+			result, err := pool.CallFunctionContext(context.Background(), "echo", nil)
+			var remote *RemoteError
+			switch {
+			case tt.wantRemote:
+				if !errors.As(err, &remote) {
+					t.Fatalf("调用返回 %v, 期望插件端的错误", err)
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("调用返回 %v, 期望 %v", err, tt.wantErr)
+				}
+			case err != nil || result != "ok":
+				t.Fatalf("调用返回 (%v, %v), 期望重试后返回 ok", result, err)
+			}
+
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("插件收到 %d 次调用, 期望 %d", got, tt.wantCalls)
+			}
+			if got := atomic.LoadInt64(&pool.retryCount); got != tt.wantRetries {
+				t.Errorf("重试 %d 次, 期望 %d", got, tt.wantRetries)
+			}
+		})
+	}
+}
+
+func TestPoolRetryConnectionLost(t *testing.T) {
+	tests := []struct {
+		name        string
+		idempotent  bool
+		wantErr     error
+		wantRetries int64
+	}{
+		{name: "幂等函数换一个实例重试", idempotent: true, wantRetries: 1},
+		{name: "非幂等函数不重试", idempotent: false, wantErr: ErrConnectionLost},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, plugins := newPipePool(t, &config.PluginConfig{
+				FunctionPolicies: map[string]config.FunctionPolicy{"echo": {Idempotent: tt.idempotent, Backoff: 1}},
+			}, 2)
+
+			calls := make([]atomic.Int64, len(plugins))
+			for i, plugin := range plugins {
+				plugin.serve(func(p *fakePlugin, msg *sdk.Message) *sdk.Message {
+					calls[i].Add(1)
+					return &sdk.Message{Type: sdk.MessageTypeResult, ID: msg.ID, Result: "ok"}
+				})
+			}
+
+			// 首先分配的实例写入连接失败，调用在插件收到之前就已失败
+			pool.Instances["test-1"].Conn.SetWriteDeadline(time.Now())
+
+			result, err := pool.CallFunctionContext(context.Background(), "echo", nil)
+			if tt.wantErr == nil {
+				if err != nil || result != "ok" {
+					t.Fatalf("调用返回 (%v, %v), 期望重试后返回 ok", result, err)
+				}
+			} else if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("调用返回 %v, 期望 %v", err, tt.wantErr)
+			}
+
+			if got := calls[0].Load(); got != 0 {
+				t.Errorf("写入失败的实例收到 %d 次调用", got)
+			}
+			if got, want := calls[1].Load(), tt.wantRetries; got != want {
+				t.Errorf("另一个实例收到 %d 次调用, 期望 %d", got, want)
+			}
+			if got := atomic.LoadInt64(&pool.retryCount); got != tt.wantRetries {
+				t.Errorf("重试 %d 次, 期望 %d", got, tt.wantRetries)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+//go:build linux
+// +build linux
+
+package plugin
+
+import (
+	"os/exec"
+	"runtime"
+	"sync"
+	"syscall"
+)
+
+// setParentDeathSignal 设置PR_SET_PDEATHSIG，主机进程退出时内核向插件进程发送SIGKILL
+func setParentDeathSignal(attr *syscall.SysProcAttr) {
+	attr.Pdeathsig = syscall.SIGKILL
+}
+
+// startRequest 交给启动线程的启动请求
+type startRequest struct {
+	cmd  *exec.Cmd
+	done chan error
+}
+
+var (
+	startOnce     sync.Once
+	startRequests chan startRequest
+)
+
+// startCommand 启动进程
+// PR_SET_PDEATHSIG在创建子进程的线程退出时触发，而不是在主机进程退出时（golang/go#27505）：
+// 普通goroutine所在的线程可能随后被锁定它的其他goroutine带走并销毁，插件进程随之被误杀。
+// 因此所有插件进程都由一个锁定在固定线程上、永不退出的goroutine启动
+func startCommand(cmd *exec.Cmd) error {
+	startOnce.Do(func() {
+		startRequests = make(chan startRequest)
+		go startLoop(startRequests)
+	})
+
+	request := startRequest{cmd: cmd, done: make(chan error, 1)}
+	startRequests <- request
+	return <-request.done
+}
+
+// startLoop 启动线程：锁定当前线程后依次处理启动请求，不解锁也不返回，线程在主机进程退出前一直存在
+func startLoop(requests <-chan startRequest) {
+	runtime.LockOSThread()
+	for request := range requests {
+		request.done <- request.cmd.Start()
+	}
+}
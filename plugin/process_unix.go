@@ -0,0 +1,44 @@
+//go:build !windows
+// +build !windows
+
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// configureProcessGroup 让插件进程在以自己为组长的新进程组中启动，停止时可以连同其子进程一起终止
+// 支持的平台上同时设置父进程退出信号，主机崩溃时插件进程随之退出
+func configureProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	setParentDeathSignal(cmd.SysProcAttr)
+}
+
+// terminateProcessGroup 向插件进程所在的进程组发送SIGTERM
+func terminateProcessGroup(process *os.Process) error {
+	return syscall.Kill(-process.Pid, syscall.SIGTERM)
+}
+
+// killProcessGroup 向插件进程所在的进程组发送SIGKILL，组长已退出时清理遗留的子进程
+func killProcessGroup(process *os.Process) error {
+	return syscall.Kill(-process.Pid, syscall.SIGKILL)
+}
+
+// attachReadyPipe 创建就绪管道，写端作为额外文件传给插件进程，并通过GOPROC_READY_FD告知其描述符编号
+// 调用方在进程启动后关闭写端，插件写入一个字节表示监听器已创建
+func attachReadyPipe(cmd *exec.Cmd) (reader *os.File, writer *os.File, err error) {
+	reader, writer, err = os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	cmd.ExtraFiles = append(cmd.ExtraFiles, writer)
+	// ExtraFiles中的第i个文件在子进程中的描述符为3+i
+	cmd.Env = append(cmd.Env, fmt.Sprintf("GOPROC_READY_FD=%d", 2+len(cmd.ExtraFiles)))
+	return reader, writer, nil
+}
@@ -0,0 +1,18 @@
+//go:build !windows && !linux
+// +build !windows,!linux
+
+package plugin
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setParentDeathSignal 当前平台不支持PR_SET_PDEATHSIG，依靠插件SDK检测主机退出
+func setParentDeathSignal(attr *syscall.SysProcAttr) {
+}
+
+// startCommand 启动进程
+func startCommand(cmd *exec.Cmd) error {
+	return cmd.Start()
+}
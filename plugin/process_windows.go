@@ -0,0 +1,39 @@
+//go:build windows
+// +build windows
+
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// configureProcessGroup 让插件进程在新的进程组中启动，不接收主机控制台的Ctrl+C
+func configureProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= syscall.CREATE_NEW_PROCESS_GROUP
+}
+
+// startCommand 启动进程
+func startCommand(cmd *exec.Cmd) error {
+	return cmd.Start()
+}
+
+// terminateProcessGroup Windows没有SIGTERM，直接返回错误由调用方强制终止
+func terminateProcessGroup(process *os.Process) error {
+	return fmt.Errorf("当前平台不支持向进程组发送终止信号")
+}
+
+// killProcessGroup 强制终止插件进程
+func killProcessGroup(process *os.Process) error {
+	return process.Kill()
+}
+
+// attachReadyPipe Windows不支持向子进程传递额外文件，插件就绪后由主机重试连接发现
+func attachReadyPipe(cmd *exec.Cmd) (reader *os.File, writer *os.File, err error) {
+	return nil, nil, nil
+}
@@ -0,0 +1,428 @@
+package plugin
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// slotQueue 实例槽位队列
+// 空闲槽位保存在free中；没有空闲槽位时调用方按优先级排队，归还的槽位优先交给高优先级的等待者，
+// 同一优先级内按到达顺序分配。等待超过starvation的调用不再让位于更高优先级，避免低优先级调用饿死
+type slotQueue struct {
+	mutex      sync.Mutex
+	free       []*PluginInstance          // 空闲槽位，每个元素代表实例的一个槽位
+	waiters    [priorityClasses]list.List // 各优先级的等待者队列，元素为*slotWaiter
+	maxWaiters int                        // 最大排队数，为0时不限制
+	closed     bool
+
+	starvation time.Duration // 等待超过该时间的调用按到达顺序优先分配，为0时不启用
+	lowLimit   int           // 非高优先级调用最多同时占用的槽位数，其余槽位为高优先级保留，小于0时不限制
+	lowInUse   int           // 非高优先级调用正在占用的槽位数
+
+	stats [priorityClasses]slotQueueStats // 各优先级的等待统计
+}
+
+// slotQueueStats 等待统计
+type slotQueueStats struct {
+	waits     int64         // 需要排队的获取次数
+	waitTotal time.Duration // 排队总时间
+	waitMax   time.Duration // 最长排队时间
+	rejected  int64         // 因队列已满被拒绝的次数
+	timeouts  int64         // 排队超时或被取消的次数
+}
+
+// slotWaiter 排队中的调用方
+type slotWaiter struct {
+	ch       chan *PluginInstance // 容量为1，归还槽位时不会阻塞；指定的实例失效时收到nil
+	want     *PluginInstance      // 只接受该实例的槽位，为nil时接受任意实例
+	priority Priority             // 调用优先级
+	since    time.Time            // 开始排队的时间
+}
+
+// newSlotQueue 创建槽位队列
+func newSlotQueue(maxWaiters int) *slotQueue {
+	return &slotQueue{maxWaiters: maxWaiters, lowLimit: -1}
+}
+
+// canTakeLocked 该优先级的调用是否还能占用槽位，调用方需持有q.mutex
+func (q *slotQueue) canTakeLocked(priority Priority) bool {
+	return priority.class() == PriorityHigh.class() || q.lowLimit < 0 || q.lowInUse < q.lowLimit
+}
+
+// takeLocked 记录一个槽位被该优先级的调用占用，调用方需持有q.mutex
+func (q *slotQueue) takeLocked(priority Priority) {
+	if priority.class() != PriorityHigh.class() {
+		q.lowInUse++
+	}
+}
+
+// reserve 为直接创建新实例的调用占用名额，超过非高优先级的上限时返回false
+func (q *slotQueue) reserve(priority Priority) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if !q.canTakeLocked(priority) {
+		return false
+	}
+	q.takeLocked(priority)
+	return true
+}
+
+// setLowLimit 更新非高优先级调用最多同时占用的槽位数，上限提高后等待的调用可能因此获得空闲槽位
+func (q *slotQueue) setLowLimit(limit int) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.lowLimit = limit
+	q.dispatchLocked()
+}
+
+// done 释放一个被该优先级的调用占用的名额，因名额不足而等待的调用可能因此获得空闲槽位
+func (q *slotQueue) done(priority Priority) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if priority.class() != PriorityHigh.class() && q.lowInUse > 0 {
+		q.lowInUse--
+	}
+	q.dispatchLocked()
+}
+
+// put 归还一个槽位：交给下一个可以接受该实例的等待者，没有时放入空闲槽位
+func (q *slotQueue) put(instance *PluginInstance) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return
+	}
+
+	q.free = append(q.free, instance)
+	q.dispatchLocked()
+}
+
+// dispatchLocked 把空闲槽位交给可以接受的等待者，调用方需持有q.mutex
+func (q *slotQueue) dispatchLocked() {
+	for i := 0; i < len(q.free); {
+		instance := q.free[i]
+		element, class := q.nextWaiterLocked(instance)
+		if element == nil {
+			i++
+			continue
+		}
+
+		waiter := q.waiters[class].Remove(element).(*slotWaiter)
+		q.free = append(q.free[:i], q.free[i+1:]...)
+		q.takeLocked(waiter.priority)
+		waiter.ch <- instance
+	}
+}
+
+// nextWaiterLocked 选出下一个接受该实例的等待者，调用方需持有q.mutex
+// 已经饿死的等待者按到达顺序优先，其余按优先级从高到低、同一优先级按到达顺序
+func (q *slotQueue) nextWaiterLocked(instance *PluginInstance) (*list.Element, int) {
+	accepts := func(waiter *slotWaiter) bool {
+		return (waiter.want == nil || waiter.want == instance) && q.canTakeLocked(waiter.priority)
+	}
+
+	if q.starvation > 0 {
+		var oldest *list.Element
+		oldestClass := 0
+		for class := 0; class < priorityClasses; class++ {
+			for e := q.waiters[class].Front(); e != nil; e = e.Next() {
+				waiter := e.Value.(*slotWaiter)
+				if time.Since(waiter.since) < q.starvation {
+					break
+				}
+				if accepts(waiter) {
+					if oldest == nil || waiter.since.Before(oldest.Value.(*slotWaiter).since) {
+						oldest = e
+						oldestClass = class
+					}
+					break
+				}
+			}
+		}
+		if oldest != nil {
+			return oldest, oldestClass
+		}
+	}
+
+	for class := priorityClasses - 1; class >= 0; class-- {
+		for e := q.waiters[class].Front(); e != nil; e = e.Next() {
+			if accepts(e.Value.(*slotWaiter)) {
+				return e, class
+			}
+		}
+	}
+	return nil, 0
+}
+
+// indexLocked 第一个属于want的空闲槽位的下标，want为nil时为第一个空闲槽位，调用方需持有q.mutex
+func (q *slotQueue) indexLocked(want *PluginInstance) int {
+	for i, instance := range q.free {
+		if want == nil || instance == want {
+			return i
+		}
+	}
+	return -1
+}
+
+// pop 为该优先级的调用取出一个属于want的空闲槽位，want为nil时取出任意空闲槽位
+func (q *slotQueue) pop(want *PluginInstance, priority Priority) (*PluginInstance, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	i := q.indexLocked(want)
+	if i < 0 || !q.canTakeLocked(priority) {
+		return nil, false
+	}
+	instance := q.free[i]
+	q.free = append(q.free[:i], q.free[i+1:]...)
+	q.takeLocked(priority)
+	return instance, true
+}
+
+// tryGet 非阻塞地取出一个可用槽位，want不为nil时只取该实例的槽位，不可用的槽位直接丢弃
+// usable在队列锁之外调用，避免与插件池的锁形成环
+func (q *slotQueue) tryGet(usable func(*PluginInstance) bool, want *PluginInstance, priority Priority) (*PluginInstance, bool) {
+	for {
+		instance, ok := q.pop(want, priority)
+		if !ok {
+			return nil, false
+		}
+		if usable(instance) {
+			return instance, true
+		}
+		q.done(priority)
+	}
+}
+
+// get 获取一个可用槽位，没有空闲槽位时按优先级排队，直到ctx结束
+// want不为nil时只等待该实例的槽位，该实例失效时返回errRouteLost
+func (q *slotQueue) get(ctx context.Context, usable func(*PluginInstance) bool, want *PluginInstance, priority Priority) (*PluginInstance, error) {
+	if instance, ok := q.tryGet(usable, want, priority); ok {
+		return instance, nil
+	}
+
+	class := priority.class()
+	waiter := &slotWaiter{ch: make(chan *PluginInstance, 1), want: want, priority: priority, since: time.Now()}
+
+	q.mutex.Lock()
+	if q.closed {
+		q.mutex.Unlock()
+		return nil, errQueueClosed
+	}
+	// 在持锁状态下再检查一次，避免与put竞争时错过刚归还的槽位
+	if q.indexLocked(want) >= 0 && q.canTakeLocked(priority) {
+		q.mutex.Unlock()
+		return q.get(ctx, usable, want, priority)
+	}
+	if q.maxWaiters > 0 && q.depthLocked() >= q.maxWaiters {
+		q.stats[class].rejected++
+		q.mutex.Unlock()
+		return nil, ErrQueueFull
+	}
+	element := q.waiters[class].PushBack(waiter)
+	q.mutex.Unlock()
+
+	for {
+		select {
+		case instance, ok := <-waiter.ch:
+			if !ok {
+				return nil, errQueueClosed
+			}
+			if instance != nil && usable(instance) {
+				q.recordWait(class, time.Since(waiter.since))
+				return instance, nil
+			}
+			if instance != nil {
+				q.done(priority)
+			}
+			if want != nil {
+				return nil, errRouteLost
+			}
+
+			// 拿到的槽位已失效，回到本优先级队首继续等待
+			q.mutex.Lock()
+			if q.closed {
+				q.mutex.Unlock()
+				return nil, errQueueClosed
+			}
+			if len(q.free) > 0 && q.canTakeLocked(priority) {
+				q.mutex.Unlock()
+				return q.get(ctx, usable, want, priority)
+			}
+			element = q.waiters[class].PushFront(waiter)
+			q.mutex.Unlock()
+		case <-ctx.Done():
+			q.mutex.Lock()
+			q.stats[class].timeouts++
+			removed := q.removeWaiterLocked(class, element, waiter)
+			q.mutex.Unlock()
+
+			// 已被分配槽位但尚未取走，释放名额并转交给下一个等待者
+			if !removed {
+				if instance, ok := <-waiter.ch; ok && instance != nil {
+					q.done(priority)
+					q.put(instance)
+				}
+			}
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// removeWaiterLocked 从等待队列中移除等待者，等待者已被分配槽位时返回false
+func (q *slotQueue) removeWaiterLocked(class int, element *list.Element, waiter *slotWaiter) bool {
+	for e := q.waiters[class].Front(); e != nil; e = e.Next() {
+		if e == element && e.Value.(*slotWaiter) == waiter {
+			q.waiters[class].Remove(e)
+			return true
+		}
+	}
+	return false
+}
+
+// recordWait 记录一次排队耗时
+func (q *slotQueue) recordWait(class int, wait time.Duration) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	stats := &q.stats[class]
+	stats.waits++
+	stats.waitTotal += wait
+	if wait > stats.waitMax {
+		stats.waitMax = wait
+	}
+}
+
+// purge 清除不可用的空闲槽位，并唤醒等待不可用实例的等待者
+func (q *slotQueue) purge(usable func(*PluginInstance) bool) {
+	q.mutex.Lock()
+	free := q.free
+	q.free = nil
+	wanted := make(map[*PluginInstance]bool)
+	for class := range q.waiters {
+		for e := q.waiters[class].Front(); e != nil; e = e.Next() {
+			if want := e.Value.(*slotWaiter).want; want != nil {
+				wanted[want] = true
+			}
+		}
+	}
+	q.mutex.Unlock()
+
+	for _, instance := range free {
+		if usable(instance) {
+			q.put(instance)
+		}
+	}
+
+	for want := range wanted {
+		if usable(want) {
+			delete(wanted, want)
+		}
+	}
+	if len(wanted) == 0 {
+		return
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for class := range q.waiters {
+		for e := q.waiters[class].Front(); e != nil; {
+			next := e.Next()
+			if waiter := e.Value.(*slotWaiter); wanted[waiter.want] {
+				q.waiters[class].Remove(e)
+				waiter.ch <- nil
+			}
+			e = next
+		}
+	}
+}
+
+// close 关闭队列并唤醒所有等待者
+func (q *slotQueue) close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.closed = true
+	q.free = nil
+	for class := range q.waiters {
+		for e := q.waiters[class].Front(); e != nil; e = e.Next() {
+			close(e.Value.(*slotWaiter).ch)
+		}
+		q.waiters[class].Init()
+	}
+}
+
+// freeCount 空闲槽位数
+func (q *slotQueue) freeCount() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.free)
+}
+
+// depth 排队中的调用数
+func (q *slotQueue) depth() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.depthLocked()
+}
+
+// depthLocked 排队中的调用数，调用方需持有q.mutex
+func (q *slotQueue) depthLocked() int {
+	depth := 0
+	for class := range q.waiters {
+		depth += q.waiters[class].Len()
+	}
+	return depth
+}
+
+// status 队列状态输出
+func (q *slotQueue) status() map[string]interface{} {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	var total slotQueueStats
+	priorities := make(map[string]interface{}, priorityClasses)
+	for _, priority := range []Priority{PriorityLow, PriorityNormal, PriorityHigh} {
+		stats := q.stats[priority.class()]
+		priorities[priority.String()] = stats.status(q.waiters[priority.class()].Len())
+
+		total.waits += stats.waits
+		total.waitTotal += stats.waitTotal
+		total.waitMax = max(total.waitMax, stats.waitMax)
+		total.rejected += stats.rejected
+		total.timeouts += stats.timeouts
+	}
+
+	status := total.status(q.depthLocked())
+	status["max_length"] = q.maxWaiters
+	status["priorities"] = priorities
+	status["starvation_timeout"] = q.starvation.String()
+	if q.lowLimit >= 0 {
+		status["low_priority_limit"] = q.lowLimit
+		status["low_priority_in_use"] = q.lowInUse
+	}
+	return status
+}
+
+// status 等待统计输出
+func (s slotQueueStats) status(depth int) map[string]interface{} {
+	var avgWait time.Duration
+	if s.waits > 0 {
+		avgWait = s.waitTotal / time.Duration(s.waits)
+	}
+
+	return map[string]interface{}{
+		"depth":       depth,
+		"waits":       s.waits,
+		"avg_wait_ms": float64(avgWait.Microseconds()) / 1000,
+		"max_wait_ms": float64(s.waitMax.Microseconds()) / 1000,
+		"rejected":    s.rejected,
+		"timeouts":    s.timeouts,
+	}
+}
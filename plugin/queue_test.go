@@ -0,0 +1,252 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func alwaysUsable(*PluginInstance) bool { return true }
+
+// waitDepth 等待队列中的排队数达到want
+func waitDepth(t *testing.T, q *slotQueue, want int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for q.depth() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("排队数 = %d, 期望 %d", q.depth(), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// enqueue 以指定优先级排队，排进队列后返回，获得的槽位从返回的通道读取
+func enqueue(t *testing.T, ctx context.Context, q *slotQueue, priority Priority) <-chan *PluginInstance {
+	t.Helper()
+
+	depth := q.depth()
+	got := make(chan *PluginInstance, 1)
+	go func() {
+		instance, _ := q.get(ctx, alwaysUsable, nil, priority)
+		got <- instance
+	}()
+	waitDepth(t, q, depth+1)
+	return got
+}
+
+// served 判断排队的调用方是否已获得槽位
+func served(got <-chan *PluginInstance) (*PluginInstance, bool) {
+	select {
+	case instance := <-got:
+		return instance, true
+	case <-time.After(20 * time.Millisecond):
+		return nil, false
+	}
+}
+
+func TestSlotQueueFIFO(t *testing.T) {
+	q := newSlotQueue(0)
+	defer q.close()
+
+	// 归还的槽位依次交给最早排队的调用方
+	instances := []*PluginInstance{{ID: "i1"}, {ID: "i2"}, {ID: "i3"}}
+	waiters := make([]<-chan *PluginInstance, len(instances))
+	for i := range waiters {
+		waiters[i] = enqueue(t, context.Background(), q, PriorityNormal)
+	}
+	for i, instance := range instances {
+		q.put(instance)
+		if got, ok := served(waiters[i]); !ok || got != instance {
+			t.Fatalf("第 %d 个排队的调用方获得 %v, 期望 %s", i+1, got, instance.ID)
+		}
+	}
+	if free := q.freeCount(); free != 0 {
+		t.Errorf("槽位全部交给排队者后仍有 %d 个空闲槽位", free)
+	}
+}
+
+func TestSlotQueuePriority(t *testing.T) {
+	q := newSlotQueue(0)
+	defer q.close()
+
+	// 按低、普通、高的顺序到达，按高、普通、低的顺序获得槽位
+	low := enqueue(t, context.Background(), q, PriorityLow)
+	normal := enqueue(t, context.Background(), q, PriorityNormal)
+	high := enqueue(t, context.Background(), q, PriorityHigh)
+
+	instance := &PluginInstance{ID: "i1"}
+	for _, next := range []struct {
+		name string
+		got  <-chan *PluginInstance
+	}{{"高优先级", high}, {"普通优先级", normal}, {"低优先级", low}} {
+		q.put(instance)
+		if _, ok := served(next.got); !ok {
+			t.Fatalf("%s的调用方未获得槽位", next.name)
+		}
+	}
+}
+
+func TestSlotQueueStarvationGuard(t *testing.T) {
+	const starvation = 60 * time.Millisecond
+	const tick = 10 * time.Millisecond
+
+	for _, guard := range []time.Duration{starvation, 0} {
+		t.Run(fmt.Sprintf("starvation=%s", guard), func(t *testing.T) {
+			q := newSlotQueue(0)
+			q.starvation = guard
+			ctx, cancel := context.WithCancel(context.Background())
+			defer func() {
+				cancel()
+				q.close()
+			}()
+
+			// 低优先级调用方开始排队的时间介于sinceMin和sinceMax之间
+			sinceMin := time.Now()
+			low := enqueue(t, ctx, q, PriorityLow)
+			sinceMax := time.Now()
+
+			// 高优先级调用持续到达，每次归还一个槽位
+			instance := &PluginInstance{ID: "i1"}
+			for round := 0; round < int(3*starvation/tick); round++ {
+				high := enqueue(t, ctx, q, PriorityHigh)
+				time.Sleep(tick)
+
+				before := time.Now()
+				q.put(instance)
+				after := time.Now()
+
+				if _, ok := served(low); ok {
+					if guard == 0 {
+						t.Fatalf("未启用饿死保护时低优先级调用在第 %d 轮获得了槽位", round+1)
+					}
+					// 只有等待超过starvation才能越过排队的高优先级调用
+					if waited := after.Sub(sinceMin); waited < guard {
+						t.Fatalf("低优先级调用只等待了 %s 就越过了高优先级调用", waited)
+					}
+					if _, ok := served(high); ok {
+						t.Fatal("同一个槽位被交给了两个调用方")
+					}
+					return
+				}
+
+				// 等待超过starvation后的第一个槽位必须交给低优先级调用
+				if guard > 0 && before.Sub(sinceMax) >= guard {
+					t.Fatalf("低优先级调用已等待 %s，超过 %s 后仍未获得槽位", before.Sub(sinceMax), guard)
+				}
+				if _, ok := served(high); !ok {
+					t.Fatal("高优先级调用未获得槽位")
+				}
+			}
+			if guard > 0 {
+				t.Fatal("低优先级调用一直没有获得槽位")
+			}
+		})
+	}
+}
+
+func TestSlotQueueReserved(t *testing.T) {
+	q := newSlotQueue(0)
+	defer q.close()
+
+	// 非高优先级的名额已用完，归还的槽位只能交给高优先级调用
+	q.lowLimit = 1
+	if !q.reserve(PriorityNormal) {
+		t.Fatal("预占名额失败")
+	}
+	normal := enqueue(t, context.Background(), q, PriorityNormal)
+	high := enqueue(t, context.Background(), q, PriorityHigh)
+
+	q.put(&PluginInstance{ID: "i1"})
+	if _, ok := served(high); !ok {
+		t.Fatal("高优先级调用未获得保留的槽位")
+	}
+	q.put(&PluginInstance{ID: "i2"})
+	if _, ok := served(normal); ok {
+		t.Fatal("名额用完时普通优先级调用仍获得了槽位")
+	}
+
+	// 普通优先级调用归还名额后，等待的普通调用获得空闲槽位
+	q.done(PriorityNormal)
+	if _, ok := served(normal); !ok {
+		t.Fatal("归还名额后普通优先级调用未获得空闲槽位")
+	}
+}
+
+func TestSlotQueueCancel(t *testing.T) {
+	q := newSlotQueue(0)
+	defer q.close()
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := q.get(ctx, alwaysUsable, nil, PriorityNormal); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("超时后返回 %v, 期望 context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("超时前就返回了: %s", elapsed)
+	}
+	if depth := q.depth(); depth != 0 {
+		t.Errorf("取消后排队数 = %d, 期望 0", depth)
+	}
+
+	// 排在中间的调用方取消后，槽位交给它之后的调用方
+	first := enqueue(t, context.Background(), q, PriorityNormal)
+	canceledCtx, cancelWaiter := context.WithCancel(context.Background())
+	canceled := enqueue(t, canceledCtx, q, PriorityNormal)
+	last := enqueue(t, context.Background(), q, PriorityNormal)
+	cancelWaiter()
+	if got := <-canceled; got != nil {
+		t.Fatalf("取消的调用方获得了槽位 %s", got.ID)
+	}
+	waitDepth(t, q, 2)
+
+	q.put(&PluginInstance{ID: "i1"})
+	q.put(&PluginInstance{ID: "i2"})
+	for _, got := range []<-chan *PluginInstance{first, last} {
+		if _, ok := served(got); !ok {
+			t.Fatal("取消的调用方之后的调用方未获得槽位")
+		}
+	}
+	if free := q.freeCount(); free != 0 {
+		t.Errorf("空闲槽位数 = %d, 期望 0", free)
+	}
+
+	status := q.status()
+	if timeouts := status["priorities"].(map[string]interface{})["normal"].(map[string]interface{})["timeouts"]; timeouts != int64(2) {
+		t.Errorf("超时和取消次数 = %v, 期望 2", timeouts)
+	}
+}
+
+func TestSlotQueueFull(t *testing.T) {
+	q := newSlotQueue(1)
+	defer q.close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	enqueue(t, ctx, q, PriorityNormal)
+
+	if _, err := q.get(ctx, alwaysUsable, nil, PriorityHigh); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("队列已满时返回 %v, 期望 ErrQueueFull", err)
+	}
+}
+
+func TestSlotQueueClose(t *testing.T) {
+	q := newSlotQueue(0)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := q.get(context.Background(), alwaysUsable, nil, PriorityLow)
+		done <- err
+	}()
+	waitDepth(t, q, 1)
+
+	q.close()
+	if err := <-done; !errors.Is(err, errQueueClosed) {
+		t.Fatalf("关闭后返回 %v, 期望 errQueueClosed", err)
+	}
+	if _, err := q.get(context.Background(), alwaysUsable, nil, PriorityHigh); !errors.Is(err, errQueueClosed) {
+		t.Fatalf("关闭后排队返回 %v, 期望 errQueueClosed", err)
+	}
+}
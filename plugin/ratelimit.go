@@ -0,0 +1,214 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hoonfeng/goproc/config"
+)
+
+// rateLimitSweepInterval 清理空闲调用方令牌桶的间隔
+const rateLimitSweepInterval = time.Minute
+
+// tokenBucket 令牌桶，令牌数可以为负，表示已被等待中的调用预订
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter 单个函数的令牌桶限流器，按调用方分别限流时每个调用方一个令牌桶
+type rateLimiter struct {
+	scope  string // 限流范围，用于错误信息
+	config *config.RateLimitConfig
+	rate   float64
+	burst  float64
+
+	mutex     sync.Mutex
+	buckets   map[string]*tokenBucket // 按调用方索引，不区分调用方时键为空字符串
+	lastSweep time.Time
+	now       func() time.Time // 补充令牌使用的时钟，测试中替换为模拟时钟
+
+	allowed  int64 // 放行的调用总数
+	waited   int64 // 等待令牌后放行的调用总数
+	rejected int64 // 被拒绝的调用总数
+}
+
+// newRateLimiter 创建限流器，cfg为nil时返回nil，表示不限流
+func newRateLimiter(scope string, cfg *config.RateLimitConfig) *rateLimiter {
+	if cfg == nil {
+		return nil
+	}
+	return &rateLimiter{
+		scope:     scope,
+		config:    cfg,
+		rate:      cfg.Rate,
+		burst:     float64(cfg.GetBurst()),
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// refill 按经过的时间补充令牌，返回补充后的令牌桶，调用方需持有l.mutex
+func (l *rateLimiter) refill(key string, now time.Time) *tokenBucket {
+	bucket, exists := l.buckets[key]
+	if !exists {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = bucket
+		return bucket
+	}
+	bucket.tokens = min(bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate, l.burst)
+	bucket.last = now
+	return bucket
+}
+
+// sweepLocked 移除已补满的调用方令牌桶，它们与新建的令牌桶等价，调用方需持有l.mutex
+func (l *rateLimiter) sweepLocked(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// wait 取得一个令牌：令牌耗尽时按策略拒绝，或等待令牌补充直到ctx结束
+func (l *rateLimiter) wait(ctx context.Context, callerID string) error {
+	if l == nil {
+		return nil
+	}
+
+	key := ""
+	if l.config.PerCaller {
+		key = callerID
+	}
+
+	l.mutex.Lock()
+	now := l.now()
+	l.sweepLocked(now)
+	bucket := l.refill(key, now)
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		l.allowed++
+		l.mutex.Unlock()
+		return nil
+	}
+
+	// 还需要等待的时间
+	delay := time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+	if l.config.GetPolicy() == config.RateLimitReject {
+		l.rejected++
+		l.mutex.Unlock()
+		return fmt.Errorf("%w: %s 每秒最多 %v 次调用，请在 %s 后重试",
+			ErrRateLimited, l.describe(key), l.rate, delay.Round(time.Millisecond))
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		l.rejected++
+		l.mutex.Unlock()
+		return fmt.Errorf("%w: %s 需要等待 %s，超过调用剩余时间", ErrRateLimited, l.describe(key), delay.Round(time.Millisecond))
+	}
+
+	// 预订令牌后在锁外等待，后到的调用排在其后
+	bucket.tokens--
+	l.mutex.Unlock()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		l.mutex.Lock()
+		l.allowed++
+		l.waited++
+		l.mutex.Unlock()
+		return nil
+	case <-ctx.Done():
+		// 归还预订的令牌
+		l.mutex.Lock()
+		l.refill(key, l.now()).tokens++
+		l.rejected++
+		l.mutex.Unlock()
+		return fmt.Errorf("%w: %s 等待令牌时调用结束: %w", ErrRateLimited, l.describe(key), ctx.Err())
+	}
+}
+
+// describe 限流范围描述
+func (l *rateLimiter) describe(key string) string {
+	if key == "" {
+		return l.scope
+	}
+	return fmt.Sprintf("%s（调用方 %s）", l.scope, key)
+}
+
+// status 限流器状态输出
+func (l *rateLimiter) status() map[string]interface{} {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	status := map[string]interface{}{
+		"rate":       l.rate,
+		"burst":      int(l.burst),
+		"policy":     string(l.config.GetPolicy()),
+		"per_caller": l.config.PerCaller,
+		"allowed":    l.allowed,
+		"waited":     l.waited,
+		"rejected":   l.rejected,
+	}
+	if l.config.PerCaller {
+		callers := make(map[string]interface{}, len(l.buckets))
+		for key := range l.buckets {
+			callers[key] = l.refill(key, now).tokens
+		}
+		status["callers"] = callers
+	} else {
+		status["tokens"] = l.refill("", now).tokens
+	}
+	return status
+}
+
+// functionRateLimiter 获取函数的限流器，函数策略、插件、系统的限流配置依次生效，都未配置时返回nil
+func (pm *PluginManager) functionRateLimiter(pool *PluginPool, functionName string) *rateLimiter {
+	cfg := pool.Config.GetFunctionPolicy(functionName).RateLimit
+	if cfg == nil {
+		cfg = pool.Config.RateLimit
+	}
+	if cfg == nil {
+		cfg = pm.Config.System.RateLimit
+	}
+	if cfg == nil {
+		return nil
+	}
+
+	key := pool.PluginName + "." + functionName
+	pm.rateMutex.Lock()
+	defer pm.rateMutex.Unlock()
+
+	limiter, exists := pm.rateLimiters[key]
+	if !exists || limiter.config != cfg {
+		limiter = newRateLimiter(fmt.Sprintf("插件 %s 的函数 %s", pool.PluginName, functionName), cfg)
+		pm.rateLimiters[key] = limiter
+	}
+	return limiter
+}
+
+// rateLimitStatus 各函数限流器的状态输出，键为"插件.函数"
+func (pm *PluginManager) rateLimitStatus() map[string]interface{} {
+	pm.rateMutex.Lock()
+	limiters := make(map[string]*rateLimiter, len(pm.rateLimiters))
+	for key, limiter := range pm.rateLimiters {
+		limiters[key] = limiter
+	}
+	pm.rateMutex.Unlock()
+
+	status := make(map[string]interface{}, len(limiters))
+	for key, limiter := range limiters {
+		status[key] = limiter.status()
+	}
+	return status
+}
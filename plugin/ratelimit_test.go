@@ -0,0 +1,198 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hoonfeng/goproc/config"
+)
+
+// fakeClock 模拟时钟，只在advance时前进
+type fakeClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// newFakeClockLimiter 创建使用模拟时钟的限流器
+func newFakeClockLimiter(cfg config.RateLimitConfig) (*rateLimiter, *fakeClock) {
+	clock := &fakeClock{now: time.Now()}
+	limiter := newRateLimiter("测试", &cfg)
+	limiter.now = clock.Now
+	return limiter, clock
+}
+
+// take 连续取n个令牌，返回放行的次数，第一次被拒绝后停止
+func take(limiter *rateLimiter, callerID string, n int) int {
+	for i := 0; i < n; i++ {
+		if err := limiter.wait(context.Background(), callerID); err != nil {
+			return i
+		}
+	}
+	return n
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	limiter, clock := newFakeClockLimiter(config.RateLimitConfig{Rate: 10, Burst: 3, Policy: config.RateLimitReject})
+
+	// 新的令牌桶是满的，突发容量用完后拒绝，并提示补充一个令牌需要的时间
+	if got := take(limiter, "", 10); got != 3 {
+		t.Fatalf("满桶放行 %d 次, 期望 3", got)
+	}
+	err := limiter.wait(context.Background(), "")
+	if !errors.Is(err, ErrRateLimited) || !strings.Contains(err.Error(), "100ms") {
+		t.Fatalf("令牌耗尽时返回 %v, 期望 ErrRateLimited 并提示100ms后重试", err)
+	}
+
+	// 每秒10个令牌：50毫秒只补充半个，100毫秒补充一个
+	clock.advance(50 * time.Millisecond)
+	if got := take(limiter, "", 10); got != 0 {
+		t.Fatalf("补充半个令牌后放行 %d 次, 期望 0", got)
+	}
+	clock.advance(50 * time.Millisecond)
+	if got := take(limiter, "", 10); got != 1 {
+		t.Fatalf("补充一个令牌后放行 %d 次, 期望 1", got)
+	}
+
+	// 长时间空闲后最多补满突发容量
+	clock.advance(time.Hour)
+	if got := take(limiter, "", 10); got != 3 {
+		t.Fatalf("空闲后放行 %d 次, 期望 3", got)
+	}
+
+	status := limiter.status()
+	if status["allowed"] != int64(7) || status["rejected"] != int64(5) {
+		t.Errorf("统计 = allowed %v, rejected %v, 期望 7, 5", status["allowed"], status["rejected"])
+	}
+}
+
+func TestRateLimiterLowRate(t *testing.T) {
+	// 未配置突发容量时为速率向上取整，即1
+	limiter, clock := newFakeClockLimiter(config.RateLimitConfig{Rate: 0.5, Policy: config.RateLimitReject})
+
+	if got := take(limiter, "", 10); got != 1 {
+		t.Fatalf("满桶放行 %d 次, 期望 1", got)
+	}
+	clock.advance(time.Second)
+	if got := take(limiter, "", 10); got != 0 {
+		t.Fatalf("1秒后放行 %d 次, 期望 0", got)
+	}
+	clock.advance(time.Second)
+	if got := take(limiter, "", 10); got != 1 {
+		t.Fatalf("2秒后放行 %d 次, 期望 1", got)
+	}
+}
+
+func TestRateLimiterPerCaller(t *testing.T) {
+	limiter, clock := newFakeClockLimiter(config.RateLimitConfig{Rate: 1, Burst: 2, PerCaller: true, Policy: config.RateLimitReject})
+
+	// 每个调用方有独立的令牌桶，一个调用方用完不影响其他调用方
+	if got := take(limiter, "a", 10); got != 2 {
+		t.Fatalf("调用方a放行 %d 次, 期望 2", got)
+	}
+	if got := take(limiter, "b", 1); got != 1 {
+		t.Fatal("调用方a用完令牌后调用方b被拒绝")
+	}
+
+	// 补满的令牌桶在清理时移除，与新建的令牌桶等价
+	clock.advance(rateLimitSweepInterval + time.Second)
+	take(limiter, "c", 1)
+	limiter.mutex.Lock()
+	buckets := len(limiter.buckets)
+	limiter.mutex.Unlock()
+	if buckets != 1 {
+		t.Errorf("清理后剩余 %d 个令牌桶, 期望只剩调用方c的1个", buckets)
+	}
+	if got := take(limiter, "a", 10); got != 2 {
+		t.Fatalf("清理后调用方a放行 %d 次, 期望 2", got)
+	}
+
+	// 不区分调用方时共享一个令牌桶
+	shared, _ := newFakeClockLimiter(config.RateLimitConfig{Rate: 1, Burst: 1, Policy: config.RateLimitReject})
+	take(shared, "a", 1)
+	if got := take(shared, "b", 1); got != 0 {
+		t.Fatal("不区分调用方时调用方b没有受调用方a的影响")
+	}
+}
+
+func TestRateLimiterReservation(t *testing.T) {
+	limiter, _ := newFakeClockLimiter(config.RateLimitConfig{Rate: 20, Burst: 1})
+	take(limiter, "", 1)
+
+	// 令牌耗尽后等待补充，20次/秒约需50毫秒；等待中的调用预订了下一个令牌
+	waited := make(chan error, 1)
+	start := time.Now()
+	go func() {
+		waited <- limiter.wait(context.Background(), "")
+	}()
+	deadline := time.Now().Add(time.Second)
+	for {
+		limiter.mutex.Lock()
+		tokens := limiter.buckets[""].tokens
+		limiter.mutex.Unlock()
+		if tokens < 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("等待中的调用没有预订令牌")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// 后到的调用排在预订之后需要等待约100毫秒，剩余时间不足时立即拒绝
+	ctx, cancel := context.WithTimeout(context.Background(), 75*time.Millisecond)
+	defer cancel()
+	if err := limiter.wait(ctx, ""); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("剩余时间不足时返回 %v, 期望 ErrRateLimited", err)
+	}
+
+	if err := <-waited; err != nil {
+		t.Fatalf("等待令牌后返回 %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("等待时间 %s 过短", elapsed)
+	}
+
+	// 等待中被取消的调用归还预订的令牌
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		cancel()
+	}()
+	if err := limiter.wait(ctx, ""); !errors.Is(err, ErrRateLimited) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("取消后返回 %v, 期望 ErrRateLimited和context.Canceled", err)
+	}
+	limiter.mutex.Lock()
+	tokens := limiter.buckets[""].tokens
+	limiter.mutex.Unlock()
+	if tokens != -1 {
+		t.Errorf("取消后令牌数 = %v, 期望归还预订后仍为-1", tokens)
+	}
+
+	status := limiter.status()
+	if status["allowed"] != int64(2) || status["waited"] != int64(1) || status["rejected"] != int64(2) {
+		t.Errorf("统计 = allowed %v, waited %v, rejected %v, 期望 2, 1, 2", status["allowed"], status["waited"], status["rejected"])
+	}
+}
+
+func TestNilRateLimiter(t *testing.T) {
+	var limiter *rateLimiter
+	if err := limiter.wait(context.Background(), "a"); err != nil {
+		t.Fatalf("未启用的限流器返回 %v", err)
+	}
+}
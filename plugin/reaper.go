@@ -0,0 +1,87 @@
+package plugin
+
+import (
+	"sort"
+	"time"
+)
+
+// drainTimeout 回收实例时等待在途调用完成的最长时间
+const drainTimeout = 30 * time.Second
+
+// reapIdle 空闲回收协程：定期停止空闲超过IdleTimeout的实例，直到实例数降到MinInstances
+func (pp *PluginPool) reapIdle(idleTimeout time.Duration) {
+	defer pp.background.Done()
+
+	interval := idleTimeout / 2
+	if interval < 100*time.Millisecond {
+		interval = 100 * time.Millisecond
+	}
+
+	for pp.sleep(interval) {
+		pp.reapOnce(idleTimeout)
+	}
+}
+
+// reapOnce 回收一轮空闲实例，最久未使用的实例优先回收
+func (pp *PluginPool) reapOnce(idleTimeout time.Duration) {
+	minInstances := pp.Config.GetMinInstances()
+
+	pp.Mutex.RLock()
+	instances := make([]*PluginInstance, 0, len(pp.Instances))
+	for _, instance := range pp.Instances {
+		instances = append(instances, instance)
+	}
+	pp.Mutex.RUnlock()
+
+	if len(instances) <= minInstances {
+		return
+	}
+
+	lastUsed := make(map[string]time.Time, len(instances))
+	for _, instance := range instances {
+		instance.Mutex.RLock()
+		lastUsed[instance.ID] = instance.LastUsed
+		instance.Mutex.RUnlock()
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		return lastUsed[instances[i].ID].Before(lastUsed[instances[j].ID])
+	})
+
+	for _, instance := range instances {
+		if time.Since(lastUsed[instance.ID]) < idleTimeout || !instance.isIdle() {
+			continue
+		}
+
+		pp.Mutex.Lock()
+		if len(pp.Instances) <= minInstances || !pp.IsRunning {
+			pp.Mutex.Unlock()
+			return
+		}
+		_, exists := pp.Instances[instance.ID]
+		delete(pp.Instances, instance.ID)
+		pp.ring.remove(instance.ID)
+		if exists {
+			pp.reapedCount++
+		}
+		pp.Mutex.Unlock()
+
+		if exists {
+			pp.retireInstance(instance)
+		}
+	}
+}
+
+// retireInstance 停止已从实例映射中移除的实例：先清除其槽位，等待在途调用完成后再停止进程
+// 插件池停止时不再等待
+func (pp *PluginPool) retireInstance(instance *PluginInstance) {
+	pp.purgeAvailable()
+
+	deadline := time.Now().Add(drainTimeout)
+	for !instance.isIdle() && time.Now().Before(deadline) {
+		if !pp.sleep(10 * time.Millisecond) {
+			break
+		}
+	}
+
+	instance.Stop()
+}
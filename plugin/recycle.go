@@ -0,0 +1,194 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// recycleHistoryLimit 插件池保留的实例替换记录数
+const recycleHistoryLimit = 20
+
+// RecycleRecord 实例替换记录
+type RecycleRecord struct {
+	Time     time.Time      // 开始替换的时间
+	Instance string         // 被替换的实例ID
+	Reason   string         // 替换原因
+	Calls    int64          // 实例已处理的调用数
+	Lifetime time.Duration  // 实例已运行的时间
+	Usage    *ResourceUsage // 实例最近一次采样的资源占用，尚未采样时为nil
+}
+
+// countCall 记录分配给实例的一次调用，实例达到MaxCallsPerInstance或MaxLifetime时开始替换
+// 触发替换的调用仍在该实例上完成，之后实例不再分配新的调用；并发获取的槽位可能使调用数略超上限
+func (pp *PluginPool) countCall(instance *PluginInstance) {
+	calls := atomic.AddInt64(&instance.calls, 1)
+	if limit := pp.Config.MaxCallsPerInstance; limit > 0 && calls >= limit {
+		pp.recycleInstance(instance, fmt.Sprintf("已处理 %d 次调用", calls))
+		return
+	}
+	if reason := pp.expiredReason(instance); reason != "" {
+		pp.recycleInstance(instance, reason)
+	}
+}
+
+// expiredReason 实例运行时间超过MaxLifetime时返回替换原因，否则返回空字符串
+func (pp *PluginPool) expiredReason(instance *PluginInstance) string {
+	lifetime := pp.Config.MaxLifetime
+	if lifetime <= 0 {
+		return ""
+	}
+
+	instance.Mutex.RLock()
+	startedAt := instance.startedAt
+	instance.Mutex.RUnlock()
+
+	if startedAt.IsZero() || time.Since(startedAt) < lifetime {
+		return ""
+	}
+	return fmt.Sprintf("运行时间超过 %s", lifetime)
+}
+
+// recycleExpired 替换运行时间超过MaxLifetime的实例，空闲实例不会经过调用路径，由健康检查协程定期检查
+func (pp *PluginPool) recycleExpired() {
+	if pp.Config.MaxLifetime <= 0 {
+		return
+	}
+
+	pp.Mutex.RLock()
+	instances := make([]*PluginInstance, 0, len(pp.Instances))
+	for _, instance := range pp.Instances {
+		instances = append(instances, instance)
+	}
+	pp.Mutex.RUnlock()
+
+	for _, instance := range instances {
+		if reason := pp.expiredReason(instance); reason != "" {
+			pp.recycleInstance(instance, reason)
+		}
+	}
+}
+
+// recycleInstance 替换实例：立即把旧实例标记为正在替换，之后的调用不再分配给它；
+// 在后台启动替换实例并加入池中，再把旧实例从池中移除，等待其在途调用完成后停止它
+// 正在替换的实例不计入最大实例数，替换实例的名额被正在启动的其他实例占用时记为待替换，按重启退避重试
+// 每次替换都记录原因以及实例的调用数、运行时间和资源占用，便于定位内存泄漏的插件
+func (pp *PluginPool) recycleInstance(instance *PluginInstance, reason string) {
+	if !atomic.CompareAndSwapInt32(&instance.recycling, 0, 1) {
+		return
+	}
+
+	instance.Mutex.RLock()
+	record := RecycleRecord{
+		Time:     time.Now(),
+		Instance: instance.ID,
+		Reason:   reason,
+		Calls:    atomic.LoadInt64(&instance.calls),
+		Lifetime: time.Since(instance.startedAt),
+		Usage:    instance.usage,
+	}
+	instance.Mutex.RUnlock()
+
+	pp.Mutex.Lock()
+	if _, exists := pp.Instances[instance.ID]; !exists || !pp.IsRunning {
+		pp.Mutex.Unlock()
+		return
+	}
+	pp.draining++
+	// 在持有锁且池仍在运行时登记后台任务，保证Stop能等到替换完成
+	pp.background.Add(1)
+	pp.Mutex.Unlock()
+
+	// 清除旧实例的空闲槽位，在途调用归还的槽位在获取时被跳过
+	pp.purgeAvailable()
+
+	go func() {
+		defer pp.background.Done()
+		defer func() {
+			pp.Mutex.Lock()
+			pp.draining--
+			pp.Mutex.Unlock()
+		}()
+
+		// 替换实例启动失败时仍移除旧实例，由健康检查按MinInstances和重启退避补足
+		for attempt := 1; ; attempt++ {
+			_, err := pp.startInstance(false, true)
+			if !errors.Is(err, ErrPoolExhausted) {
+				break
+			}
+
+			pp.Mutex.Lock()
+			pp.pendingRecycles++
+			pp.Mutex.Unlock()
+
+			ok := pp.sleep(restartBackoff(pp.Config, attempt))
+
+			pp.Mutex.Lock()
+			pp.pendingRecycles--
+			_, exists := pp.Instances[instance.ID]
+			pp.Mutex.Unlock()
+
+			// 插件池已停止，或旧实例在等待期间已被健康检查或进程监控移除
+			if !ok || !exists {
+				return
+			}
+		}
+
+		pp.Mutex.Lock()
+		_, exists := pp.Instances[instance.ID]
+		if exists {
+			delete(pp.Instances, instance.ID)
+			pp.ring.remove(instance.ID)
+			pp.recycledCount++
+			pp.recycles = append(pp.recycles, record)
+			if len(pp.recycles) > recycleHistoryLimit {
+				pp.recycles = pp.recycles[len(pp.recycles)-recycleHistoryLimit:]
+			}
+		}
+		pp.Mutex.Unlock()
+
+		// 旧实例在替换实例启动期间已被健康检查或进程监控移除时，不再重复处理
+		if exists {
+			pp.retireInstance(instance)
+		}
+	}()
+}
+
+// recyclingLocked 池中正在被替换的实例数，调用方需持有pp.Mutex
+func (pp *PluginPool) recyclingLocked() int {
+	count := 0
+	for _, instance := range pp.Instances {
+		if atomic.LoadInt32(&instance.recycling) != 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// recycleStatusLocked 实例替换相关的状态输出，调用方需持有pp.Mutex
+func (pp *PluginPool) recycleStatusLocked() map[string]interface{} {
+	history := make([]map[string]interface{}, 0, len(pp.recycles))
+	for _, record := range pp.recycles {
+		history = append(history, map[string]interface{}{
+			"time":        record.Time.Format(time.RFC3339),
+			"instance":    record.Instance,
+			"reason":      record.Reason,
+			"calls":       record.Calls,
+			"lifetime_ms": record.Lifetime.Milliseconds(),
+			"resources":   usageStatus(record.Usage),
+		})
+	}
+
+	return map[string]interface{}{
+		"max_calls_per_instance":   pp.Config.MaxCallsPerInstance,
+		"max_lifetime":             pp.Config.MaxLifetime.String(),
+		"max_rss":                  pp.Config.MaxRSS,
+		"max_cpu_time":             pp.Config.MaxCPUTime.String(),
+		"resource_sample_interval": pp.Config.GetResourceSampleInterval().String(),
+		"recycled_count":           pp.recycledCount,
+		"draining":                 pp.draining,
+		"pending":                  pp.pendingRecycles,
+		"history":                  history,
+	}
+}
@@ -0,0 +1,100 @@
+package plugin
+
+import (
+	"fmt"
+	"time"
+)
+
+// ResourceUsage 插件实例进程的资源占用
+type ResourceUsage struct {
+	RSS        int64         // 常驻内存（字节）
+	CPUTime    time.Duration // 累计CPU时间（用户态+内核态）
+	CPUPercent float64       // 最近一个采样周期内的CPU使用率，100表示占满一个核
+	SampledAt  time.Time     // 采样时间
+}
+
+// sampleResources 资源采样协程：定期读取各实例进程的资源占用，超过上限的实例被替换
+func (pp *PluginPool) sampleResources(interval time.Duration) {
+	defer pp.background.Done()
+
+	for pp.sleep(interval) {
+		pp.sampleOnce()
+	}
+}
+
+// sampleOnce 对池中所有实例采样一次
+func (pp *PluginPool) sampleOnce() {
+	pp.Mutex.RLock()
+	instances := make([]*PluginInstance, 0, len(pp.Instances))
+	for _, instance := range pp.Instances {
+		instances = append(instances, instance)
+	}
+	pp.Mutex.RUnlock()
+
+	for _, instance := range instances {
+		usage, err := instance.sampleUsage()
+		if err != nil {
+			// 进程刚退出或平台不支持采样，跳过本轮
+			continue
+		}
+		if reason := pp.resourceReason(usage); reason != "" {
+			pp.recycleInstance(instance, reason)
+		}
+	}
+}
+
+// resourceReason 资源占用超过MaxRSS或MaxCPUTime时返回替换原因，否则返回空字符串
+func (pp *PluginPool) resourceReason(usage *ResourceUsage) string {
+	if limit := pp.Config.MaxRSS; limit > 0 && usage.RSS >= limit {
+		return fmt.Sprintf("常驻内存 %s 超过上限 %s", formatBytes(usage.RSS), formatBytes(limit))
+	}
+	if limit := pp.Config.MaxCPUTime; limit > 0 && usage.CPUTime >= limit {
+		return fmt.Sprintf("累计CPU时间 %s 超过上限 %s", usage.CPUTime.Round(time.Millisecond), limit)
+	}
+	return ""
+}
+
+// sampleUsage 读取实例进程的资源占用并保存，CPU使用率根据与上一次采样的差值计算
+func (pi *PluginInstance) sampleUsage() (*ResourceUsage, error) {
+	pi.Mutex.RLock()
+	process := pi.Process
+	pi.Mutex.RUnlock()
+
+	if process == nil || process.Process == nil {
+		return nil, fmt.Errorf("插件实例 %s 没有运行中的进程", pi.ID)
+	}
+
+	usage, err := readProcessUsage(process.Process.Pid)
+	if err != nil {
+		return nil, err
+	}
+
+	pi.Mutex.Lock()
+	defer pi.Mutex.Unlock()
+
+	if previous := pi.usage; previous != nil {
+		if elapsed := usage.SampledAt.Sub(previous.SampledAt); elapsed > 0 {
+			usage.CPUPercent = float64(usage.CPUTime-previous.CPUTime) / float64(elapsed) * 100
+		}
+	}
+	pi.usage = usage
+	return usage, nil
+}
+
+// usageStatus 把资源占用转换为状态输出格式，尚未采样时返回nil
+func usageStatus(usage *ResourceUsage) map[string]interface{} {
+	if usage == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"rss_bytes":   usage.RSS,
+		"cpu_time_ms": usage.CPUTime.Milliseconds(),
+		"cpu_percent": usage.CPUPercent,
+		"sampled_at":  usage.SampledAt.Format(time.RFC3339),
+	}
+}
+
+// formatBytes 以MB为单位格式化字节数
+func formatBytes(n int64) string {
+	return fmt.Sprintf("%.1fMB", float64(n)/(1<<20))
+}
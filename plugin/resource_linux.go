@@ -0,0 +1,61 @@
+//go:build linux
+// +build linux
+
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks /proc/<pid>/stat中CPU时间的单位（USER_HZ），Linux用户态接口固定为100
+const clockTicks = 100
+
+// readProcessUsage 从/proc/<pid>/stat和/proc/<pid>/statm读取进程的CPU时间和常驻内存
+func readProcessUsage(pid int) (*ResourceUsage, error) {
+	now := time.Now()
+
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil, fmt.Errorf("读取进程 %d 的CPU时间失败: %w", pid, err)
+	}
+	// 进程名可能包含空格和括号，从最后一个右括号之后开始解析；其后第一个字段是state（第3个字段）
+	end := strings.LastIndexByte(string(stat), ')')
+	if end < 0 {
+		return nil, fmt.Errorf("进程 %d 的stat格式错误", pid)
+	}
+	fields := strings.Fields(string(stat[end+1:]))
+	if len(fields) < 13 {
+		return nil, fmt.Errorf("进程 %d 的stat格式错误", pid)
+	}
+	utime, err := strconv.ParseInt(fields[11], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("解析进程 %d 的用户态CPU时间失败: %w", pid, err)
+	}
+	stime, err := strconv.ParseInt(fields[12], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("解析进程 %d 的内核态CPU时间失败: %w", pid, err)
+	}
+
+	statm, err := os.ReadFile(fmt.Sprintf("/proc/%d/statm", pid))
+	if err != nil {
+		return nil, fmt.Errorf("读取进程 %d 的内存占用失败: %w", pid, err)
+	}
+	pages := strings.Fields(string(statm))
+	if len(pages) < 2 {
+		return nil, fmt.Errorf("进程 %d 的statm格式错误", pid)
+	}
+	resident, err := strconv.ParseInt(pages[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("解析进程 %d 的常驻内存失败: %w", pid, err)
+	}
+
+	return &ResourceUsage{
+		RSS:       resident * int64(os.Getpagesize()),
+		CPUTime:   time.Duration(utime+stime) * time.Second / clockTicks,
+		SampledAt: now,
+	}, nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package plugin
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// readProcessUsage 当前平台没有/proc，不支持资源采样
+func readProcessUsage(pid int) (*ResourceUsage, error) {
+	return nil, fmt.Errorf("当前平台 %s 不支持采样进程 %d 的资源占用", runtime.GOOS, pid)
+}
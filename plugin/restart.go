@@ -0,0 +1,181 @@
+package plugin
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/hoonfeng/goproc/config"
+)
+
+// 插件池状态
+const (
+	PoolStateStopped  = "stopped"  // 未运行
+	PoolStateRunning  = "running"  // 正常运行
+	PoolStateDegraded = "degraded" // 崩溃过于频繁，调用直接失败，后台低频重试
+)
+
+// shouldRestart 根据重启策略判断进程退出后是否需要重启
+func shouldRestart(policy config.RestartPolicy, info *ExitInfo) bool {
+	switch policy {
+	case config.RestartAlways:
+		return true
+	case config.RestartNever:
+		return false
+	default:
+		return info == nil || info.ExitCode != 0 || info.Signal != ""
+	}
+}
+
+// restartBackoff 计算第attempt次重启前的等待时间：按指数增长并加入随机抖动，避免多个实例同时重启
+func restartBackoff(cfg *config.PluginConfig, attempt int) time.Duration {
+	delay := cfg.GetRestartBackoff()
+	maxDelay := cfg.GetMaxRestartBackoff()
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+
+	// 在[delay/2, delay]之间随机取值
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// recordCrashLocked 记录一次崩溃并返回下次重启前的等待时间，调用方需持有pp.Mutex
+// 统计窗口内的崩溃次数达到阈值时进入降级状态，并启动后台恢复协程
+func (pp *PluginPool) recordCrashLocked(reason string) time.Duration {
+	now := time.Now()
+	window := pp.Config.GetCrashLoopWindow()
+
+	recent := pp.crashTimes[:0]
+	for _, t := range pp.crashTimes {
+		if now.Sub(t) < window {
+			recent = append(recent, t)
+		}
+	}
+	pp.crashTimes = append(recent, now)
+	pp.lastCrash = reason
+
+	if len(pp.crashTimes) >= pp.Config.GetCrashLoopThreshold() && pp.state == PoolStateRunning {
+		pp.state = PoolStateDegraded
+		pp.degradedSince = now
+
+		pp.background.Add(1)
+		go pp.recoverLoop()
+	}
+
+	return restartBackoff(pp.Config, len(pp.crashTimes))
+}
+
+// scheduleRestartLocked 等待delay后补充实例，启动失败时按退避时间继续重试，调用方需持有pp.Mutex
+func (pp *PluginPool) scheduleRestartLocked(delay time.Duration) {
+	pp.nextRestart = time.Now().Add(delay)
+
+	pp.background.Add(1)
+	go func() {
+		defer pp.background.Done()
+
+		if !pp.sleep(delay) {
+			return
+		}
+
+		err := pp.replenish()
+		if err == nil {
+			return
+		}
+
+		pp.Mutex.Lock()
+		defer pp.Mutex.Unlock()
+		if !pp.IsRunning {
+			return
+		}
+		next := pp.recordCrashLocked(fmt.Sprintf("启动替换实例失败: %v", err))
+		if pp.state == PoolStateRunning {
+			pp.scheduleRestartLocked(next)
+		}
+	}()
+}
+
+// recoverLoop 降级状态下的后台恢复协程：按较长的间隔尝试启动一个实例，成功后恢复正常状态
+func (pp *PluginPool) recoverLoop() {
+	defer pp.background.Done()
+
+	for {
+		if !pp.sleep(pp.Config.GetDegradedRetryInterval()) {
+			return
+		}
+
+		_, err := pp.createNewInstance(false)
+
+		pp.Mutex.Lock()
+		if !pp.IsRunning {
+			pp.Mutex.Unlock()
+			return
+		}
+		if err != nil {
+			pp.recordCrashLocked(fmt.Sprintf("降级状态下启动实例失败: %v", err))
+			pp.Mutex.Unlock()
+			continue
+		}
+		pp.state = PoolStateRunning
+		pp.degradedSince = time.Time{}
+		pp.Mutex.Unlock()
+
+		pp.replenish()
+		return
+	}
+}
+
+// sleep 等待指定时间，插件池停止时提前返回false
+func (pp *PluginPool) sleep(delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-pp.stopCh:
+		return false
+	}
+}
+
+// checkDegraded 降级状态下直接返回错误，避免调用方等待注定失败的实例
+func (pp *PluginPool) checkDegraded() error {
+	pp.Mutex.RLock()
+	defer pp.Mutex.RUnlock()
+
+	if pp.state != PoolStateDegraded {
+		return nil
+	}
+	return fmt.Errorf("%w: 插件池 %s 自 %s 起频繁崩溃，最近一次: %s",
+		ErrPoolDegraded, pp.PluginName, pp.degradedSince.Format(time.RFC3339), pp.lastCrash)
+}
+
+// restartStatusLocked 重启相关的状态输出，调用方需持有pp.Mutex
+func (pp *PluginPool) restartStatusLocked() map[string]interface{} {
+	window := pp.Config.GetCrashLoopWindow()
+	recent := 0
+	for _, t := range pp.crashTimes {
+		if time.Since(t) < window {
+			recent++
+		}
+	}
+
+	status := map[string]interface{}{
+		"policy":         string(pp.Config.GetRestartPolicy()),
+		"recent_crashes": recent,
+		"threshold":      pp.Config.GetCrashLoopThreshold(),
+	}
+	if pp.lastCrash != "" {
+		status["last_crash"] = pp.lastCrash
+	}
+	if !pp.degradedSince.IsZero() {
+		status["degraded_since"] = pp.degradedSince.Format(time.RFC3339)
+	}
+	if pp.nextRestart.After(time.Now()) {
+		status["next_restart"] = pp.nextRestart.Format(time.RFC3339)
+	}
+	return status
+}
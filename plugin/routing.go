@@ -0,0 +1,121 @@
+package plugin
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"strconv"
+)
+
+// ringReplicas 每个实例在哈希环上的虚拟节点数，虚拟节点越多键的分布越均匀
+const ringReplicas = 64
+
+// ringPoint 哈希环上的一个虚拟节点
+type ringPoint struct {
+	hash uint32
+	id   string // 实例ID
+}
+
+// hashRing 一致性哈希环
+// 实例加入或移除时只有落在其虚拟节点上的键会改变归属，其余键仍路由到原来的实例
+type hashRing struct {
+	points []ringPoint // 按哈希值排序
+}
+
+// ringHash 计算哈希值
+// 虚拟节点名只有末尾序号不同，使用MD5保证其在环上分布均匀
+func ringHash(key string) uint32 {
+	sum := md5.Sum([]byte(key))
+	return binary.BigEndian.Uint32(sum[:4])
+}
+
+// add 加入实例
+func (r *hashRing) add(id string) {
+	for i := 0; i < ringReplicas; i++ {
+		r.points = append(r.points, ringPoint{hash: ringHash(id + "#" + strconv.Itoa(i)), id: id})
+	}
+	sort.Slice(r.points, func(i, j int) bool {
+		if r.points[i].hash == r.points[j].hash {
+			return r.points[i].id < r.points[j].id
+		}
+		return r.points[i].hash < r.points[j].hash
+	})
+}
+
+// remove 移除实例
+func (r *hashRing) remove(id string) {
+	points := r.points[:0]
+	for _, point := range r.points {
+		if point.id != id {
+			points = append(points, point)
+		}
+	}
+	r.points = points
+}
+
+// owners 按环上顺序返回键的候选实例ID，第一个为键的归属实例，其后为归属实例失效时依次接替的实例
+func (r *hashRing) owners(key string) []string {
+	if len(r.points) == 0 {
+		return nil
+	}
+
+	hash := ringHash(key)
+	start := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i].hash >= hash
+	})
+
+	seen := make(map[string]bool)
+	owners := make([]string, 0)
+	for i := 0; i < len(r.points); i++ {
+		id := r.points[(start+i)%len(r.points)].id
+		if !seen[id] {
+			seen[id] = true
+			owners = append(owners, id)
+		}
+	}
+	return owners
+}
+
+// routeOwner 键当前路由到的实例：环上第一个可用的实例，没有可用实例时返回nil
+func (pp *PluginPool) routeOwner(routingKey string) *PluginInstance {
+	pp.Mutex.RLock()
+	owners := pp.ring.owners(routingKey)
+	candidates := make([]*PluginInstance, 0, len(owners))
+	for _, id := range owners {
+		if instance, exists := pp.Instances[id]; exists {
+			candidates = append(candidates, instance)
+		}
+	}
+	pp.Mutex.RUnlock()
+
+	for _, instance := range candidates {
+		if pp.isUsable(instance) {
+			return instance
+		}
+	}
+	return nil
+}
+
+// acquireRouted 获取路由键归属实例的槽位，归属实例忙碌时排队等待该实例，不会分配给其他实例
+// 没有可用实例时routed为false，由调用方按普通方式获取实例
+func (pp *PluginPool) acquireRouted(ctx context.Context, routingKey string, priority Priority) (instance *PluginInstance, routed bool, err error) {
+	for {
+		owner := pp.routeOwner(routingKey)
+		if owner == nil {
+			return nil, false, nil
+		}
+
+		if instance, ok := pp.slots.tryGet(pp.isUsable, owner, priority); ok {
+			return instance, true, nil
+		}
+
+		instance, err := pp.waitForSlot(ctx, owner, priority)
+		if errors.Is(err, errRouteLost) {
+			// 归属实例在等待期间失效，重新路由到接替的实例
+			continue
+		}
+		return instance, true, err
+	}
+}
@@ -0,0 +1,153 @@
+package plugin
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// ringOf 按顺序加入实例构造哈希环
+func ringOf(ids ...string) *hashRing {
+	ring := &hashRing{}
+	for _, id := range ids {
+		ring.add(id)
+	}
+	return ring
+}
+
+// routingKeys 测试用的路由键
+func routingKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("user-%d", i)
+	}
+	return keys
+}
+
+// ownersOf 记录每个键当前的候选实例
+func ownersOf(ring *hashRing, keys []string) map[string][]string {
+	owners := make(map[string][]string, len(keys))
+	for _, key := range keys {
+		owners[key] = ring.owners(key)
+	}
+	return owners
+}
+
+func TestHashRingGrow(t *testing.T) {
+	keys := routingKeys(2000)
+	ids := []string{"a", "b"}
+	ring := ringOf(ids...)
+
+	// 实例数从n增加到n+1时，只有约1/(n+1)的键改变归属，且都移到新加入的实例
+	for _, id := range []string{"c", "d", "e", "f", "g", "h"} {
+		before := ownersOf(ring, keys)
+		ring.add(id)
+		ids = append(ids, id)
+
+		moved := 0
+		for _, key := range keys {
+			oldOwner, newOwner := before[key][0], ring.owners(key)[0]
+			if oldOwner == newOwner {
+				continue
+			}
+			if newOwner != id {
+				t.Fatalf("加入实例 %s 后键 %s 从 %s 移到了 %s", id, key, oldOwner, newOwner)
+			}
+			moved++
+		}
+
+		want := 1 / float64(len(ids))
+		if fraction := float64(moved) / float64(len(keys)); fraction < want/2 || fraction > want*1.5 {
+			t.Errorf("实例数增加到 %d 时 %.1f%% 的键改变归属，期望约 %.1f%%", len(ids), fraction*100, want*100)
+		}
+	}
+}
+
+func TestHashRingShrink(t *testing.T) {
+	keys := routingKeys(2000)
+	ring := ringOf("a", "b", "c", "d", "e")
+
+	// 移除实例时只有它负责的键改变归属，由原来的下一个候选实例接替
+	for _, id := range []string{"c", "a", "e", "b"} {
+		before := ownersOf(ring, keys)
+		ring.remove(id)
+
+		for _, key := range keys {
+			owners := ring.owners(key)
+			if before[key][0] != id {
+				if owners[0] != before[key][0] {
+					t.Fatalf("移除实例 %s 后键 %s 从 %s 移到了 %s", id, key, before[key][0], owners[0])
+				}
+				continue
+			}
+			if owners[0] != before[key][1] {
+				t.Fatalf("实例 %s 被移除后键 %s 由 %s 接替，期望 %s", id, key, owners[0], before[key][1])
+			}
+		}
+	}
+
+	// 只剩一个实例时所有键都归它
+	for _, key := range keys {
+		if owners := ring.owners(key); len(owners) != 1 || owners[0] != "d" {
+			t.Fatalf("键 %s 的候选实例 = %v, 期望 [d]", key, owners)
+		}
+	}
+}
+
+func TestHashRingOwners(t *testing.T) {
+	tests := []struct {
+		name string
+		ids  []string
+	}{
+		{name: "单个实例", ids: []string{"a"}},
+		{name: "多个实例", ids: []string{"a", "b", "c", "d", "e"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ring := ringOf(tt.ids...)
+			reversed := make([]string, len(tt.ids))
+			for i, id := range tt.ids {
+				reversed[len(tt.ids)-1-i] = id
+			}
+			other := ringOf(reversed...)
+
+			counts := make(map[string]int)
+			for _, key := range routingKeys(1000) {
+				owners := ring.owners(key)
+				if len(owners) != len(tt.ids) {
+					t.Fatalf("键 %s 的候选实例 %v 应包含全部 %d 个实例且不重复", key, owners, len(tt.ids))
+				}
+				seen := make(map[string]bool)
+				for _, id := range owners {
+					if seen[id] {
+						t.Fatalf("键 %s 的候选实例 %v 有重复", key, owners)
+					}
+					seen[id] = true
+				}
+				if !reflect.DeepEqual(owners, ring.owners(key)) {
+					t.Fatalf("键 %s 两次查询的结果不同", key)
+				}
+				if !reflect.DeepEqual(owners, other.owners(key)) {
+					t.Fatalf("键 %s 的结果与实例加入顺序有关: %v != %v", key, owners, other.owners(key))
+				}
+				counts[owners[0]]++
+			}
+
+			// 每个实例至少分到平均值一半的键
+			for _, id := range tt.ids {
+				if counts[id] < 1000/len(tt.ids)/2 {
+					t.Errorf("实例 %s 只分到 %d 个键: %v", id, counts[id], counts)
+				}
+			}
+		})
+	}
+}
+
+func TestHashRingEmpty(t *testing.T) {
+	ring := ringOf("a")
+	ring.remove("a")
+	if owners := ring.owners("key"); owners != nil {
+		t.Errorf("空哈希环返回 %v, 期望nil", owners)
+	}
+}
@@ -0,0 +1,286 @@
+package plugin
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/hoonfeng/goproc/config"
+)
+
+// scaleInterval 扩缩容协程的评估间隔
+const scaleInterval = time.Second
+
+// PoolMetrics 插件池负载指标，供扩缩容策略决策
+type PoolMetrics struct {
+	Instances        int           // 已启动的实例数
+	Starting         int           // 正在启动的实例数
+	MinInstances     int           // 最少实例数
+	MaxInstances     int           // 最大实例数
+	SlotsPerInstance int           // 单个实例的并发槽位数
+	InFlight         int           // 在途调用数
+	Waiting          int           // 正在等待可用实例的调用数
+	Utilization      float64       // 槽位利用率：在途调用数 / 全部槽位数
+	AvgWait          time.Duration // 上个评估周期内获取实例的平均等待时间
+}
+
+// ScalingPolicy 扩缩容策略
+// 扩缩容协程定期调用Desired，插件池在后台启动或回收实例，使实例数接近期望值
+// Desired只会被扩缩容协程串行调用，实现可以保存状态
+type ScalingPolicy interface {
+	Desired(metrics PoolMetrics) int // 期望的实例数，结果会被限制在[MinInstances, MaxInstances]范围内
+}
+
+// TargetUtilizationPolicy 按目标利用率扩缩容的默认策略
+// 扩容立即生效并额外保留WarmSpares个空闲实例；缩容需要期望值持续低于当前实例数ScaleDownDelay后才执行，
+// 且每次只回收一个实例，避免负载波动时反复启停进程
+type TargetUtilizationPolicy struct {
+	TargetUtilization float64       // 目标槽位利用率，超过时扩容
+	WarmSpares        int           // 额外保留的空闲实例数
+	MaxWait           time.Duration // 平均等待时间超过该值时至少扩容一个实例
+	ScaleDownDelay    time.Duration // 缩容前需要持续低负载的时间
+
+	belowSince time.Time // 期望值开始低于当前实例数的时间
+}
+
+// NewTargetUtilizationPolicy 根据插件配置创建默认扩缩容策略
+func NewTargetUtilizationPolicy(cfg *config.PluginConfig) *TargetUtilizationPolicy {
+	return &TargetUtilizationPolicy{
+		TargetUtilization: cfg.GetTargetUtilization(),
+		WarmSpares:        cfg.WarmSpares,
+		MaxWait:           10 * time.Millisecond,
+		ScaleDownDelay:    cfg.GetScaleDownDelay(),
+	}
+}
+
+// Desired 计算期望的实例数
+func (p *TargetUtilizationPolicy) Desired(metrics PoolMetrics) int {
+	current := metrics.Instances + metrics.Starting
+
+	// 按目标利用率计算承载当前负载所需的实例数，再加上空闲备用实例
+	capacity := float64(metrics.SlotsPerInstance) * p.TargetUtilization
+	if capacity <= 0 {
+		capacity = 1
+	}
+	demand := float64(metrics.InFlight + metrics.Waiting)
+	desired := int(math.Ceil(demand/capacity)) + p.WarmSpares
+
+	// 调用方已经在排队，说明扩容落后于负载
+	if metrics.AvgWait > p.MaxWait && desired <= current {
+		desired = current + 1
+	}
+
+	if desired >= current {
+		p.belowSince = time.Time{}
+		return desired
+	}
+
+	// 缩容滞后：持续低负载一段时间后才逐个回收
+	now := time.Now()
+	if p.belowSince.IsZero() {
+		p.belowSince = now
+	}
+	if now.Sub(p.belowSince) < p.ScaleDownDelay {
+		return current
+	}
+	p.belowSince = now
+	return current - 1
+}
+
+// superviseScaling 扩缩容协程：定期或在调用方等待时评估负载并调整实例数
+func (pp *PluginPool) superviseScaling(policy ScalingPolicy) {
+	defer pp.background.Done()
+
+	ticker := time.NewTicker(scaleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-pp.stopCh:
+			return
+		case <-ticker.C:
+		case <-pp.scaleKick:
+		}
+		pp.scale(policy)
+	}
+}
+
+// kickScaler 通知扩缩容协程立即评估，不阻塞调用方
+func (pp *PluginPool) kickScaler() {
+	select {
+	case pp.scaleKick <- struct{}{}:
+	default:
+	}
+}
+
+// collectMetrics 收集负载指标，并重置等待时间统计
+func (pp *PluginPool) collectMetrics() PoolMetrics {
+	pp.Mutex.RLock()
+	instances := make([]*PluginInstance, 0, len(pp.Instances))
+	for _, instance := range pp.Instances {
+		instances = append(instances, instance)
+	}
+	starting := pp.starting
+	slotsPerInstance := pp.concurrency
+	pp.Mutex.RUnlock()
+
+	metrics := PoolMetrics{
+		Instances:        len(instances),
+		Starting:         starting,
+		MinInstances:     pp.Config.GetMinInstances(),
+		MaxInstances:     pp.MaxInstances,
+		SlotsPerInstance: slotsPerInstance,
+		Waiting:          pp.slots.depth(),
+	}
+
+	slots := 0
+	for _, instance := range instances {
+		metrics.InFlight += int(atomic.LoadInt64(&instance.inFlight))
+		slots += instance.Concurrency()
+	}
+	if slots > 0 {
+		metrics.Utilization = float64(metrics.InFlight) / float64(slots)
+	}
+
+	waitCount := atomic.SwapInt64(&pp.waitCount, 0)
+	waitTotal := atomic.SwapInt64(&pp.waitTotal, 0)
+	if waitCount > 0 {
+		metrics.AvgWait = time.Duration(waitTotal / waitCount)
+	}
+
+	return metrics
+}
+
+// scale 评估一次负载：不足时在后台启动实例，过多时回收最久未使用的空闲实例
+func (pp *PluginPool) scale(policy ScalingPolicy) {
+	pp.Mutex.RLock()
+	active := pp.IsRunning && pp.state == PoolStateRunning
+	pp.Mutex.RUnlock()
+	if !active {
+		return
+	}
+
+	metrics := pp.collectMetrics()
+	desired := policy.Desired(metrics)
+	if desired < metrics.MinInstances {
+		desired = metrics.MinInstances
+	}
+	if desired > metrics.MaxInstances {
+		desired = metrics.MaxInstances
+	}
+
+	pp.Mutex.Lock()
+	pp.lastMetrics = metrics
+	pp.desired = desired
+	pp.Mutex.Unlock()
+
+	current := metrics.Instances + metrics.Starting
+	switch {
+	case desired > current:
+		pp.scaleUp(desired - current)
+	case desired < metrics.Instances:
+		pp.scaleDown(metrics.Instances - desired)
+	}
+}
+
+// scaleUp 在后台启动count个实例
+// 上一批启动尚未结束时不再发起，避免重复扩容；启动失败后按重启退避等待，避免反复启动无法运行的插件
+func (pp *PluginPool) scaleUp(count int) {
+	pp.Mutex.Lock()
+	if pp.scalePending > 0 || time.Now().Before(pp.scaleRetryAt) {
+		pp.Mutex.Unlock()
+		return
+	}
+	pp.scalePending += count
+	pp.Mutex.Unlock()
+
+	for i := 0; i < count; i++ {
+		pp.background.Add(1)
+		go func() {
+			defer pp.background.Done()
+			_, err := pp.createNewInstance(false)
+
+			pp.Mutex.Lock()
+			defer pp.Mutex.Unlock()
+			pp.scalePending--
+			switch {
+			case err == nil:
+				pp.scaleFailures = 0
+				pp.scaleRetryAt = time.Time{}
+			case !errors.Is(err, ErrPoolExhausted):
+				// 达到最大实例数不算启动失败
+				pp.scaleFailures++
+				pp.scaleRetryAt = time.Now().Add(restartBackoff(pp.Config, pp.scaleFailures))
+			}
+		}()
+	}
+}
+
+// scaleDown 回收count个最久未使用的空闲实例
+func (pp *PluginPool) scaleDown(count int) {
+	pp.Mutex.RLock()
+	instances := make([]*PluginInstance, 0, len(pp.Instances))
+	for _, instance := range pp.Instances {
+		if instance.isIdle() {
+			instances = append(instances, instance)
+		}
+	}
+	pp.Mutex.RUnlock()
+
+	lastUsed := make(map[string]time.Time, len(instances))
+	for _, instance := range instances {
+		instance.Mutex.RLock()
+		lastUsed[instance.ID] = instance.LastUsed
+		instance.Mutex.RUnlock()
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		return lastUsed[instances[i].ID].Before(lastUsed[instances[j].ID])
+	})
+
+	minInstances := pp.Config.GetMinInstances()
+	for _, instance := range instances {
+		if count == 0 {
+			return
+		}
+
+		pp.Mutex.Lock()
+		_, exists := pp.Instances[instance.ID]
+		if !exists || len(pp.Instances) <= minInstances {
+			pp.Mutex.Unlock()
+			continue
+		}
+		delete(pp.Instances, instance.ID)
+		pp.ring.remove(instance.ID)
+		pp.scaledDownCount++
+		pp.Mutex.Unlock()
+
+		pp.background.Add(1)
+		go func(instance *PluginInstance) {
+			defer pp.background.Done()
+			pp.retireInstance(instance)
+		}(instance)
+		count--
+	}
+}
+
+// scalingStatusLocked 扩缩容相关的状态输出，调用方需持有pp.Mutex
+func (pp *PluginPool) scalingStatusLocked() map[string]interface{} {
+	if pp.ScalingPolicy == nil {
+		return nil
+	}
+	status := map[string]interface{}{
+		"desired":     pp.desired,
+		"starting":    pp.starting,
+		"utilization": pp.lastMetrics.Utilization,
+		"in_flight":   pp.lastMetrics.InFlight,
+		"waiting":     pp.slots.depth(),
+		"avg_wait_ms": float64(pp.lastMetrics.AvgWait.Microseconds()) / 1000,
+		"scaled_down": pp.scaledDownCount,
+	}
+	if pp.scaleRetryAt.After(time.Now()) {
+		status["next_scale_up"] = pp.scaleRetryAt.Format(time.RFC3339)
+	}
+	return status
+}
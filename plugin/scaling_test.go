@@ -0,0 +1,96 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hoonfeng/goproc/config"
+)
+
+// fixedPolicy 固定期望实例数的扩缩容策略
+type fixedPolicy int
+
+func (p fixedPolicy) Desired(PoolMetrics) int { return int(p) }
+
+// waitScaleIdle 等待扩缩容协程发起的启动全部结束
+func waitScaleIdle(t *testing.T, pool *PluginPool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		pool.Mutex.RLock()
+		pending := pool.scalePending
+		pool.Mutex.RUnlock()
+		if pending == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("仍有 %d 个启动未结束", pending)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestScaleUpBackoff(t *testing.T) {
+	// 可执行文件不存在，每次启动都会失败
+	pool := NewPluginPool("test", &config.PluginConfig{
+		Type:           config.PluginTypeBinary,
+		Path:           "/nonexistent/goproc-plugin",
+		MaxInstances:   3,
+		RestartBackoff: 200 * time.Millisecond,
+	})
+	pool.IsRunning = true
+	pool.state = PoolStateRunning
+	defer pool.background.Wait()
+
+	pool.scale(fixedPolicy(3))
+	waitScaleIdle(t, pool)
+
+	pool.Mutex.RLock()
+	failures, retryAt := pool.scaleFailures, pool.scaleRetryAt
+	pool.Mutex.RUnlock()
+	if failures != 3 {
+		t.Fatalf("连续启动失败 %d 次, 期望 3", failures)
+	}
+	// 第3次失败的退避在[400ms, 800ms]之间
+	if wait := time.Until(retryAt); wait < 300*time.Millisecond || wait > 800*time.Millisecond {
+		t.Fatalf("下次扩容在 %s 后, 期望按第3次重启的退避等待", wait)
+	}
+
+	// 退避期间的评估不再发起启动
+	for i := 0; i < 5; i++ {
+		pool.scale(fixedPolicy(3))
+		pool.Mutex.RLock()
+		pending := pool.scalePending
+		pool.Mutex.RUnlock()
+		if pending != 0 {
+			t.Fatalf("退避期间发起了 %d 个启动", pending)
+		}
+	}
+
+	// 退避结束后再次尝试
+	time.Sleep(time.Until(retryAt))
+	pool.scale(fixedPolicy(3))
+	waitScaleIdle(t, pool)
+	pool.Mutex.RLock()
+	failures = pool.scaleFailures
+	pool.Mutex.RUnlock()
+	if failures != 6 {
+		t.Fatalf("退避结束后连续失败 %d 次, 期望 6", failures)
+	}
+}
+
+func TestScaleUpPending(t *testing.T) {
+	pool := NewPluginPool("test", &config.PluginConfig{MaxInstances: 3})
+	pool.IsRunning = true
+	pool.state = PoolStateRunning
+
+	// 上一批启动尚未结束时，重复的评估不再发起启动
+	pool.scalePending = 1
+	pool.scale(fixedPolicy(3))
+	pool.Mutex.RLock()
+	pending := pool.scalePending
+	pool.Mutex.RUnlock()
+	if pending != 1 {
+		t.Fatalf("正在启动时又发起了 %d 个启动", pending-1)
+	}
+}
@@ -0,0 +1,147 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/hoonfeng/goproc/sdk"
+)
+
+// defaultStreamWindow 流式调用的默认额度：插件在未收到确认前最多可发送的数据块数
+const defaultStreamWindow = 16
+
+// Stream 流式调用结果
+// 通过Recv按顺序读取数据块，流正常结束时Recv返回io.EOF
+type Stream struct {
+	ctx       context.Context
+	instance  *PluginInstance
+	messageID string
+	function  string
+	call      *pendingCall
+
+	mutex    sync.Mutex
+	consumed int   // 已消费但尚未归还的额度
+	finished bool  // 流已结束
+	err      error // 流结束的原因
+	onDone   func()
+}
+
+// newStream 创建流式调用结果
+func newStream(ctx context.Context, instance *PluginInstance, messageID string, functionName string, call *pendingCall, onDone func()) *Stream {
+	return &Stream{
+		ctx:       ctx,
+		instance:  instance,
+		messageID: messageID,
+		function:  functionName,
+		call:      call,
+		onDone:    onDone,
+	}
+}
+
+// Recv 读取下一个数据块，流正常结束时返回io.EOF
+func (s *Stream) Recv() (interface{}, error) {
+	s.mutex.Lock()
+	if s.finished {
+		err := s.err
+		s.mutex.Unlock()
+		return nil, err
+	}
+	s.mutex.Unlock()
+
+	select {
+	case msg, ok := <-s.call.ch:
+		if !ok {
+			if s.call.err != nil {
+				return nil, s.finish(s.call.err)
+			}
+			return nil, s.finish(fmt.Errorf("接收数据块失败: %w: 插件实例 %s 连接已断开", ErrInstanceCrashed, s.instance.ID))
+		}
+
+		switch msg.Type {
+		case sdk.MessageTypeStreamChunk:
+			s.ack()
+			return msg.Result, nil
+		case sdk.MessageTypeStreamEnd:
+			return nil, s.finish(io.EOF)
+		case sdk.MessageTypeResult:
+			// 插件以普通结果响应（不支持流式的插件或普通函数），作为唯一的数据块返回
+			s.finish(io.EOF)
+			return msg.Result, nil
+		case sdk.MessageTypeError:
+			return nil, s.finish(newRemoteError(s.instance.ID, s.function, msg))
+		default:
+			return nil, s.finish(fmt.Errorf("收到未知的响应类型: %s", msg.Type))
+		}
+	case <-s.ctx.Done():
+		s.cancel()
+		if s.ctx.Err() == context.DeadlineExceeded {
+			return nil, s.finish(fmt.Errorf("%w: %w", ErrTimeout, s.ctx.Err()))
+		}
+		return nil, s.finish(fmt.Errorf("调用已取消: %w", s.ctx.Err()))
+	}
+}
+
+// Close 关闭流，流尚未结束时通知插件取消调用
+func (s *Stream) Close() error {
+	s.mutex.Lock()
+	finished := s.finished
+	s.mutex.Unlock()
+
+	if !finished {
+		s.cancel()
+		s.finish(fmt.Errorf("流已关闭: %w", context.Canceled))
+	}
+	return nil
+}
+
+// ack 归还额度，攒够半个窗口再发送，减少确认消息的数量
+func (s *Stream) ack() {
+	s.mutex.Lock()
+	s.consumed++
+	credit := 0
+	if s.consumed >= defaultStreamWindow/2 {
+		credit = s.consumed
+		s.consumed = 0
+	}
+	s.mutex.Unlock()
+
+	if credit > 0 {
+		s.instance.sendMessage(&sdk.Message{
+			Type:   sdk.MessageTypeStreamAck,
+			ID:     s.messageID,
+			Credit: credit,
+		})
+	}
+}
+
+// cancel 通知插件取消调用
+func (s *Stream) cancel() {
+	if !s.instance.HasCapability(sdk.CapabilityCancel) {
+		return
+	}
+	s.instance.sendMessage(&sdk.Message{
+		Type: sdk.MessageTypeCancel,
+		ID:   s.messageID,
+	})
+}
+
+// finish 结束流并释放资源，只有第一次调用生效，返回流结束的原因
+func (s *Stream) finish(err error) error {
+	s.mutex.Lock()
+	if s.finished {
+		err = s.err
+		s.mutex.Unlock()
+		return err
+	}
+	s.finished = true
+	s.err = err
+	onDone := s.onDone
+	s.mutex.Unlock()
+
+	if onDone != nil {
+		onDone()
+	}
+	return err
+}
@@ -0,0 +1,161 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hoonfeng/goproc/config"
+	"github.com/hoonfeng/goproc/sdk"
+)
+
+// expectNothing 确认实例在一段时间内没有向插件发送任何消息
+func (p *fakePlugin) expectNothing(d time.Duration) {
+	p.t.Helper()
+
+	p.conn.SetReadDeadline(time.Now().Add(d))
+	data, err := sdk.ReadFrame(p.conn, sdk.DefaultMaxFrameSize)
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		p.t.Fatalf("期望没有消息，实际读取到 (%q, %v)", data, err)
+	}
+}
+
+// sendChunks 插件发送n个序号从first开始的数据块
+func (p *fakePlugin) sendChunks(id string, first, n int) {
+	p.t.Helper()
+
+	for i := first; i < first+n; i++ {
+		p.send(&sdk.Message{Type: sdk.MessageTypeStreamChunk, ID: id, Result: i})
+	}
+}
+
+// startStream 发起流式调用并返回插件收到的调用消息，调用消息经net.Pipe同步写出，需要插件端同时读取
+func startStream(t *testing.T, instance *PluginInstance, plugin *fakePlugin) (*Stream, *sdk.Message) {
+	t.Helper()
+
+	type started struct {
+		stream *Stream
+		err    error
+	}
+	done := make(chan started, 1)
+	go func() {
+		stream, err := instance.CallStreamContext(context.Background(), "echo", nil, nil)
+		done <- started{stream, err}
+	}()
+	call := plugin.receive()
+	result := <-done
+	if result.err != nil {
+		t.Fatalf("发起流式调用失败: %v", result.err)
+	}
+	return result.stream, call
+}
+
+func TestStreamCredit(t *testing.T) {
+	instance, plugin := newPipeInstance(t, &config.PluginConfig{}, sdk.CapabilityMultiplex, sdk.CapabilityStreaming)
+
+	stream, call := startStream(t, instance, plugin)
+	if !call.Stream || call.Credit != defaultStreamWindow {
+		t.Fatalf("调用消息 Stream = %v, Credit = %d, 期望以 %d 的额度流式调用", call.Stream, call.Credit, defaultStreamWindow)
+	}
+
+	// recvChunks 调用方在另一个协程中依次取走n个数据块：归还额度的确认经net.Pipe同步写出，
+	// 插件端读取之前Recv会阻塞
+	next := 0
+	recvChunks := func(n int) <-chan error {
+		done := make(chan error, 1)
+		go func() {
+			for i := 0; i < n; i++ {
+				chunk, err := stream.Recv()
+				if err != nil || chunk != float64(next) {
+					done <- fmt.Errorf("Recv = (%v, %v), 期望数据块 %d", chunk, err, next)
+					return
+				}
+				next++
+			}
+			done <- nil
+		}()
+		return done
+	}
+	// expectAck 插件收到归还半个窗口额度的确认
+	expectAck := func() {
+		t.Helper()
+		if ack := plugin.receive(); ack.Type != sdk.MessageTypeStreamAck || ack.ID != call.ID || ack.Credit != defaultStreamWindow/2 {
+			t.Fatalf("收到 %s %s 额度 %d, 期望归还 %d 的额度", ack.Type, ack.ID, ack.Credit, defaultStreamWindow/2)
+		}
+	}
+
+	// 插件用完额度后，调用方取走数据块之前不会归还额度
+	plugin.sendChunks(call.ID, 0, defaultStreamWindow)
+	plugin.expectNothing(50 * time.Millisecond)
+
+	// 取走半个窗口后一次归还，之前不发送确认
+	if err := <-recvChunks(defaultStreamWindow/2 - 1); err != nil {
+		t.Fatal(err)
+	}
+	plugin.expectNothing(50 * time.Millisecond)
+	done := recvChunks(1)
+	expectAck()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// 插件按归还的额度继续发送，流结束后读完剩余数据块
+	plugin.sendChunks(call.ID, defaultStreamWindow, defaultStreamWindow/2)
+	plugin.send(&sdk.Message{Type: sdk.MessageTypeStreamEnd, ID: call.ID})
+	for i := 0; i < 2; i++ {
+		done := recvChunks(defaultStreamWindow / 2)
+		expectAck()
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Fatalf("流结束后 Recv 返回 %v, 期望 io.EOF", err)
+	}
+	if count := instance.pendingCount(); count != 0 {
+		t.Errorf("流结束后等待表中仍有 %d 项", count)
+	}
+}
+
+func TestStreamCreditViolation(t *testing.T) {
+	instance, plugin := newPipeInstance(t, &config.PluginConfig{}, sdk.CapabilityMultiplex, sdk.CapabilityStreaming)
+
+	stream, call := startStream(t, instance, plugin)
+
+	// 超出额度的数据块无处缓冲，流以错误结束，已收到的数据块仍可读取
+	plugin.sendChunks(call.ID, 0, defaultStreamWindow+2)
+
+	// 读取协程按顺序处理消息，收到心跳响应说明之前的数据块都已分发
+	plugin.send(&sdk.Message{Type: sdk.MessageTypePing, ID: "ping"})
+	if pong := plugin.receive(); pong.Type != sdk.MessageTypePong {
+		t.Fatalf("收到 %s, 期望心跳响应", pong.Type)
+	}
+
+	// 调用方取走数据块时会发送确认，插件端持续读取避免阻塞
+	go func() {
+		for {
+			if _, err := sdk.ReadFrame(plugin.conn, sdk.DefaultMaxFrameSize); err != nil {
+				return
+			}
+		}
+	}()
+
+	for i := 0; ; i++ {
+		_, err := stream.Recv()
+		if err == nil {
+			continue
+		}
+		// 等待通道按额度加结束消息留有缓冲，超出的那一个数据块之前的都能读到
+		if i != defaultStreamWindow+1 || errors.Is(err, io.EOF) {
+			t.Fatalf("读取 %d 个数据块后返回 %v, 期望流量控制错误", i, err)
+		}
+		break
+	}
+	if count := instance.pendingCount(); count != 0 {
+		t.Errorf("流结束后等待表中仍有 %d 项", count)
+	}
+}
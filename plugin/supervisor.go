@@ -0,0 +1,152 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ExitInfo 插件进程退出信息
+type ExitInfo struct {
+	Time      time.Time // 退出时间
+	ExitCode  int       // 退出码，被信号终止时为-1
+	Signal    string    // 终止进程的信号，正常退出时为空
+	Expected  bool      // 是否由Stop触发
+	OOMKilled bool      // 是否因超出内存上限被OOM终止（仅在cgroup限制生效时可判断）
+}
+
+// String 退出原因描述
+func (e *ExitInfo) String() string {
+	if e == nil {
+		return "未知"
+	}
+	if e.OOMKilled {
+		return "因超出内存上限被OOM终止"
+	}
+	if e.Signal != "" {
+		return fmt.Sprintf("被信号 %s 终止", e.Signal)
+	}
+	return fmt.Sprintf("退出码 %d", e.ExitCode)
+}
+
+// newExitInfo 根据进程状态生成退出信息
+func newExitInfo(state *os.ProcessState) *ExitInfo {
+	info := &ExitInfo{Time: time.Now(), ExitCode: -1}
+	if state == nil {
+		return info
+	}
+
+	info.ExitCode = state.ExitCode()
+	if status, ok := state.Sys().(interface {
+		Signaled() bool
+		Signal() syscall.Signal
+	}); ok && status.Signaled() {
+		info.Signal = status.Signal().String()
+	}
+	return info
+}
+
+// waitProcess 进程监控协程：唯一调用Wait的地方
+// 进程意外退出时立即让在途调用失败，并通知插件池移除和替换该实例；进程退出后终止其进程组并删除cgroup
+func (pi *PluginInstance) waitProcess(cmd *exec.Cmd, exited chan struct{}, limits *processLimits) {
+	cmd.Wait()
+
+	info := newExitInfo(cmd.ProcessState)
+	info.Expected = atomic.LoadInt32(&pi.stopping) != 0
+	info.OOMKilled = limits.oomKilled()
+	// 插件进程退出后终止其遗留在进程组中的子进程，之后才能删除实例的cgroup
+	killProcessGroup(cmd.Process)
+	limits.release()
+	pi.exitInfo = info
+	close(exited)
+
+	if info.Expected {
+		return
+	}
+
+	pi.Mutex.Lock()
+	wasRunning := pi.IsRunning
+	pi.IsRunning = false
+	pi.IsConnected = false
+	pi.IsHealthy = false
+	conn := pi.Conn
+	onExit := pi.onExit
+	pi.Mutex.Unlock()
+
+	// 启动阶段退出由Start返回错误，不需要额外处理
+	if !wasRunning {
+		return
+	}
+
+	pi.closePending(fmt.Errorf("%w: 插件实例 %s 进程%s", ErrInstanceCrashed, pi.ID, info))
+	pi.cancelAllHostCalls()
+	if conn != nil {
+		conn.Close()
+	}
+	pi.Communication.Cleanup(pi.Address)
+
+	if onExit != nil {
+		onExit(pi, info)
+	}
+}
+
+// exitedInfo 获取进程退出信息，进程仍在运行时返回nil
+func (pi *PluginInstance) exitedInfo() *ExitInfo {
+	if pi.exited == nil {
+		return nil
+	}
+	select {
+	case <-pi.exited:
+		return pi.exitInfo
+	default:
+		return nil
+	}
+}
+
+// exitStatus 把进程退出信息转换为状态输出格式
+func exitStatus(info *ExitInfo) map[string]interface{} {
+	if info == nil {
+		return nil
+	}
+	status := map[string]interface{}{
+		"time":      info.Time.Format(time.RFC3339),
+		"exit_code": info.ExitCode,
+		"expected":  info.Expected,
+	}
+	if info.Signal != "" {
+		status["signal"] = info.Signal
+	}
+	if info.OOMKilled {
+		status["oom_killed"] = true
+	}
+	return status
+}
+
+// handleInstanceExit 实例进程意外退出：移除实例，并按重启策略在退避后启动替换实例
+func (pp *PluginPool) handleInstanceExit(instance *PluginInstance, info *ExitInfo) {
+	reason := "进程" + info.String()
+	pp.evictInstance(instance, reason, info)
+
+	// 在持有锁且池仍在运行时登记后台任务，保证Stop能等到替换完成
+	pp.Mutex.Lock()
+	defer pp.Mutex.Unlock()
+	if !pp.IsRunning {
+		return
+	}
+	pp.crashCount++
+	if info.OOMKilled {
+		pp.oomKillCount++
+	}
+
+	if !shouldRestart(pp.Config.GetRestartPolicy(), info) {
+		return
+	}
+
+	delay := pp.recordCrashLocked(reason)
+	if pp.state == PoolStateRunning {
+		pp.scheduleRestartLocked(delay)
+	}
+}
@@ -0,0 +1,80 @@
+package sdk
+
+import (
+	"encoding/json"
+)
+
+// Codec 消息编解码器
+// 注册消息和注册确认消息始终使用JSON，之后双方切换到注册时协商的编解码器
+type Codec interface {
+	Name() string                         // 编解码器名称，用于注册时协商
+	Encode(msg *Message) ([]byte, error)  // 编码消息
+	Decode(data []byte) (*Message, error) // 解码消息
+}
+
+const (
+	CodecJSON    = "json"    // JSON编解码器（默认）
+	CodecMsgpack = "msgpack" // MessagePack编解码器
+)
+
+var (
+	// JSONCodec JSON编解码器，所有SDK都支持
+	JSONCodec Codec = jsonCodec{}
+	// MsgpackCodec MessagePack编解码器，体积更小，解码结果的类型与JSON编解码器相同
+	MsgpackCodec Codec = msgpackCodec{}
+)
+
+// codecs 已支持的编解码器，按优先顺序排列
+var codecs = []Codec{MsgpackCodec, JSONCodec}
+
+// GetCodec 根据名称获取编解码器
+func GetCodec(name string) (Codec, bool) {
+	for _, codec := range codecs {
+		if codec.Name() == name {
+			return codec, true
+		}
+	}
+	return nil, false
+}
+
+// SupportedCodecs 获取支持的编解码器名称，按优先顺序排列
+func SupportedCodecs() []string {
+	names := make([]string, len(codecs))
+	for i, codec := range codecs {
+		names[i] = codec.Name()
+	}
+	return names
+}
+
+// NegotiateCodec 从对端提供的候选列表中选出第一个本端也支持的编解码器
+// 对端未提供候选列表或没有共同支持的编解码器时使用JSON
+func NegotiateCodec(offered []string) Codec {
+	for _, name := range offered {
+		if codec, ok := GetCodec(name); ok {
+			return codec
+		}
+	}
+	return JSONCodec
+}
+
+// jsonCodec JSON编解码器
+type jsonCodec struct{}
+
+// Name 编解码器名称
+func (jsonCodec) Name() string {
+	return CodecJSON
+}
+
+// Encode 编码消息
+func (jsonCodec) Encode(msg *Message) ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+// Decode 解码消息
+func (jsonCodec) Decode(data []byte) (*Message, error) {
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
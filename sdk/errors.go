@@ -0,0 +1,108 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// 错误码，随错误消息发送给主机，主机据此区分错误类型
+const (
+	ErrorCodeUnknown           = "unknown"            // 未知错误（旧版SDK只发送错误字符串）
+	ErrorCodeInternal          = "internal"           // 插件内部错误
+	ErrorCodeInvalidArgument   = "invalid_argument"   // 参数错误
+	ErrorCodeNotFound          = "not_found"          // 请求的资源不存在
+	ErrorCodeFunctionNotFound  = "function_not_found" // 函数不存在
+	ErrorCodeTimeout           = "timeout"            // 调用超时
+	ErrorCodeCanceled          = "canceled"           // 调用被取消
+	ErrorCodeUnavailable       = "unavailable"        // 依赖的服务暂不可用，可重试
+	ErrorCodeResourceExhausted = "resource_exhausted" // 资源耗尽，例如结果超出最大帧大小
+)
+
+// ErrorInfo 结构化错误信息，随错误消息一起发送
+type ErrorInfo struct {
+	Code      string                 `json:"code"`                // 错误码
+	Message   string                 `json:"message"`             // 错误描述
+	Details   map[string]interface{} `json:"details,omitempty"`   // 附加信息
+	Retryable bool                   `json:"retryable,omitempty"` // 是否可以重试
+	Stack     string                 `json:"stack,omitempty"`     // 插件端调用栈（可选）
+}
+
+// Error 带错误码的错误，处理函数返回该类型时错误码和附加信息会原样传给主机
+type Error struct {
+	Code      string                 // 错误码
+	Message   string                 // 错误描述
+	Details   map[string]interface{} // 附加信息
+	Retryable bool                   // 是否可以重试
+	Stack     string                 // 调用栈（可选）
+	Cause     error                  // 原始错误
+}
+
+// NewError 创建带错误码的错误
+func NewError(code string, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Errorf 按格式创建带错误码的错误，格式中的%w会作为原始错误保留
+func Errorf(code string, format string, args ...interface{}) *Error {
+	err := fmt.Errorf(format, args...)
+	return &Error{Code: code, Message: err.Error(), Cause: errors.Unwrap(err)}
+}
+
+// WithDetails 设置附加信息
+func (e *Error) WithDetails(details map[string]interface{}) *Error {
+	e.Details = details
+	return e
+}
+
+// WithRetryable 设置是否可以重试
+func (e *Error) WithRetryable(retryable bool) *Error {
+	e.Retryable = retryable
+	return e
+}
+
+// Error 实现error接口
+func (e *Error) Error() string {
+	return fmt.Sprintf("[%s] %s", e.Code, e.Message)
+}
+
+// Unwrap 返回原始错误
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// ErrorInfoFrom 把处理函数返回的错误转换为结构化错误信息
+// *Error保留错误码和附加信息，ctx超时和取消分别转换为timeout和canceled，其他错误视为internal
+func ErrorInfoFrom(err error) *ErrorInfo {
+	var coded *Error
+	switch {
+	case errors.As(err, &coded):
+		return &ErrorInfo{
+			Code:      coded.Code,
+			Message:   coded.Message,
+			Details:   coded.Details,
+			Retryable: coded.Retryable,
+			Stack:     coded.Stack,
+		}
+	case errors.Is(err, context.DeadlineExceeded):
+		return &ErrorInfo{Code: ErrorCodeTimeout, Message: err.Error(), Retryable: true}
+	case errors.Is(err, context.Canceled):
+		return &ErrorInfo{Code: ErrorCodeCanceled, Message: err.Error()}
+	default:
+		return &ErrorInfo{Code: ErrorCodeInternal, Message: err.Error()}
+	}
+}
+
+// ErrorFromMessage 从错误消息中还原带错误码的错误，兼容只有错误字符串的旧消息
+func ErrorFromMessage(msg *Message) *Error {
+	if msg.ErrorInfo == nil {
+		return &Error{Code: ErrorCodeUnknown, Message: msg.Error}
+	}
+	return &Error{
+		Code:      msg.ErrorInfo.Code,
+		Message:   msg.ErrorInfo.Message,
+		Details:   msg.ErrorInfo.Details,
+		Retryable: msg.ErrorInfo.Retryable,
+		Stack:     msg.ErrorInfo.Stack,
+	}
+}
@@ -0,0 +1,66 @@
+package sdk
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultMaxFrameSize 默认的最大帧大小（16MB）
+// 更大的结果应通过流式调用分块发送
+const DefaultMaxFrameSize = 16 << 20
+
+var (
+	// ErrFrameTooLarge 帧长度超出上限
+	ErrFrameTooLarge = errors.New("帧大小超出限制")
+	// ErrMalformedFrame 帧格式错误（长度为0或内容无法解码）
+	ErrMalformedFrame = errors.New("帧格式错误")
+)
+
+// ReadFrame 读取一个带4字节大端长度前缀的帧
+// 先校验长度再分配内存，maxSize<=0时使用DefaultMaxFrameSize
+func ReadFrame(r io.Reader, maxSize int) ([]byte, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxFrameSize
+	}
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint32(header)
+	if length == 0 {
+		return nil, fmt.Errorf("%w: 长度为0", ErrMalformedFrame)
+	}
+	if uint64(length) > uint64(maxSize) {
+		return nil, fmt.Errorf("%w: %d 字节，上限 %d 字节", ErrFrameTooLarge, length, maxSize)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// WriteFrame 写入一个带4字节大端长度前缀的帧，maxSize<=0时使用DefaultMaxFrameSize
+func WriteFrame(w io.Writer, data []byte, maxSize int) error {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxFrameSize
+	}
+	if len(data) == 0 {
+		return fmt.Errorf("%w: 长度为0", ErrMalformedFrame)
+	}
+	if len(data) > maxSize {
+		return fmt.Errorf("%w: %d 字节，上限 %d 字节", ErrFrameTooLarge, len(data), maxSize)
+	}
+
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+
+	_, err := w.Write(frame)
+	return err
+}
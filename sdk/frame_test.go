@@ -0,0 +1,99 @@
+package sdk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+// frameHeader 构造一个声明长度为length的帧头
+func frameHeader(length uint32) []byte {
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, length)
+	return header
+}
+
+// countingReader 记录被读取的字节数，用于确认超长的帧体没有被读取
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+func TestReadFrame(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []byte
+		maxSize int
+		want    []byte
+		wantErr error
+	}{
+		{name: "完整的帧", input: append(frameHeader(3), "abc"...), maxSize: 16, want: []byte("abc")},
+		{name: "长度等于上限", input: append(frameHeader(4), "abcd"...), maxSize: 4, want: []byte("abcd")},
+		{name: "长度超出上限", input: append(frameHeader(5), "abcde"...), maxSize: 4, wantErr: ErrFrameTooLarge},
+		{name: "长度超出默认上限", input: frameHeader(DefaultMaxFrameSize + 1), wantErr: ErrFrameTooLarge},
+		{name: "长度为最大值", input: frameHeader(0xFFFFFFFF), maxSize: 16, wantErr: ErrFrameTooLarge},
+		{name: "长度为0", input: append(frameHeader(0), "abc"...), maxSize: 16, wantErr: ErrMalformedFrame},
+		{name: "帧体不完整", input: append(frameHeader(10), "abc"...), maxSize: 16, wantErr: io.ErrUnexpectedEOF},
+		{name: "帧头不完整", input: []byte{0, 0}, maxSize: 16, wantErr: io.ErrUnexpectedEOF},
+		{name: "连接已关闭", input: nil, maxSize: 16, wantErr: io.EOF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := &countingReader{r: bytes.NewReader(tt.input)}
+			got, err := ReadFrame(reader, tt.maxSize)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ReadFrame 返回错误 %v, 期望 %v", err, tt.wantErr)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("ReadFrame = %q, 期望 %q", got, tt.want)
+			}
+			// 长度校验失败时只读取了帧头，不会按声明的长度分配和读取
+			if (errors.Is(err, ErrFrameTooLarge) || errors.Is(err, ErrMalformedFrame)) && reader.n != 4 {
+				t.Errorf("长度校验失败后读取了 %d 字节, 期望只读取4字节帧头", reader.n)
+			}
+		})
+	}
+}
+
+func TestWriteFrame(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		maxSize int
+		wantErr error
+	}{
+		{name: "正常写入", data: []byte("abc"), maxSize: 16},
+		{name: "长度超出上限", data: []byte("abcde"), maxSize: 4, wantErr: ErrFrameTooLarge},
+		{name: "空数据", data: nil, maxSize: 16, wantErr: ErrMalformedFrame},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := WriteFrame(&buf, tt.data, tt.maxSize)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("WriteFrame 返回错误 %v, 期望 %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if buf.Len() != 0 {
+					t.Errorf("写入失败时仍写出了 %d 字节", buf.Len())
+				}
+				return
+			}
+
+			got, err := ReadFrame(&buf, tt.maxSize)
+			if err != nil || !bytes.Equal(got, tt.data) {
+				t.Errorf("读回 (%q, %v), 期望 %q", got, err, tt.data)
+			}
+		})
+	}
+}
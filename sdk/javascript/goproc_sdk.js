@@ -35,6 +35,10 @@ const MESSAGE_TYPE_PONG = "pong";
 const MESSAGE_TYPE_REGISTER = "register";
 const MESSAGE_TYPE_STOP = "stop";
 
+// 协议版本与能力（调用以异步方式并发处理，支持多路复用）
+const PROTOCOL_VERSION = 2;
+const CAPABILITIES = ["multiplex"];
+
 class PluginSDK {
     constructor() {
         this.functions = {};
@@ -196,7 +200,8 @@ class PluginSDK {
             const errorMsg = {
                 type: MESSAGE_TYPE_ERROR,
                 id: msgId,
-                error: `函数 ${functionName} 不存在`
+                error: `函数 ${functionName} 不存在`,
+                error_info: { code: 'function_not_found', message: `函数 ${functionName} 不存在` }
             };
             //console.log(`[SDK] 函数不存在: ${functionName}`);
             this.sendMessage(errorMsg);
@@ -380,6 +385,8 @@ class PluginSDK {
                         
                         server.listen(address, () => {
                             //console.log(`Unix域套接字服务器正在监听: ${address}`);
+                            // 通知主机监听器已创建，主机收到后立即连接
+                            this.signalReady();
                         });
                         
                         server.on('error', (error) => {
@@ -395,13 +402,30 @@ class PluginSDK {
             });
     }
 
+    // 向GOPROC_READY_FD指向的就绪管道写入一个字节并关闭，未设置时不做任何事
+    signalReady() {
+        const fd = parseInt(process.env.GOPROC_READY_FD, 10);
+        delete process.env.GOPROC_READY_FD;
+        if (!(fd >= 3)) {
+            return;
+        }
+        try {
+            fs.writeSync(fd, Buffer.from([1]));
+            fs.closeSync(fd);
+        } catch (error) {
+            // 主机不等待就绪信号时忽略
+        }
+    }
+
     sendRegisterMessage() {
         const functionNames = Object.keys(this.functions);
         
         const registerMsg = {
             type: MESSAGE_TYPE_REGISTER,
             params: {
-                functions: functionNames
+                functions: functionNames,
+                protocol_version: PROTOCOL_VERSION,
+                capabilities: CAPABILITIES
             }
         };
         
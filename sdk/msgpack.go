@@ -0,0 +1,686 @@
+package sdk
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// msgpackCodec MessagePack编解码器
+// 消息按JSON标签编码为键值表，与JSON编码的字段名一致。解码结果的类型与JSON编解码器相同：
+// 数字为float64，二进制数据为base64字符串，数组为[]interface{}，键值表为map[string]interface{}，
+// 切换编解码器不会改变插件和主机收到的参数类型
+type msgpackCodec struct{}
+
+// Name 编解码器名称
+func (msgpackCodec) Name() string {
+	return CodecMsgpack
+}
+
+// Encode 编码消息
+func (msgpackCodec) Encode(msg *Message) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := msgpackEncodeStruct(&buf, reflect.ValueOf(msg).Elem()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode 解码消息
+func (msgpackCodec) Decode(data []byte) (*Message, error) {
+	decoder := &msgpackDecoder{data: data}
+	value, err := decoder.decode()
+	if err != nil {
+		return nil, err
+	}
+	if decoder.pos != len(data) {
+		return nil, fmt.Errorf("msgpack: 消息末尾有多余的 %d 字节", len(data)-decoder.pos)
+	}
+
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("msgpack: 消息必须是键值表")
+	}
+
+	var msg Message
+	if err := msgpackAssignStruct(reflect.ValueOf(&msg).Elem(), fields); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	jsonNumberType    = reflect.TypeOf(json.Number(""))
+)
+
+// msgpackCustomJSON 类型是否自定义了JSON或文本序列化，与encoding/json一样，可寻址的值也检查指针接收者的方法
+func msgpackCustomJSON(v reflect.Value) bool {
+	t := v.Type()
+	if t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) {
+		return true
+	}
+	if v.CanAddr() {
+		pt := reflect.PointerTo(t)
+		return pt.Implements(jsonMarshalerType) || pt.Implements(textMarshalerType)
+	}
+	return false
+}
+
+// msgpackEncode 编码任意值，编码结果解码后与同一个值经过JSON编解码的结果相同
+func msgpackEncode(buf *bytes.Buffer, v reflect.Value) error {
+	if !v.IsValid() {
+		buf.WriteByte(0xc0)
+		return nil
+	}
+
+	// 自定义序列化的类型（如time.Time）按其JSON表示编码
+	if v.Kind() != reflect.Interface && msgpackCustomJSON(v) {
+		if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Map || v.Kind() == reflect.Slice) && v.IsNil() {
+			buf.WriteByte(0xc0)
+			return nil
+		}
+		// 可寻址的值传指针，以便调用指针接收者的方法
+		if v.CanAddr() {
+			return msgpackEncodeViaJSON(buf, v.Addr().Interface())
+		}
+		return msgpackEncodeViaJSON(buf, v.Interface())
+	}
+
+	// json.Number按数字编码
+	if v.Type() == jsonNumberType {
+		f, err := strconv.ParseFloat(v.String(), 64)
+		if err != nil {
+			return fmt.Errorf("msgpack: 无效的数字 %q", v.String())
+		}
+		buf.WriteByte(0xcb)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			buf.WriteByte(0xc0)
+			return nil
+		}
+		return msgpackEncode(buf, v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		msgpackEncodeInt(buf, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		msgpackEncodeUint(buf, v.Uint())
+	case reflect.Float32:
+		buf.WriteByte(0xca)
+		binary.Write(buf, binary.BigEndian, math.Float32bits(float32(v.Float())))
+	case reflect.Float64:
+		buf.WriteByte(0xcb)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(v.Float()))
+	case reflect.String:
+		msgpackEncodeString(buf, v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			buf.WriteByte(0xc0)
+			return nil
+		}
+		// 与encoding/json一样，元素类型没有自定义序列化的字节切片作为二进制数据
+		if v.Type().Elem().Kind() == reflect.Uint8 && !msgpackCustomJSON(reflect.New(v.Type().Elem()).Elem()) {
+			msgpackEncodeBinary(buf, v.Bytes())
+			return nil
+		}
+		return msgpackEncodeArray(buf, v)
+	case reflect.Array:
+		return msgpackEncodeArray(buf, v)
+	case reflect.Map:
+		if v.IsNil() {
+			buf.WriteByte(0xc0)
+			return nil
+		}
+		// 非字符串的键按encoding/json的规则转换
+		if v.Type().Key().Kind() != reflect.String {
+			return msgpackEncodeViaJSON(buf, v.Interface())
+		}
+		msgpackEncodeHeader(buf, v.Len(), 0x80, 0xde, 0xdf, 16)
+		iter := v.MapRange()
+		for iter.Next() {
+			msgpackEncodeString(buf, iter.Key().String())
+			if err := msgpackEncode(buf, iter.Value()); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		// 嵌入字段、string选项等规则与encoding/json保持一致
+		return msgpackEncodeViaJSON(buf, v.Interface())
+	default:
+		return fmt.Errorf("msgpack: 不支持的类型 %s", v.Type())
+	}
+	return nil
+}
+
+// msgpackEncodeStruct 按JSON标签把消息结构体编码为键值表，omitempty的判断与encoding/json相同
+func msgpackEncodeStruct(buf *bytes.Buffer, v reflect.Value) error {
+	type field struct {
+		name  string
+		value reflect.Value
+	}
+
+	fields := make([]field, 0, v.NumField())
+	for i := 0; i < v.NumField(); i++ {
+		structField := v.Type().Field(i)
+		if !structField.IsExported() {
+			continue
+		}
+
+		name, omitEmpty := msgpackFieldName(structField)
+		if name == "-" {
+			continue
+		}
+		if omitEmpty && msgpackIsEmpty(v.Field(i)) {
+			continue
+		}
+		fields = append(fields, field{name: name, value: v.Field(i)})
+	}
+
+	msgpackEncodeHeader(buf, len(fields), 0x80, 0xde, 0xdf, 16)
+	for _, f := range fields {
+		msgpackEncodeString(buf, f.name)
+		if err := msgpackEncode(buf, f.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// msgpackIsEmpty 与encoding/json的omitempty规则相同：false、0、nil以及长度为0的字符串、数组、切片和键值表
+func msgpackIsEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.Interface, reflect.Ptr:
+		return v.IsZero()
+	}
+	return false
+}
+
+// msgpackFieldName 解析结构体字段的JSON标签
+func msgpackFieldName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "" {
+		return field.Name, false
+	}
+
+	parts := strings.Split(tag, ",")
+	name := parts[0]
+	if name == "" {
+		name = field.Name
+	}
+
+	omitEmpty := false
+	for _, option := range parts[1:] {
+		if option == "omitempty" {
+			omitEmpty = true
+		}
+	}
+	return name, omitEmpty
+}
+
+// msgpackEncodeViaJSON 先转为JSON再按通用值编码
+func msgpackEncodeViaJSON(buf *bytes.Buffer, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var generic interface{}
+	if err := decoder.Decode(&generic); err != nil {
+		return err
+	}
+	return msgpackEncode(buf, reflect.ValueOf(msgpackFromJSONNumbers(generic)))
+}
+
+// msgpackFromJSONNumbers 把json.Number还原为整数或浮点数
+func msgpackFromJSONNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i := range v {
+			v[i] = msgpackFromJSONNumbers(v[i])
+		}
+	case map[string]interface{}:
+		for key := range v {
+			v[key] = msgpackFromJSONNumbers(v[key])
+		}
+	}
+	return value
+}
+
+func msgpackEncodeArray(buf *bytes.Buffer, v reflect.Value) error {
+	msgpackEncodeHeader(buf, v.Len(), 0x90, 0xdc, 0xdd, 16)
+	for i := 0; i < v.Len(); i++ {
+		if err := msgpackEncode(buf, v.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// msgpackEncodeHeader 编码数组或键值表的长度头部
+func msgpackEncodeHeader(buf *bytes.Buffer, length int, fix byte, code16 byte, code32 byte, fixLimit int) {
+	switch {
+	case length < fixLimit:
+		buf.WriteByte(fix | byte(length))
+	case length <= math.MaxUint16:
+		buf.WriteByte(code16)
+		binary.Write(buf, binary.BigEndian, uint16(length))
+	default:
+		buf.WriteByte(code32)
+		binary.Write(buf, binary.BigEndian, uint32(length))
+	}
+}
+
+// msgpackEncodeString 编码字符串，无效的UTF-8字节与encoding/json一样替换为U+FFFD
+func msgpackEncodeString(buf *bytes.Buffer, s string) {
+	if !utf8.ValidString(s) {
+		var valid strings.Builder
+		for i := 0; i < len(s); {
+			r, size := utf8.DecodeRuneInString(s[i:])
+			valid.WriteRune(r)
+			i += size
+		}
+		s = valid.String()
+	}
+
+	length := len(s)
+	switch {
+	case length < 32:
+		buf.WriteByte(0xa0 | byte(length))
+	case length <= math.MaxUint8:
+		buf.WriteByte(0xd9)
+		buf.WriteByte(byte(length))
+	case length <= math.MaxUint16:
+		buf.WriteByte(0xda)
+		binary.Write(buf, binary.BigEndian, uint16(length))
+	default:
+		buf.WriteByte(0xdb)
+		binary.Write(buf, binary.BigEndian, uint32(length))
+	}
+	buf.WriteString(s)
+}
+
+func msgpackEncodeBinary(buf *bytes.Buffer, data []byte) {
+	length := len(data)
+	switch {
+	case length <= math.MaxUint8:
+		buf.WriteByte(0xc4)
+		buf.WriteByte(byte(length))
+	case length <= math.MaxUint16:
+		buf.WriteByte(0xc5)
+		binary.Write(buf, binary.BigEndian, uint16(length))
+	default:
+		buf.WriteByte(0xc6)
+		binary.Write(buf, binary.BigEndian, uint32(length))
+	}
+	buf.Write(data)
+}
+
+func msgpackEncodeInt(buf *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0:
+		msgpackEncodeUint(buf, uint64(i))
+	case i >= -32:
+		buf.WriteByte(byte(i))
+	case i >= math.MinInt8:
+		buf.WriteByte(0xd0)
+		buf.WriteByte(byte(int8(i)))
+	case i >= math.MinInt16:
+		buf.WriteByte(0xd1)
+		binary.Write(buf, binary.BigEndian, int16(i))
+	case i >= math.MinInt32:
+		buf.WriteByte(0xd2)
+		binary.Write(buf, binary.BigEndian, int32(i))
+	default:
+		buf.WriteByte(0xd3)
+		binary.Write(buf, binary.BigEndian, i)
+	}
+}
+
+func msgpackEncodeUint(buf *bytes.Buffer, u uint64) {
+	switch {
+	case u < 128:
+		buf.WriteByte(byte(u))
+	case u <= math.MaxUint8:
+		buf.WriteByte(0xcc)
+		buf.WriteByte(byte(u))
+	case u <= math.MaxUint16:
+		buf.WriteByte(0xcd)
+		binary.Write(buf, binary.BigEndian, uint16(u))
+	case u <= math.MaxUint32:
+		buf.WriteByte(0xce)
+		binary.Write(buf, binary.BigEndian, uint32(u))
+	default:
+		buf.WriteByte(0xcf)
+		binary.Write(buf, binary.BigEndian, u)
+	}
+}
+
+// msgpackMaxDepth 数组和键值表的最大嵌套层数，与encoding/json一致，防止恶意数据耗尽栈空间
+const msgpackMaxDepth = 10000
+
+// msgpackDecoder MessagePack解码器
+type msgpackDecoder struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+// enter 进入一层嵌套，超过最大层数时返回错误
+func (d *msgpackDecoder) enter() error {
+	d.depth++
+	if d.depth > msgpackMaxDepth {
+		return fmt.Errorf("msgpack: 嵌套层数超过上限 %d", msgpackMaxDepth)
+	}
+	return nil
+}
+
+// read 读取n个字节
+func (d *msgpackDecoder) read(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.data) {
+		return nil, fmt.Errorf("msgpack: 数据不完整")
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// readLength 读取size字节的大端长度
+func (d *msgpackDecoder) readLength(size int) (int, error) {
+	b, err := d.read(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return int(b[0]), nil
+	case 2:
+		return int(binary.BigEndian.Uint16(b)), nil
+	default:
+		return int(binary.BigEndian.Uint32(b)), nil
+	}
+}
+
+// decode 解码一个值，整数保留为int64或uint64，赋给interface{}之前由msgpackJSONTypes转为float64
+func (d *msgpackDecoder) decode() (interface{}, error) {
+	b, err := d.read(1)
+	if err != nil {
+		return nil, err
+	}
+	code := b[0]
+
+	switch {
+	case code <= 0x7f:
+		return int64(code), nil
+	case code >= 0xe0:
+		return int64(int8(code)), nil
+	case code&0xf0 == 0x80:
+		return d.decodeMap(int(code & 0x0f))
+	case code&0xf0 == 0x90:
+		return d.decodeArray(int(code & 0x0f))
+	case code&0xe0 == 0xa0:
+		return d.decodeString(int(code & 0x1f))
+	}
+
+	switch code {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		length, err := d.readLength(1 << (code - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		data, err := d.read(length)
+		if err != nil {
+			return nil, err
+		}
+		// encoding/json把[]byte编码为base64字符串
+		return base64.StdEncoding.EncodeToString(data), nil
+	case 0xca:
+		data, err := d.read(4)
+		if err != nil {
+			return nil, err
+		}
+		// 按float32的最短十进制表示转换，与encoding/json编码float32再解码的结果相同
+		f := float64(math.Float32frombits(binary.BigEndian.Uint32(data)))
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return f, nil
+		}
+		return strconv.ParseFloat(strconv.FormatFloat(f, 'g', -1, 32), 64)
+	case 0xcb:
+		data, err := d.read(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		data, err := d.read(1 << (code - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		var u uint64
+		for _, c := range data {
+			u = u<<8 | uint64(c)
+		}
+		if u <= math.MaxInt64 {
+			return int64(u), nil
+		}
+		return u, nil
+	case 0xd0:
+		data, err := d.read(1)
+		if err != nil {
+			return nil, err
+		}
+		return int64(int8(data[0])), nil
+	case 0xd1:
+		data, err := d.read(2)
+		if err != nil {
+			return nil, err
+		}
+		return int64(int16(binary.BigEndian.Uint16(data))), nil
+	case 0xd2:
+		data, err := d.read(4)
+		if err != nil {
+			return nil, err
+		}
+		return int64(int32(binary.BigEndian.Uint32(data))), nil
+	case 0xd3:
+		data, err := d.read(8)
+		if err != nil {
+			return nil, err
+		}
+		return int64(binary.BigEndian.Uint64(data)), nil
+	case 0xd9, 0xda, 0xdb:
+		length, err := d.readLength(1 << (code - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeString(length)
+	case 0xdc, 0xdd:
+		length, err := d.readLength(2 << (code - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeArray(length)
+	case 0xde, 0xdf:
+		length, err := d.readLength(2 << (code - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeMap(length)
+	}
+
+	return nil, fmt.Errorf("msgpack: 不支持的类型码 0x%02x", code)
+}
+
+func (d *msgpackDecoder) decodeString(length int) (interface{}, error) {
+	data, err := d.read(length)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (d *msgpackDecoder) decodeArray(length int) (interface{}, error) {
+	// 每个元素至少占1字节，长度超过剩余数据时说明数据已损坏
+	if length > len(d.data)-d.pos {
+		return nil, fmt.Errorf("msgpack: 数据不完整")
+	}
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { d.depth-- }()
+
+	array := make([]interface{}, length)
+	for i := range array {
+		value, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		array[i] = value
+	}
+	return array, nil
+}
+
+func (d *msgpackDecoder) decodeMap(length int) (interface{}, error) {
+	if length*2 > len(d.data)-d.pos {
+		return nil, fmt.Errorf("msgpack: 数据不完整")
+	}
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { d.depth-- }()
+
+	m := make(map[string]interface{}, length)
+	for i := 0; i < length; i++ {
+		key, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		value, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		if s, ok := key.(string); ok {
+			m[s] = value
+		} else {
+			m[fmt.Sprint(key)] = value
+		}
+	}
+	return m, nil
+}
+
+// msgpackAssignStruct 按JSON标签把解码后的键值表赋给结构体字段
+func msgpackAssignStruct(v reflect.Value, fields map[string]interface{}) error {
+	for i := 0; i < v.NumField(); i++ {
+		structField := v.Type().Field(i)
+		if !structField.IsExported() {
+			continue
+		}
+
+		name, _ := msgpackFieldName(structField)
+		value, exists := fields[name]
+		if !exists || value == nil {
+			continue
+		}
+
+		if err := msgpackAssign(v.Field(i), value); err != nil {
+			return fmt.Errorf("msgpack: 字段 %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// msgpackJSONTypes 把解码出的整数转为float64，与encoding/json解码到interface{}的结果相同
+func msgpackJSONTypes(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = msgpackJSONTypes(v[i])
+		}
+	case map[string]interface{}:
+		for key := range v {
+			v[key] = msgpackJSONTypes(v[key])
+		}
+	}
+	return value
+}
+
+// msgpackAssign 把解码后的通用值赋给目标字段，转换规则与encoding/json相同
+func msgpackAssign(field reflect.Value, value interface{}) error {
+	switch field.Kind() {
+	case reflect.Interface:
+		if field.NumMethod() == 0 {
+			field.Set(reflect.ValueOf(msgpackJSONTypes(value)))
+			return nil
+		}
+	case reflect.String:
+		if s, ok := value.(string); ok {
+			field.SetString(s)
+			return nil
+		}
+	case reflect.Bool:
+		if b, ok := value.(bool); ok {
+			field.SetBool(b)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, ok := value.(int64); ok && !field.OverflowInt(n) {
+			field.SetInt(n)
+			return nil
+		}
+	case reflect.Map:
+		if m, ok := value.(map[string]interface{}); ok && field.Type() == reflect.TypeOf(m) {
+			field.Set(reflect.ValueOf(msgpackJSONTypes(m)))
+			return nil
+		}
+	}
+
+	// 其余类型（结构体、具体类型的切片等）以及需要报错的情况交给encoding/json
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, field.Addr().Interface())
+}
@@ -0,0 +1,451 @@
+package sdk
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// msgpackRoundTrip 编码后再解码一个值，返回编码结果和解码结果
+func msgpackRoundTrip(t *testing.T, value interface{}) ([]byte, interface{}) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := msgpackEncode(&buf, reflect.ValueOf(value)); err != nil {
+		t.Fatalf("编码失败: %v", err)
+	}
+	data := buf.Bytes()
+
+	decoder := &msgpackDecoder{data: data}
+	decoded, err := decoder.decode()
+	if err != nil {
+		t.Fatalf("解码失败: %v", err)
+	}
+	if decoder.pos != len(data) {
+		t.Fatalf("解码后剩余 %d 字节", len(data)-decoder.pos)
+	}
+	return data, msgpackJSONTypes(decoded)
+}
+
+func zeroArray(n int) []interface{} {
+	array := make([]interface{}, n)
+	for i := range array {
+		array[i] = float64(0)
+	}
+	return array
+}
+
+func intMap(n int) (map[string]int, map[string]interface{}) {
+	m := make(map[string]int, n)
+	want := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("k%d", i)
+		m[key] = i
+		want[key] = float64(i)
+	}
+	return m, want
+}
+
+func base64Of(data []byte) string {
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// TestMsgpackRoundTrip 每种类型码的边界值，解码结果与JSON一样：数字为float64，二进制数据为base64字符串
+func TestMsgpackRoundTrip(t *testing.T) {
+	map16, map16Want := intMap(16)
+	map32, map32Want := intMap(math.MaxUint16 + 1)
+
+	tests := []struct {
+		name  string
+		value interface{}
+		code  byte // 编码结果的首字节
+		want  interface{}
+	}{
+		{"nil", nil, 0xc0, nil},
+		{"false", false, 0xc2, false},
+		{"true", true, 0xc3, true},
+
+		{"positive fixint min", 0, 0x00, float64(0)},
+		{"positive fixint max", 127, 0x7f, float64(127)},
+		{"uint8 min", 128, 0xcc, float64(128)},
+		{"uint8 max", math.MaxUint8, 0xcc, float64(math.MaxUint8)},
+		{"uint16 min", math.MaxUint8 + 1, 0xcd, float64(math.MaxUint8 + 1)},
+		{"uint16 max", math.MaxUint16, 0xcd, float64(math.MaxUint16)},
+		{"uint32 min", math.MaxUint16 + 1, 0xce, float64(math.MaxUint16 + 1)},
+		{"uint32 max", uint32(math.MaxUint32), 0xce, float64(math.MaxUint32)},
+		{"uint64 min", int64(math.MaxUint32 + 1), 0xcf, float64(math.MaxUint32 + 1)},
+		{"int64 max", int64(math.MaxInt64), 0xcf, float64(math.MaxInt64)},
+		{"uint64 max", uint64(math.MaxUint64), 0xcf, float64(math.MaxUint64)},
+
+		{"negative fixint max", -1, 0xff, float64(-1)},
+		{"negative fixint min", -32, 0xe0, float64(-32)},
+		{"int8 max", -33, 0xd0, float64(-33)},
+		{"int8 min", math.MinInt8, 0xd0, float64(math.MinInt8)},
+		{"int16 max", math.MinInt8 - 1, 0xd1, float64(math.MinInt8 - 1)},
+		{"int16 min", math.MinInt16, 0xd1, float64(math.MinInt16)},
+		{"int32 max", math.MinInt16 - 1, 0xd2, float64(math.MinInt16 - 1)},
+		{"int32 min", math.MinInt32, 0xd2, float64(math.MinInt32)},
+		{"int64 neg max", int64(math.MinInt32 - 1), 0xd3, float64(math.MinInt32 - 1)},
+		{"int64 min", int64(math.MinInt64), 0xd3, float64(math.MinInt64)},
+
+		{"float32", float32(1.5), 0xca, float64(1.5)},
+		{"float32 shortest decimal", float32(0.1), 0xca, 0.1},
+		{"float32 max", float32(math.MaxFloat32), 0xca, 3.4028235e+38},
+		{"float64", 3.141592653589793, 0xcb, 3.141592653589793},
+		{"float64 tiny", math.SmallestNonzeroFloat64, 0xcb, math.SmallestNonzeroFloat64},
+		{"json.Number", json.Number("12.5"), 0xcb, 12.5},
+
+		{"fixstr empty", "", 0xa0, ""},
+		{"fixstr max", strings.Repeat("a", 31), 0xbf, strings.Repeat("a", 31)},
+		{"str8", strings.Repeat("a", 32), 0xd9, strings.Repeat("a", 32)},
+		{"str8 max", strings.Repeat("a", math.MaxUint8), 0xd9, strings.Repeat("a", math.MaxUint8)},
+		{"str16", strings.Repeat("a", math.MaxUint8+1), 0xda, strings.Repeat("a", math.MaxUint8+1)},
+		{"str32", strings.Repeat("a", math.MaxUint16+1), 0xdb, strings.Repeat("a", math.MaxUint16+1)},
+		{"str utf8", "插件", 0xa6, "插件"},
+		{"str invalid utf8", "a\xffb", 0xa5, "a\ufffdb"},
+
+		{"bin8 empty", []byte{}, 0xc4, ""},
+		{"bin8", []byte{0, 1, 2}, 0xc4, base64Of([]byte{0, 1, 2})},
+		{"bin16", bytes.Repeat([]byte{7}, math.MaxUint8+1), 0xc5, base64Of(bytes.Repeat([]byte{7}, math.MaxUint8+1))},
+		{"bin32", bytes.Repeat([]byte{7}, math.MaxUint16+1), 0xc6, base64Of(bytes.Repeat([]byte{7}, math.MaxUint16+1))},
+
+		{"fixarray empty", []int{}, 0x90, []interface{}{}},
+		{"fixarray max", make([]int, 15), 0x9f, zeroArray(15)},
+		{"array16", make([]int, 16), 0xdc, zeroArray(16)},
+		{"array32", make([]int, math.MaxUint16+1), 0xdd, zeroArray(math.MaxUint16 + 1)},
+		{"byte array", [2]byte{1, 2}, 0x92, []interface{}{float64(1), float64(2)}},
+
+		{"fixmap", map[string]int{"a": 1}, 0x81, map[string]interface{}{"a": float64(1)}},
+		{"map16", map16, 0xde, map16Want},
+		{"map32", map32, 0xdf, map32Want},
+		{"map int keys", map[int]string{1: "a"}, 0x81, map[string]interface{}{"1": "a"}},
+
+		{
+			"nested",
+			map[string]interface{}{
+				"list": []interface{}{1, "x", nil, []byte{9}, map[string]interface{}{"ok": true}},
+				"obj":  map[string]interface{}{"f": 0.5, "deep": []interface{}{[]interface{}{-1}}},
+			},
+			0x82,
+			map[string]interface{}{
+				"list": []interface{}{float64(1), "x", nil, base64Of([]byte{9}), map[string]interface{}{"ok": true}},
+				"obj":  map[string]interface{}{"f": 0.5, "deep": []interface{}{[]interface{}{float64(-1)}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, decoded := msgpackRoundTrip(t, tt.value)
+			if data[0] != tt.code {
+				t.Errorf("类型码 = 0x%02x, 期望 0x%02x", data[0], tt.code)
+			}
+			if !reflect.DeepEqual(decoded, tt.want) {
+				t.Errorf("解码结果 = %#v, 期望 %#v", decoded, tt.want)
+			}
+		})
+	}
+}
+
+// codecRoundTrip 用指定的编解码器编码后再解码消息
+func codecRoundTrip(t *testing.T, codec Codec, msg *Message) *Message {
+	t.Helper()
+
+	data, err := codec.Encode(msg)
+	if err != nil {
+		t.Fatalf("%s 编码失败: %v", codec.Name(), err)
+	}
+	decoded, err := codec.Decode(data)
+	if err != nil {
+		t.Fatalf("%s 解码失败: %v", codec.Name(), err)
+	}
+	return decoded
+}
+
+// assertSameAsJSON 消息经过MessagePack和JSON编解码后的结果必须完全相同
+func assertSameAsJSON(t *testing.T, msg *Message) {
+	t.Helper()
+
+	want := codecRoundTrip(t, JSONCodec, msg)
+	got := codecRoundTrip(t, MsgpackCodec, msg)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MessagePack结果与JSON不同:\n  msgpack: %#v\n  json:    %#v", got, want)
+	}
+}
+
+type jsonTagged struct {
+	Name     string            `json:"name"`
+	Count    int64             `json:"count,omitempty"`
+	Skipped  string            `json:"-"`
+	Quoted   int               `json:"quoted,string"`
+	Empty    []int             `json:"empty,omitempty"`
+	Nested   *jsonTagged       `json:"nested,omitempty"`
+	Labels   map[string]string `json:"labels"`
+	Untagged bool
+	private  int
+	jsonEmbedded
+}
+
+type jsonEmbedded struct {
+	Source string `json:"source"`
+}
+
+type textKey int
+
+func (k textKey) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("key-%d", int(k))), nil
+}
+
+type pointerMarshaler struct {
+	Value int
+}
+
+func (p *pointerMarshaler) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`"value=%d"`, p.Value)), nil
+}
+
+// TestMsgpackMatchesJSON 各种Go值作为参数和结果经过两种编解码器后必须得到相同的类型和值
+func TestMsgpackMatchesJSON(t *testing.T) {
+	when := time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.FixedZone("CST", 8*3600))
+	values := []struct {
+		name  string
+		value interface{}
+	}{
+		{"integers", []interface{}{0, -1, 127, 128, -33, math.MaxInt32, math.MinInt64, int64(math.MaxInt64), uint64(math.MaxUint64)}},
+		{"integer beyond float64 precision", int64(1<<53 + 1)},
+		{"typed integer slices", map[string]interface{}{"i8": []int8{-128, 127}, "u16": []uint16{65535}, "i": []int{1, 2, 3}}},
+		{"floats", []interface{}{0.1, -2.5, 1e300, math.SmallestNonzeroFloat64, float32(0.1), float32(3.4e38), float32(-1e-45)}},
+		{"float32 slice", []float32{0.1, 0.2, 0.3}},
+		{"strings", []string{"", "插件", strings.Repeat("长", 100), "<&>", "a\xffb\xc0", "\u2028"}},
+		{"bytes", []byte("raw\x00bytes")},
+		{"empty bytes", []byte{}},
+		{"nil bytes", []byte(nil)},
+		{"byte array", [4]byte{1, 2, 3, 4}},
+		{"nil slice", []int(nil)},
+		{"nil map", map[string]int(nil)},
+		{"nil pointer", (*int)(nil)},
+		{"pointer", func() *float64 { f := 1.5; return &f }()},
+		{"bool map", map[string]bool{"a": true, "b": false}},
+		{"int keys", map[int]string{-1: "neg", 10: "ten"}},
+		{"uint keys", map[uint8]int{255: 1}},
+		{"text marshaler keys", map[textKey]int{1: 1, 2: 2}},
+		{"struct", jsonTagged{Name: "a", Skipped: "x", Quoted: 42, Empty: []int{}, Labels: map[string]string{"k": "v"}, private: 1, jsonEmbedded: jsonEmbedded{Source: "s"}}},
+		{"struct omitempty set", &jsonTagged{Count: 1 << 60, Empty: []int{1}, Nested: &jsonTagged{Name: "child"}}},
+		{"time", when},
+		{"duration", 1500 * time.Millisecond},
+		{"json.Number", json.Number("-12.75e3")},
+		{"json.RawMessage", json.RawMessage(`{"raw":[1,"two",null]}`)},
+		{"pointer receiver marshaler in slice", []pointerMarshaler{{Value: 1}, {Value: 2}}},
+		{"pointer receiver marshaler in map", map[string]pointerMarshaler{"a": {Value: 1}}},
+		{"error info", &ErrorInfo{Code: ErrorCodeInternal, Message: "失败", Details: map[string]interface{}{"n": 3, "list": []int{1}}}},
+		{
+			"nested",
+			map[string]interface{}{
+				"matrix": [][]float64{{1, 2}, {3.5, -4}},
+				"deep":   []interface{}{map[string]interface{}{"x": []interface{}{nil, true, "s", uint8(200)}}},
+			},
+		},
+	}
+
+	for _, tt := range values {
+		t.Run(tt.name, func(t *testing.T) {
+			assertSameAsJSON(t, &Message{Type: MessageTypeResult, ID: "r", Result: tt.value})
+			assertSameAsJSON(t, &Message{Type: MessageTypeCall, ID: "c", Function: "f", Params: map[string]interface{}{"v": tt.value}})
+		})
+	}
+}
+
+// TestMsgpackMessageFields 消息本身的字段与JSON编码一样按omitempty省略零值
+func TestMsgpackMessageFields(t *testing.T) {
+	messages := []*Message{
+		{Type: MessageTypePing},
+		{Type: MessageTypeCall, ID: "call-1", Function: "add", Params: map[string]interface{}{}, Timeout: 1500, Stream: true, Credit: 8},
+		{Type: MessageTypeError, ID: "e", Error: "失败", ErrorInfo: &ErrorInfo{Code: "E_TEST", Message: "失败", Retryable: true, Stack: "trace"}},
+		{Type: MessageTypeResult, ID: "r", Result: false},
+		{Type: MessageTypeStreamAck, ID: "s", Credit: -1, Timeout: math.MaxInt64},
+	}
+	for _, msg := range messages {
+		assertSameAsJSON(t, msg)
+	}
+
+	data, err := MsgpackCodec.Encode(&Message{Type: MessageTypePing, Params: map[string]interface{}{}})
+	if err != nil {
+		t.Fatalf("编码失败: %v", err)
+	}
+	decoder := &msgpackDecoder{data: data}
+	value, err := decoder.decode()
+	if err != nil {
+		t.Fatalf("解码失败: %v", err)
+	}
+	if fields := value.(map[string]interface{}); len(fields) != 1 {
+		t.Errorf("空的params应被省略，实际编码了 %v", fields)
+	}
+}
+
+func TestMsgpackDecodeMessage(t *testing.T) {
+	data, err := MsgpackCodec.Encode(&Message{Type: MessageTypeCall, ID: "call-1"})
+	if err != nil {
+		t.Fatalf("编码失败: %v", err)
+	}
+
+	if _, err := MsgpackCodec.Decode(append(data, 0xc0)); err == nil {
+		t.Error("末尾有多余字节时应返回错误")
+	}
+	if _, err := MsgpackCodec.Decode([]byte{0x91, 0xc0}); err == nil {
+		t.Error("消息不是键值表时应返回错误")
+	}
+	// 与JSON一样，带小数的数字不能赋给整数字段
+	if _, err := MsgpackCodec.Decode([]byte{0x82, 0xa4, 't', 'y', 'p', 'e', 0xa4, 'c', 'a', 'l', 'l', 0xa7, 't', 'i', 'm', 'e', 'o', 'u', 't', 0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}); err == nil {
+		t.Error("timeout为1.5时应返回错误")
+	}
+}
+
+func TestMsgpackDecodeMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"reserved code", []byte{0xc1}},
+		{"ext unsupported", []byte{0xd4, 0x01, 0x02}},
+		{"uint16 truncated", []byte{0xcd, 0x01}},
+		{"float64 truncated", []byte{0xcb, 0, 0, 0}},
+		{"str8 missing length", []byte{0xd9}},
+		{"str8 truncated", []byte{0xd9, 0x05, 'a'}},
+		{"bin32 huge length", []byte{0xc6, 0xff, 0xff, 0xff, 0xff}},
+		{"array32 huge length", []byte{0xdd, 0xff, 0xff, 0xff, 0xff}},
+		{"map32 huge length", []byte{0xdf, 0xff, 0xff, 0xff, 0xff}},
+		{"map missing value", []byte{0x81, 0xa1, 'a'}},
+		{"too deep", append(bytes.Repeat([]byte{0x91}, msgpackMaxDepth+1), 0xc0)},
+		{"8MB nested arrays", bytes.Repeat([]byte{0x91}, 8<<20)},
+		{"8MB nested maps", bytes.Repeat([]byte{0x81, 0xa0}, 4<<20)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoder := &msgpackDecoder{data: tt.data}
+			if value, err := decoder.decode(); err == nil {
+				t.Errorf("期望解码失败，实际得到 %#v", value)
+			}
+		})
+	}
+}
+
+func TestMsgpackDecodeMaxDepth(t *testing.T) {
+	data := append(bytes.Repeat([]byte{0x91}, msgpackMaxDepth), 0xc0)
+	decoder := &msgpackDecoder{data: data}
+	if _, err := decoder.decode(); err != nil {
+		t.Fatalf("嵌套层数等于上限时不应失败: %v", err)
+	}
+	if decoder.depth != 0 {
+		t.Errorf("解码结束后嵌套层数 = %d, 期望 0", decoder.depth)
+	}
+}
+
+func TestMsgpackDecodeTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	value := map[string]interface{}{
+		"s":    strings.Repeat("x", 40),
+		"n":    []interface{}{int64(math.MinInt64), uint64(math.MaxUint64), 1.25, float32(2)},
+		"b":    []byte{1, 2, 3},
+		"flag": true,
+	}
+	if err := msgpackEncode(&buf, reflect.ValueOf(value)); err != nil {
+		t.Fatalf("编码失败: %v", err)
+	}
+	data := buf.Bytes()
+
+	for i := 0; i < len(data); i++ {
+		decoder := &msgpackDecoder{data: data[:i]}
+		if _, err := decoder.decode(); err == nil {
+			t.Errorf("截断到 %d/%d 字节时应返回错误", i, len(data))
+		}
+	}
+}
+
+func FuzzMsgpackDecode(f *testing.F) {
+	seeds := []interface{}{
+		nil,
+		true,
+		int64(-1),
+		uint64(math.MaxUint64),
+		2.5,
+		"hello",
+		[]byte{1, 2},
+		[]interface{}{int64(1), "a", nil},
+		map[string]interface{}{"k": []interface{}{map[string]interface{}{"x": 1.5}}},
+	}
+	for _, seed := range seeds {
+		var buf bytes.Buffer
+		if err := msgpackEncode(&buf, reflect.ValueOf(seed)); err != nil {
+			f.Fatalf("编码种子失败: %v", err)
+		}
+		f.Add(buf.Bytes())
+		f.Add(buf.Bytes()[:buf.Len()/2])
+	}
+	f.Add([]byte{0xc1})
+	f.Add([]byte{0xdd, 0xff, 0xff, 0xff, 0xff})
+	f.Add(bytes.Repeat([]byte{0x91}, 64))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		decoder := &msgpackDecoder{data: data}
+		value, err := decoder.decode()
+		if err != nil {
+			return
+		}
+		if decoder.depth != 0 {
+			t.Fatalf("解码结束后嵌套层数 = %d", decoder.depth)
+		}
+
+		// 能解码的值必须能重新编码，且重新编码后仍能完整解码
+		var buf bytes.Buffer
+		if err := msgpackEncode(&buf, reflect.ValueOf(value)); err != nil {
+			t.Fatalf("重新编码失败: %v", err)
+		}
+		redecoder := &msgpackDecoder{data: buf.Bytes()}
+		revalue, err := redecoder.decode()
+		if err != nil {
+			t.Fatalf("重新解码失败: %v", err)
+		}
+		if redecoder.pos != buf.Len() {
+			t.Fatalf("重新解码后剩余 %d 字节", buf.Len()-redecoder.pos)
+		}
+
+		var rebuf bytes.Buffer
+		if err := msgpackEncode(&rebuf, reflect.ValueOf(revalue)); err != nil {
+			t.Fatalf("第二次编码失败: %v", err)
+		}
+		if rebuf.Len() != buf.Len() {
+			t.Fatalf("两次编码长度不一致: %d != %d", rebuf.Len(), buf.Len())
+		}
+	})
+}
+
+// FuzzMsgpackMatchesJSON 任意JSON文档作为调用参数经过两种编解码器后必须得到相同的结果
+func FuzzMsgpackMatchesJSON(f *testing.F) {
+	seeds := []string{
+		`null`,
+		`{"a":1,"b":[1.5,-2,"x",null,true],"c":{"d":{}}}`,
+		`[9007199254740993, -9223372036854775808, 18446744073709551615, 1e308, 5e-324]`,
+		`"\u63d2\u4ef6\ud83d\ude00"`,
+		`{"":[[[[]]]], "\u0000": 0.1}`,
+		`[0.30000000000000004, 100, 1e2, -0]`,
+	}
+	for _, seed := range seeds {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var value interface{}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return
+		}
+		assertSameAsJSON(t, &Message{Type: MessageTypeCall, ID: "fuzz", Params: map[string]interface{}{"v": value}, Result: value})
+	})
+}
@@ -1,11 +1,17 @@
 package sdk
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -23,30 +29,73 @@ type PlatformCommunication interface {
 // PluginSDK 插件SDK
 // PluginSDK Plugin SDK
 type PluginSDK struct {
-	functions map[string]FunctionHandler // 注册的函数 / Registered functions
-	conn      net.Conn                   // 连接对象 / Connection object
-	listener  net.Listener               // 监听器对象 / Listener object
-	isRunning bool                       // 运行状态 / Running status
-	platform  PlatformCommunication     // 平台特定通信实现 / Platform-specific communication implementation
+	functions map[string]ContextFunctionHandler // 注册的函数 / Registered functions
+	conn      net.Conn                          // 连接对象 / Connection object
+	listener  net.Listener                      // 监听器对象 / Listener object
+	isRunning atomic.Bool                       // 运行状态 / Running status
+	platform  PlatformCommunication             // 平台特定通信实现 / Platform-specific communication implementation
+
+	reader       *bufio.Reader // 连接的读缓冲，注册阶段与消息循环共用 / Buffered reader shared by registration and the message loop
+	maxFrameSize int           // 最大帧大小 / Maximum frame size
+	writeMutex   sync.Mutex    // 写锁，多个处理协程并发回复时保证帧完整 / Write lock keeping frames intact across concurrent handlers
+
+	streamFunctions map[string]StreamHandler // 注册的流式函数 / Registered streaming functions
+
+	calls      map[string]context.CancelFunc // 执行中的调用，按消息ID索引 / Running calls indexed by message ID
+	streams    map[string]*StreamEmitter     // 执行中的流式调用 / Running streaming calls
+	callsMutex sync.Mutex
+
+	hostCalls      map[string]chan *Message // 等待主机响应的回调，按消息ID索引 / Host callbacks awaiting a response
+	hostCallsMutex sync.Mutex
+	hostCallSeq    uint64
+	hostClosed     bool // 连接已断开，不再接受新的主机调用 / Connection lost, no new host calls accepted
+
+	codec        Codec    // 注册时协商的编解码器 / Codec negotiated during registration
+	capabilities []string // 注册时协商的协议能力 / Capabilities agreed during registration
+
+	stopRequested  atomic.Bool // 主机要求停止或调用了Stop，连接随后断开属于预期 / Stop was requested, so losing the connection is expected
+	exitOnHostLoss bool        // 与主机的连接意外断开后强制退出进程，默认关闭 / Force the process to exit once the host goes away, off by default
 }
 
+const (
+	// hostLossExitDelay 与主机断开后等待插件自行退出的时间，超时后强制退出
+	// hostLossExitDelay Time the plugin gets to exit on its own after losing the host
+	hostLossExitDelay = 5 * time.Second
+	// hostCheckInterval 检查主机进程是否存在的间隔
+	// hostCheckInterval Interval between host process liveness checks
+	hostCheckInterval = time.Second
+)
+
 // NewPluginSDK 创建新的插件SDK
 // NewPluginSDK Create new plugin SDK
 func NewPluginSDK() *PluginSDK {
 	return &PluginSDK{
-		functions: make(map[string]FunctionHandler),
-		isRunning: false,
-		platform:  newPlatformCommunication(), // 使用平台特定实现 / Use platform-specific implementation
+		functions: make(map[string]ContextFunctionHandler),
+		calls:     make(map[string]context.CancelFunc),
+
+		streamFunctions: make(map[string]StreamHandler),
+		streams:         make(map[string]*StreamEmitter),
+		hostCalls:       make(map[string]chan *Message),
+		codec:           JSONCodec,
+		platform:        newPlatformCommunication(), // 使用平台特定实现 / Use platform-specific implementation
 	}
 }
 
 // RegisterFunction 注册函数
 func (sdk *PluginSDK) RegisterFunction(name string, handler FunctionHandler) error {
-	if sdk.isRunning {
+	return sdk.RegisterFunctionContext(name, func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		return handler(params)
+	})
+}
+
+// RegisterFunctionContext 注册带上下文的函数
+// 主机取消调用或调用超时后，处理器收到的ctx会被取消
+func (sdk *PluginSDK) RegisterFunctionContext(name string, handler ContextFunctionHandler) error {
+	if sdk.isRunning.Load() {
 		return fmt.Errorf("插件已启动，无法注册新函数")
 	}
 
-	if _, exists := sdk.functions[name]; exists {
+	if sdk.isRegistered(name) {
 		return fmt.Errorf("函数 %s 已注册", name)
 	}
 
@@ -54,9 +103,46 @@ func (sdk *PluginSDK) RegisterFunction(name string, handler FunctionHandler) err
 	return nil
 }
 
+// RegisterStreamFunction 注册流式函数
+// 处理器通过emitter逐块发送结果；以普通方式调用时，所有数据块会汇总为一个数组作为结果返回
+func (sdk *PluginSDK) RegisterStreamFunction(name string, handler StreamHandler) error {
+	if sdk.isRunning.Load() {
+		return fmt.Errorf("插件已启动，无法注册新函数")
+	}
+
+	if sdk.isRegistered(name) {
+		return fmt.Errorf("函数 %s 已注册", name)
+	}
+
+	sdk.streamFunctions[name] = handler
+	return nil
+}
+
+// isRegistered 检查函数名是否已被注册
+func (sdk *PluginSDK) isRegistered(name string) bool {
+	if _, exists := sdk.functions[name]; exists {
+		return true
+	}
+	_, exists := sdk.streamFunctions[name]
+	return exists
+}
+
+// SetMaxFrameSize 设置收发消息的最大帧大小，需在Start之前调用
+// 未设置时使用主机下发的值，主机也未下发时使用DefaultMaxFrameSize
+func (sdk *PluginSDK) SetMaxFrameSize(size int) {
+	sdk.maxFrameSize = size
+}
+
+// SetExitOnHostLoss 设置与主机的连接意外断开后是否强制退出进程，默认关闭
+// 默认只取消执行中的调用并让Wait返回，由插件执行清理后自行退出；
+// 开启后插件在hostLossExitDelay内没有退出时调用os.Exit，defer等清理逻辑不会执行
+func (sdk *PluginSDK) SetExitOnHostLoss(enabled bool) {
+	sdk.exitOnHostLoss = enabled
+}
+
 // Start 启动插件SDK
 func (sdk *PluginSDK) Start() error {
-	if sdk.isRunning {
+	if sdk.isRunning.Load() {
 		return fmt.Errorf("插件已启动")
 	}
 
@@ -73,7 +159,15 @@ func (sdk *PluginSDK) Start() error {
 	}
 	sdk.listener = listener
 	sdk.conn = conn
-	sdk.isRunning = true
+	sdk.reader = bufio.NewReader(conn)
+	sdk.isRunning.Store(true)
+
+	// 主机通过环境变量下发最大帧大小，显式调用SetMaxFrameSize时以其为准
+	if sdk.maxFrameSize <= 0 {
+		if size, err := strconv.Atoi(os.Getenv("GOPROC_MAX_FRAME_SIZE")); err == nil && size > 0 {
+			sdk.maxFrameSize = size
+		}
+	}
 
 	// 发送注册消息并等待确认
 	if err := sdk.sendRegisterMessageAndWait(); err != nil {
@@ -83,6 +177,9 @@ func (sdk *PluginSDK) Start() error {
 	// 启动消息处理循环
 	go sdk.messageLoop()
 
+	// 主机退出但连接没有断开时（例如套接字被其他进程继承）也能发现
+	go sdk.watchHost()
+
 	return nil
 }
 
@@ -112,6 +209,9 @@ func (sdk *PluginSDK) createListenerAndWait(address string) (net.Listener, net.C
 		return nil, nil, fmt.Errorf("创建监听器失败: %w", err)
 	}
 
+	// 通知主机监听器已创建，主机收到后立即连接 / Tell the host the listener is up so it connects right away
+	signalReady()
+
 	// 设置连接超时
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -142,6 +242,22 @@ func (sdk *PluginSDK) createListenerAndWait(address string) (net.Listener, net.C
 	}
 }
 
+// signalReady 向GOPROC_READY_FD指向的就绪管道写入一个字节并关闭，未设置时不做任何事
+// signalReady Write one byte to the readiness pipe named by GOPROC_READY_FD and close it; no-op when unset
+func signalReady() {
+	fd, err := strconv.Atoi(os.Getenv("GOPROC_READY_FD"))
+	if err != nil || fd < 3 {
+		return
+	}
+	// 插件启动的子进程不应再使用该描述符 / Child processes of the plugin must not reuse the descriptor
+	os.Unsetenv("GOPROC_READY_FD")
+
+	if file := os.NewFile(uintptr(fd), "goproc-ready"); file != nil {
+		file.Write([]byte{1})
+		file.Close()
+	}
+}
+
 // connect 建立连接
 // connect Establish connection
 func (sdk *PluginSDK) connect(address string) (net.Conn, error) {
@@ -165,15 +281,21 @@ func (sdk *PluginSDK) connect(address string) (net.Conn, error) {
 
 // sendRegisterMessage 发送注册消息
 func (sdk *PluginSDK) sendRegisterMessage() error {
-	functions := make([]string, 0, len(sdk.functions))
+	functions := make([]string, 0, len(sdk.functions)+len(sdk.streamFunctions))
 	for name := range sdk.functions {
 		functions = append(functions, name)
 	}
+	for name := range sdk.streamFunctions {
+		functions = append(functions, name)
+	}
 
 	msg := &Message{
 		Type: MessageTypeRegister,
 		Params: map[string]interface{}{
-			"functions": functions,
+			"functions":        functions,
+			"protocol_version": ProtocolVersion,
+			"capabilities":     SupportedCapabilities(),
+			"codecs":           SupportedCodecs(),
 		},
 	}
 
@@ -191,11 +313,8 @@ func (sdk *PluginSDK) sendRegisterMessageAndWait() error {
 	sdk.conn.SetReadDeadline(time.Time{})
 
 	// 等待注册确认响应
-	buffer := make([]byte, 4096)
-	var messageBuffer []byte
-
 	for {
-		n, err := sdk.conn.Read(buffer)
+		messageData, err := ReadFrame(sdk.reader, sdk.maxFrameSize)
 		if err != nil {
 			if err == io.EOF {
 				return fmt.Errorf("连接已关闭")
@@ -203,97 +322,119 @@ func (sdk *PluginSDK) sendRegisterMessageAndWait() error {
 			return fmt.Errorf("读取注册确认失败: %w", err)
 		}
 
-		messageBuffer = append(messageBuffer, buffer[:n]...)
-
-		// 处理完整的消息
-		for len(messageBuffer) >= 4 {
-			length := int(messageBuffer[0])<<24 | int(messageBuffer[1])<<16 |
-				int(messageBuffer[2])<<8 | int(messageBuffer[3])
-
-			if len(messageBuffer) < 4+length {
-				break // 消息不完整，继续读取
-			}
-
-			messageData := messageBuffer[4 : 4+length]
-			messageBuffer = messageBuffer[4+length:]
+		// 注册确认消息始终使用JSON编码
+		msg, err := DecodeMessage(messageData)
+		if err != nil {
+			return fmt.Errorf("解码注册确认消息失败: %w", err)
+		}
 
-			// 解码消息
-			msg, err := DecodeMessage(messageData)
-			if err != nil {
-				return fmt.Errorf("解码注册确认消息失败: %w", err)
+		// 检查是否为注册确认消息
+		if msg.Type == MessageTypeRegisterAck {
+			// 切换到主机选定的编解码器，旧版本主机不返回编解码器，继续使用JSON
+			if name, ok := msg.Params["codec"].(string); ok {
+				if codec, ok := GetCodec(name); ok {
+					sdk.codec = codec
+				}
 			}
 
-			// 检查是否为注册确认消息
-			if msg.Type == MessageTypeRegisterAck {
-				return nil
+			// 记录双方都支持的能力，旧版本主机不返回能力列表
+			if agreed, ok := msg.Params["capabilities"].([]interface{}); ok {
+				for _, capability := range agreed {
+					if name, ok := capability.(string); ok {
+						sdk.capabilities = append(sdk.capabilities, name)
+					}
+				}
 			}
-			// 如果是其他消息类型，继续等待注册确认
+			return nil
 		}
+		// 如果是其他消息类型，继续等待注册确认
 	}
 }
 
 // sendMessage 发送消息
 func (sdk *PluginSDK) sendMessage(msg *Message) error {
-	data, err := EncodeMessage(msg)
+	data, err := sdk.codec.Encode(msg)
 	if err != nil {
 		return err
 	}
 
-	// 添加长度前缀
-	length := len(data)
-	header := []byte{
-		byte(length >> 24),
-		byte(length >> 16),
-		byte(length >> 8),
-		byte(length),
-	}
+	sdk.writeMutex.Lock()
+	defer sdk.writeMutex.Unlock()
 
-	_, err = sdk.conn.Write(append(header, data...))
-	return err
+	// 添加长度前缀后发送
+	return WriteFrame(sdk.conn, data, sdk.maxFrameSize)
 }
 
 // messageLoop 消息处理循环
+// 收到超长或格式错误的帧时无法再与主机同步，直接关闭连接
 func (sdk *PluginSDK) messageLoop() {
 	defer sdk.conn.Close()
 
-	buffer := make([]byte, 4096)
-	var messageBuffer []byte
-
-	for sdk.isRunning {
-		n, err := sdk.conn.Read(buffer)
+	for sdk.isRunning.Load() {
+		messageData, err := ReadFrame(sdk.reader, sdk.maxFrameSize)
+		if err == nil {
+			err = sdk.handleMessage(messageData)
+		}
 		if err != nil {
-			if err == io.EOF {
-				break
+			if errors.Is(err, ErrFrameTooLarge) || errors.Is(err, ErrMalformedFrame) {
+				fmt.Fprintf(os.Stderr, "[goproc] 关闭与主机的连接: %v\n", err)
 			}
 			break
 		}
+	}
 
-		messageBuffer = append(messageBuffer, buffer[:n]...)
+	sdk.isRunning.Store(false)
+	sdk.closeHostCalls()
 
-		// 处理完整的消息
-		for len(messageBuffer) >= 4 {
-			length := int(messageBuffer[0])<<24 | int(messageBuffer[1])<<16 |
-				int(messageBuffer[2])<<8 | int(messageBuffer[3])
+	if !sdk.stopRequested.Load() {
+		sdk.hostLost()
+	}
+}
 
-			if len(messageBuffer) < 4+length {
-				break // 消息不完整，继续读取
-			}
+// hostLost 与主机的连接意外断开：取消执行中的调用并让Wait返回，
+// 开启了SetExitOnHostLoss时，插件在hostLossExitDelay内没有自行退出则强制退出，避免成为继续占用资源的孤儿进程
+func (sdk *PluginSDK) hostLost() {
+	fmt.Fprintf(os.Stderr, "[goproc] 与主机的连接已断开\n")
 
-			messageData := messageBuffer[4 : 4+length]
-			messageBuffer = messageBuffer[4+length:]
+	sdk.callsMutex.Lock()
+	for _, cancel := range sdk.calls {
+		cancel()
+	}
+	sdk.callsMutex.Unlock()
 
-			sdk.handleMessage(messageData)
-		}
+	if sdk.exitOnHostLoss {
+		time.AfterFunc(hostLossExitDelay, func() {
+			os.Exit(1)
+		})
+	}
+}
+
+// watchHost 定期检查主机进程是否存在，主机已退出时断开连接，由消息循环按主机断开处理
+func (sdk *PluginSDK) watchHost() {
+	pid, err := strconv.Atoi(os.Getenv("GOPROC_HOST_PID"))
+	if err != nil || pid <= 0 {
+		return
 	}
 
-	sdk.isRunning = false
+	ticker := time.NewTicker(hostCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !sdk.isRunning.Load() {
+			return
+		}
+		if !hostAlive(pid) {
+			sdk.conn.Close()
+			return
+		}
+	}
 }
 
 // handleMessage 处理消息
-func (sdk *PluginSDK) handleMessage(data []byte) {
-	msg, err := DecodeMessage(data)
+func (sdk *PluginSDK) handleMessage(data []byte) error {
+	msg, err := sdk.codec.Decode(data)
 	if err != nil {
-		return
+		return fmt.Errorf("%w: %v", ErrMalformedFrame, err)
 	}
 
 	switch msg.Type {
@@ -305,22 +446,71 @@ func (sdk *PluginSDK) handleMessage(data []byte) {
 		sdk.handlePongMessage(msg)
 	case MessageTypeStop:
 		sdk.handleStopMessage(msg)
+	case MessageTypeCancel:
+		sdk.handleCancelMessage(msg)
+	case MessageTypeStreamAck:
+		sdk.handleStreamAckMessage(msg)
+	case MessageTypeResult, MessageTypeError:
+		sdk.handleHostReply(msg)
 	}
+	return nil
 }
 
 // handleCallMessage 处理调用消息
 func (sdk *PluginSDK) handleCallMessage(msg *Message) {
 	handler, exists := sdk.functions[msg.Function]
-	if !exists {
-		sdk.sendErrorMessage(msg.ID, fmt.Sprintf("函数 %s 不存在", msg.Function))
+	streamHandler, isStream := sdk.streamFunctions[msg.Function]
+	if !exists && !isStream {
+		sdk.sendErrorMessage(msg.ID, &ErrorInfo{
+			Code:    ErrorCodeFunctionNotFound,
+			Message: fmt.Sprintf("函数 %s 不存在", msg.Function),
+		})
 		return
 	}
 
+	// 为调用创建上下文，主机传来的剩余超时时间作为截止时间
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if msg.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), time.Duration(msg.Timeout)*time.Millisecond)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+
+	sdk.callsMutex.Lock()
+	sdk.calls[msg.ID] = cancel
+	sdk.callsMutex.Unlock()
+
 	// 异步处理函数调用
 	go func() {
-		result, err := handler(msg.Params)
+		defer func() {
+			sdk.callsMutex.Lock()
+			delete(sdk.calls, msg.ID)
+			sdk.callsMutex.Unlock()
+			cancel()
+		}()
+
+		// 处理函数panic时返回错误并附带调用栈，避免整个插件进程退出
+		defer func() {
+			if r := recover(); r != nil {
+				sdk.sendErrorMessage(msg.ID, &ErrorInfo{
+					Code:    ErrorCodeInternal,
+					Message: fmt.Sprintf("函数 %s 执行异常: %v", msg.Function, r),
+					Stack:   string(debug.Stack()),
+				})
+			}
+		}()
+
+		if isStream {
+			sdk.runStreamHandler(ctx, msg, streamHandler)
+			return
+		}
+
+		result, err := handler(ctx, msg.Params)
 		if err != nil {
-			sdk.sendErrorMessage(msg.ID, err.Error())
+			sdk.sendErrorMessage(msg.ID, ErrorInfoFrom(err))
 			return
 		}
 
@@ -328,6 +518,139 @@ func (sdk *PluginSDK) handleCallMessage(msg *Message) {
 	}()
 }
 
+// runStreamHandler 执行流式函数
+func (sdk *PluginSDK) runStreamHandler(ctx context.Context, msg *Message, handler StreamHandler) {
+	emitter := newStreamEmitter(ctx, sdk, msg.ID, msg.Credit, !msg.Stream)
+
+	if msg.Stream {
+		sdk.callsMutex.Lock()
+		sdk.streams[msg.ID] = emitter
+		sdk.callsMutex.Unlock()
+
+		defer func() {
+			sdk.callsMutex.Lock()
+			delete(sdk.streams, msg.ID)
+			sdk.callsMutex.Unlock()
+		}()
+	}
+
+	if err := handler(ctx, msg.Params, emitter); err != nil {
+		sdk.sendErrorMessage(msg.ID, ErrorInfoFrom(err))
+		return
+	}
+
+	// 以普通方式调用时，把收集到的数据块作为结果返回
+	if !msg.Stream {
+		sdk.sendResultMessage(msg.ID, emitter.chunks)
+		return
+	}
+
+	sdk.sendMessage(&Message{
+		Type: MessageTypeStreamEnd,
+		ID:   msg.ID,
+	})
+}
+
+// handleStreamAckMessage 处理流式额度确认消息
+func (sdk *PluginSDK) handleStreamAckMessage(msg *Message) {
+	sdk.callsMutex.Lock()
+	emitter, exists := sdk.streams[msg.ID]
+	sdk.callsMutex.Unlock()
+
+	if exists {
+		emitter.addCredit(msg.Credit)
+	}
+}
+
+// CallHost 调用主机注册的服务并等待结果
+// 通常在函数处理器中使用，ctx取消或超时后主机端的调用也会被取消
+func (sdk *PluginSDK) CallHost(ctx context.Context, name string, params map[string]interface{}) (interface{}, error) {
+	if !sdk.isRunning.Load() || sdk.conn == nil {
+		return nil, fmt.Errorf("插件未启动，无法调用主机服务")
+	}
+
+	if !HasCapability(sdk.capabilities, CapabilityHostCall) {
+		return nil, fmt.Errorf("主机不支持回调主机服务")
+	}
+
+	messageID := fmt.Sprintf("host-%d", atomic.AddUint64(&sdk.hostCallSeq, 1))
+	replyChan := make(chan *Message, 1)
+
+	sdk.hostCallsMutex.Lock()
+	if sdk.hostClosed {
+		sdk.hostCallsMutex.Unlock()
+		return nil, fmt.Errorf("与主机的连接已断开")
+	}
+	sdk.hostCalls[messageID] = replyChan
+	sdk.hostCallsMutex.Unlock()
+
+	defer func() {
+		sdk.hostCallsMutex.Lock()
+		delete(sdk.hostCalls, messageID)
+		sdk.hostCallsMutex.Unlock()
+	}()
+
+	msg := &Message{
+		Type:     MessageTypeHostCall,
+		ID:       messageID,
+		Function: name,
+		Params:   params,
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		msg.Timeout = time.Until(deadline).Milliseconds()
+		if msg.Timeout <= 0 {
+			return nil, context.DeadlineExceeded
+		}
+	}
+
+	if err := sdk.sendMessage(msg); err != nil {
+		return nil, fmt.Errorf("发送主机调用失败: %w", err)
+	}
+
+	select {
+	case reply, ok := <-replyChan:
+		if !ok {
+			return nil, fmt.Errorf("与主机的连接已断开")
+		}
+		if reply.Type == MessageTypeError {
+			return nil, fmt.Errorf("主机返回错误: %w", ErrorFromMessage(reply))
+		}
+		return reply.Result, nil
+	case <-ctx.Done():
+		sdk.sendMessage(&Message{
+			Type: MessageTypeCancel,
+			ID:   messageID,
+		})
+		return nil, ctx.Err()
+	}
+}
+
+// handleHostReply 把主机的响应交给等待中的CallHost
+func (sdk *PluginSDK) handleHostReply(msg *Message) {
+	sdk.hostCallsMutex.Lock()
+	replyChan, exists := sdk.hostCalls[msg.ID]
+	if exists {
+		delete(sdk.hostCalls, msg.ID)
+	}
+	sdk.hostCallsMutex.Unlock()
+
+	if exists {
+		replyChan <- msg
+	}
+}
+
+// closeHostCalls 连接断开时让等待中的CallHost立即失败
+func (sdk *PluginSDK) closeHostCalls() {
+	sdk.hostCallsMutex.Lock()
+	defer sdk.hostCallsMutex.Unlock()
+
+	sdk.hostClosed = true
+	for messageID, replyChan := range sdk.hostCalls {
+		close(replyChan)
+		delete(sdk.hostCalls, messageID)
+	}
+}
+
 // handlePingMessage 处理心跳消息
 func (sdk *PluginSDK) handlePingMessage(msg *Message) {
 	pongMsg := &Message{
@@ -341,9 +664,21 @@ func (sdk *PluginSDK) handlePingMessage(msg *Message) {
 func (sdk *PluginSDK) handlePongMessage(msg *Message) {
 }
 
+// handleCancelMessage 处理取消消息，取消对应调用的上下文
+func (sdk *PluginSDK) handleCancelMessage(msg *Message) {
+	sdk.callsMutex.Lock()
+	cancel, exists := sdk.calls[msg.ID]
+	sdk.callsMutex.Unlock()
+
+	if exists {
+		cancel()
+	}
+}
+
 // handleStopMessage 处理停止消息
 func (sdk *PluginSDK) handleStopMessage(msg *Message) {
-	sdk.isRunning = false
+	sdk.stopRequested.Store(true)
+	sdk.isRunning.Store(false)
 }
 
 // sendResultMessage 发送结果消息
@@ -353,29 +688,37 @@ func (sdk *PluginSDK) sendResultMessage(id string, result interface{}) {
 		ID:     id,
 		Result: result,
 	}
-	sdk.sendMessage(msg)
+	// 结果超出最大帧大小时改为返回错误，避免主机一直等待
+	if err := sdk.sendMessage(msg); errors.Is(err, ErrFrameTooLarge) {
+		sdk.sendErrorMessage(id, &ErrorInfo{
+			Code:    ErrorCodeResourceExhausted,
+			Message: fmt.Sprintf("返回结果过大: %v", err),
+		})
+	}
 }
 
-// sendErrorMessage 发送错误消息
-func (sdk *PluginSDK) sendErrorMessage(id string, errorMsg string) {
+// sendErrorMessage 发送错误消息，Error字段保留错误描述以兼容只认识字符串的主机
+func (sdk *PluginSDK) sendErrorMessage(id string, info *ErrorInfo) {
 	msg := &Message{
-		Type:  MessageTypeError,
-		ID:    id,
-		Error: errorMsg,
+		Type:      MessageTypeError,
+		ID:        id,
+		Error:     info.Message,
+		ErrorInfo: info,
 	}
 	sdk.sendMessage(msg)
 }
 
 // Wait 等待插件运行直到停止
 func (sdk *PluginSDK) Wait() {
-	for sdk.isRunning {
+	for sdk.isRunning.Load() {
 		time.Sleep(100 * time.Millisecond)
 	}
 }
 
 // Stop 停止插件SDK
 func (sdk *PluginSDK) Stop() {
-	sdk.isRunning = false
+	sdk.stopRequested.Store(true)
+	sdk.isRunning.Store(false)
 	if sdk.conn != nil {
 		sdk.conn.Close()
 	}
@@ -389,6 +732,31 @@ func RegisterFunction(name string, handler FunctionHandler) error {
 	return globalSDK.RegisterFunction(name, handler)
 }
 
+// RegisterFunctionContext 全局注册带上下文的函数
+func RegisterFunctionContext(name string, handler ContextFunctionHandler) error {
+	return globalSDK.RegisterFunctionContext(name, handler)
+}
+
+// RegisterStreamFunction 全局注册流式函数
+func RegisterStreamFunction(name string, handler StreamHandler) error {
+	return globalSDK.RegisterStreamFunction(name, handler)
+}
+
+// CallHost 全局调用主机服务
+func CallHost(ctx context.Context, name string, params map[string]interface{}) (interface{}, error) {
+	return globalSDK.CallHost(ctx, name, params)
+}
+
+// SetMaxFrameSize 全局设置最大帧大小
+func SetMaxFrameSize(size int) {
+	globalSDK.SetMaxFrameSize(size)
+}
+
+// SetExitOnHostLoss 全局设置主机断开后是否强制退出进程
+func SetExitOnHostLoss(enabled bool) {
+	globalSDK.SetExitOnHostLoss(enabled)
+}
+
 // Start 全局启动函数
 func Start() error {
 	return globalSDK.Start()
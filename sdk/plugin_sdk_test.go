@@ -0,0 +1,178 @@
+package sdk
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeHost 通过net.Pipe与SDK相连的模拟主机，测试直接读写主机端的帧
+type fakeHost struct {
+	t    *testing.T
+	conn net.Conn
+}
+
+// startPipe 把已注册函数的SDK连接到模拟主机并运行消息循环，相当于完成了注册
+func startPipe(t *testing.T, sdk *PluginSDK) *fakeHost {
+	t.Helper()
+
+	hostConn, pluginConn := net.Pipe()
+	sdk.conn = pluginConn
+	sdk.reader = bufio.NewReader(pluginConn)
+	sdk.isRunning.Store(true)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sdk.messageLoop()
+	}()
+
+	t.Cleanup(func() {
+		sdk.Stop()
+		hostConn.Close()
+		<-done
+	})
+	return &fakeHost{t: t, conn: hostConn}
+}
+
+// receive 读取SDK发给主机的下一条消息
+func (h *fakeHost) receive() *Message {
+	h.t.Helper()
+
+	h.conn.SetReadDeadline(time.Now().Add(time.Second))
+	data, err := ReadFrame(h.conn, DefaultMaxFrameSize)
+	if err != nil {
+		h.t.Fatalf("主机读取消息失败: %v", err)
+	}
+	msg, err := JSONCodec.Decode(data)
+	if err != nil {
+		h.t.Fatalf("主机解码消息失败: %v", err)
+	}
+	return msg
+}
+
+// send 主机向SDK发送一条消息
+func (h *fakeHost) send(msg *Message) {
+	h.t.Helper()
+
+	data, err := JSONCodec.Encode(msg)
+	if err != nil {
+		h.t.Fatalf("主机编码消息失败: %v", err)
+	}
+	h.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	if err := WriteFrame(h.conn, data, DefaultMaxFrameSize); err != nil {
+		h.t.Fatalf("主机发送消息失败: %v", err)
+	}
+}
+
+// callCount 执行中的调用数
+func (sdk *PluginSDK) callCount() int {
+	sdk.callsMutex.Lock()
+	defer sdk.callsMutex.Unlock()
+	return len(sdk.calls)
+}
+
+// waitNoCalls 等待调用记录全部删除，回复发出之后处理协程才删除记录
+func waitNoCalls(t *testing.T, sdk *PluginSDK) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for sdk.callCount() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("调用结束后仍有 %d 个调用记录", sdk.callCount())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCallContext(t *testing.T) {
+	tests := []struct {
+		name         string
+		timeout      int64
+		cancel       bool
+		wantDeadline bool
+		wantErr      error
+		wantCode     string
+	}{
+		{name: "主机发送取消消息", cancel: true, wantErr: context.Canceled, wantCode: ErrorCodeCanceled},
+		{name: "超时后取消", timeout: 30, wantDeadline: true, wantErr: context.DeadlineExceeded, wantCode: ErrorCodeTimeout},
+		{name: "带超时时被主机取消", timeout: 60000, cancel: true, wantDeadline: true, wantErr: context.Canceled, wantCode: ErrorCodeCanceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sdk := NewPluginSDK()
+			started := make(chan bool, 1)
+			ctxErr := make(chan error, 1)
+			sdk.RegisterFunctionContext("wait", func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+				_, hasDeadline := ctx.Deadline()
+				started <- hasDeadline
+				<-ctx.Done()
+				ctxErr <- ctx.Err()
+				return nil, ctx.Err()
+			})
+			host := startPipe(t, sdk)
+
+			host.send(&Message{Type: MessageTypeCall, ID: "call-1", Function: "wait", Timeout: tt.timeout})
+			select {
+			case hasDeadline := <-started:
+				if hasDeadline != tt.wantDeadline {
+					t.Errorf("处理函数的ctx有截止时间: %v, 期望 %v", hasDeadline, tt.wantDeadline)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("处理函数未被调用")
+			}
+			if tt.cancel {
+				host.send(&Message{Type: MessageTypeCancel, ID: "call-1"})
+			}
+
+			select {
+			case err := <-ctxErr:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("处理函数的ctx错误 = %v, 期望 %v", err, tt.wantErr)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("处理函数的ctx未被取消")
+			}
+
+			reply := host.receive()
+			if reply.ID != "call-1" || reply.Type != MessageTypeError || reply.ErrorInfo == nil || reply.ErrorInfo.Code != tt.wantCode {
+				t.Fatalf("回复 = %s %s %+v, 期望错误码 %s", reply.ID, reply.Type, reply.ErrorInfo, tt.wantCode)
+			}
+
+			waitNoCalls(t, sdk)
+		})
+	}
+}
+
+func TestCallRecordRemoved(t *testing.T) {
+	sdk := NewPluginSDK()
+	sdk.RegisterFunction("echo", func(params map[string]interface{}) (interface{}, error) {
+		return params["v"], nil
+	})
+	sdk.RegisterFunction("panic", func(params map[string]interface{}) (interface{}, error) {
+		panic("处理异常")
+	})
+	host := startPipe(t, sdk)
+
+	host.send(&Message{Type: MessageTypeCall, ID: "call-1", Function: "echo", Params: map[string]interface{}{"v": "x"}})
+	if reply := host.receive(); reply.Type != MessageTypeResult || reply.Result != "x" {
+		t.Fatalf("回复 = %s %v, 期望结果 x", reply.Type, reply.Result)
+	}
+	host.send(&Message{Type: MessageTypeCall, ID: "call-2", Function: "panic"})
+	if reply := host.receive(); reply.Type != MessageTypeError || reply.ErrorInfo == nil || reply.ErrorInfo.Code != ErrorCodeInternal {
+		t.Fatalf("回复 = %s %+v, 期望错误码 %s", reply.Type, reply.ErrorInfo, ErrorCodeInternal)
+	}
+
+	waitNoCalls(t, sdk)
+
+	// 已结束的调用收到取消消息时忽略
+	host.send(&Message{Type: MessageTypeCancel, ID: "call-1"})
+	host.send(&Message{Type: MessageTypeCall, ID: "call-3", Function: "echo", Params: map[string]interface{}{"v": "y"}})
+	if reply := host.receive(); reply.ID != "call-3" || reply.Result != "y" {
+		t.Fatalf("回复 = %s %v, 期望 call-3 的结果 y", reply.ID, reply.Result)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"syscall"
 )
 
 // UnixCommunication Unix平台通信实现
@@ -25,20 +26,20 @@ func newPlatformCommunication() PlatformCommunication {
 func (u *UnixCommunication) CreateListener(address string) (net.Listener, error) {
 	// 确保套接字文件不存在 / Ensure socket file does not exist
 	os.Remove(address)
-	
+
 	// 创建目录 / Create directory
 	dir := filepath.Dir(address)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return nil, fmt.Errorf("创建目录失败: %w", err)
 	}
-	
+
 	// 使用net.Listen创建Unix域套接字监听器
 	// Use net.Listen to create Unix domain socket listener
 	listener, err := net.Listen("unix", address)
 	if err != nil {
 		return nil, fmt.Errorf("创建Unix域套接字监听器失败: %w", err)
 	}
-	
+
 	return listener, nil
 }
 
@@ -62,4 +63,11 @@ func (u *UnixCommunication) GetCommunicationAddress() string {
 	processID := os.Getpid()
 	tmpDir := os.TempDir()
 	return filepath.Join(tmpDir, fmt.Sprintf("goproc_plugin_%d.sock", processID))
-}
\ No newline at end of file
+}
+
+// hostAlive 主机进程是否仍然存在
+// hostAlive Whether the host process still exists
+func hostAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
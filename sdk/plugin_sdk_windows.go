@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"syscall"
 
 	"github.com/Microsoft/go-winio"
 )
@@ -52,4 +53,24 @@ func (w *WindowsCommunication) GetCommunicationAddress() string {
 	// Generate Windows named pipe address
 	processID := os.Getpid()
 	return fmt.Sprintf("\\\\.\\pipe\\goproc_plugin_%d", processID)
-}
\ No newline at end of file
+}
+
+// stillActive GetExitCodeProcess对仍在运行的进程返回的退出码
+// stillActive Exit code GetExitCodeProcess reports for a running process
+const stillActive = 259
+
+// hostAlive 主机进程是否仍然存在
+// hostAlive Whether the host process still exists
+func hostAlive(pid int) bool {
+	handle, err := syscall.OpenProcess(syscall.PROCESS_QUERY_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer syscall.CloseHandle(handle)
+
+	var code uint32
+	if err := syscall.GetExitCodeProcess(handle, &code); err != nil {
+		return true
+	}
+	return code == stillActive
+}
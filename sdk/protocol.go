@@ -0,0 +1,58 @@
+package sdk
+
+// ProtocolVersion 当前协议版本
+// 未在注册消息中声明版本的插件视为版本1：一问一答的调用，不支持任何扩展能力
+const ProtocolVersion = 2
+
+// 协议能力，注册时由插件声明，主机在注册确认中返回双方都支持的部分
+const (
+	CapabilityMultiplex = "multiplex" // 同一连接上并发处理多个调用
+	CapabilityStreaming = "streaming" // 流式结果
+	CapabilityCancel    = "cancel"    // 取消调用
+	CapabilityHostCall  = "host_call" // 回调主机服务
+)
+
+// capabilities Go SDK与主机支持的能力
+var capabilities = []string{
+	CapabilityMultiplex,
+	CapabilityStreaming,
+	CapabilityCancel,
+	CapabilityHostCall,
+}
+
+// SupportedCapabilities 获取支持的协议能力
+func SupportedCapabilities() []string {
+	return append([]string(nil), capabilities...)
+}
+
+// NegotiateCapabilities 取对端声明的能力与本端支持的能力的交集
+func NegotiateCapabilities(offered []string) []string {
+	agreed := make([]string, 0, len(offered))
+	for _, name := range offered {
+		if HasCapability(capabilities, name) && !HasCapability(agreed, name) {
+			agreed = append(agreed, name)
+		}
+	}
+	return agreed
+}
+
+// NegotiateVersion 取双方协议版本中较小的一个，未声明版本时为1
+func NegotiateVersion(offered int) int {
+	if offered <= 0 {
+		return 1
+	}
+	if offered < ProtocolVersion {
+		return offered
+	}
+	return ProtocolVersion
+}
+
+// HasCapability 检查能力列表中是否包含指定能力
+func HasCapability(list []string, name string) bool {
+	for _, capability := range list {
+		if capability == name {
+			return true
+		}
+	}
+	return false
+}
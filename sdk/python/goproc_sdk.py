@@ -120,6 +120,11 @@ MESSAGE_TYPE_REGISTER = "register"
 MESSAGE_TYPE_REGISTER_ACK = "register_ack"
 MESSAGE_TYPE_STOP = "stop"
 
+# 协议版本与能力
+# Python SDK在消息线程中依次处理调用，不声明多路复用等扩展能力
+PROTOCOL_VERSION = 2
+CAPABILITIES = []
+
 class PluginSDK:
     """插件SDK主类"""
     
@@ -246,7 +251,8 @@ class PluginSDK:
             error_msg = {
                 'type': MESSAGE_TYPE_ERROR,
                 'id': msg_id,
-                'error': f"函数 {function_name} 不存在"
+                'error': f"函数 {function_name} 不存在",
+                'error_info': {'code': 'function_not_found', 'message': f"函数 {function_name} 不存在"}
             }
             self.send_message(error_msg)
             return
@@ -274,7 +280,8 @@ class PluginSDK:
     def handle_ping_message(self, msg: Dict[str, Any]) -> None:
         """处理ping消息"""
         pong_msg = {
-            'type': MESSAGE_TYPE_PONG
+            'type': MESSAGE_TYPE_PONG,
+            'id': msg.get('id', '')
         }
         self.send_message(pong_msg)
     
@@ -358,6 +365,9 @@ class PluginSDK:
                 self.listener.bind(address)
                 self.listener.listen(1)
                 
+                # 通知主机监听器已创建，主机收到后立即连接
+                self.signal_ready()
+                
                 self.conn, _ = self.listener.accept()
             
             return True
@@ -365,6 +375,17 @@ class PluginSDK:
         except Exception:
             return False
     
+    def signal_ready(self) -> None:
+        """向GOPROC_READY_FD指向的就绪管道写入一个字节并关闭，未设置时不做任何事"""
+        fd = os.environ.pop('GOPROC_READY_FD', '')
+        if not fd:
+            return
+        try:
+            os.write(int(fd), b'\x01')
+            os.close(int(fd))
+        except (OSError, ValueError):
+            pass
+    
     def start(self) -> bool:
         """启动插件"""
         # 获取通信地址
@@ -417,7 +438,9 @@ class PluginSDK:
             register_msg = {
                 'type': MESSAGE_TYPE_REGISTER,
                 'params': {
-                    'functions': function_names
+                    'functions': function_names,
+                    'protocol_version': PROTOCOL_VERSION,
+                    'capabilities': CAPABILITIES
                 }
             }
             
@@ -460,7 +483,9 @@ class PluginSDK:
              register_msg = {
                  'type': MESSAGE_TYPE_REGISTER,
                  'params': {
-                     'functions': function_names
+                     'functions': function_names,
+                     'protocol_version': PROTOCOL_VERSION,
+                     'capabilities': CAPABILITIES
                  }
              }
              
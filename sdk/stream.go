@@ -0,0 +1,78 @@
+package sdk
+
+import (
+	"context"
+	"sync"
+)
+
+// StreamEmitter 流式结果发送器
+// StreamEmitter Stream result emitter
+type StreamEmitter struct {
+	ctx context.Context
+	sdk *PluginSDK
+	id  string
+
+	mutex  sync.Mutex
+	credit int           // 剩余额度 / Remaining credit
+	signal chan struct{} // 额度增加时通知 / Signalled when credit is granted
+
+	collect bool          // 非流式调用时收集数据块作为结果 / Collect chunks as the result of a non-streaming call
+	chunks  []interface{} // 收集的数据块 / Collected chunks
+}
+
+// newStreamEmitter 创建流式结果发送器
+// newStreamEmitter Create stream result emitter
+func newStreamEmitter(ctx context.Context, sdk *PluginSDK, id string, credit int, collect bool) *StreamEmitter {
+	return &StreamEmitter{
+		ctx:     ctx,
+		sdk:     sdk,
+		id:      id,
+		credit:  credit,
+		signal:  make(chan struct{}, 1),
+		collect: collect,
+	}
+}
+
+// Emit 发送一个数据块
+// 额度用完时阻塞，直到主机消费数据并归还额度或调用被取消
+// Emit Send one chunk; blocks while out of credit until the host grants more or the call is cancelled
+func (e *StreamEmitter) Emit(chunk interface{}) error {
+	if e.collect {
+		e.chunks = append(e.chunks, chunk)
+		return nil
+	}
+
+	for {
+		e.mutex.Lock()
+		if e.credit > 0 {
+			e.credit--
+			e.mutex.Unlock()
+
+			return e.sdk.sendMessage(&Message{
+				Type:   MessageTypeStreamChunk,
+				ID:     e.id,
+				Result: chunk,
+			})
+		}
+		e.mutex.Unlock()
+
+		select {
+		case <-e.signal:
+		case <-e.ctx.Done():
+			return e.ctx.Err()
+		}
+	}
+}
+
+// addCredit 增加额度并唤醒等待中的Emit
+// addCredit Grant credit and wake up a blocked Emit
+func (e *StreamEmitter) addCredit(credit int) {
+	e.mutex.Lock()
+	e.credit += credit
+	e.mutex.Unlock()
+
+	select {
+	case e.signal <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,80 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// expectNothing 确认SDK在一段时间内没有发送任何消息
+func (h *fakeHost) expectNothing(d time.Duration) {
+	h.t.Helper()
+
+	h.conn.SetReadDeadline(time.Now().Add(d))
+	data, err := ReadFrame(h.conn, DefaultMaxFrameSize)
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		h.t.Fatalf("期望没有消息，实际读取到 (%q, %v)", data, err)
+	}
+}
+
+func TestStreamBackpressure(t *testing.T) {
+	const window = 4
+
+	sdk := NewPluginSDK()
+	var emitted atomic.Int64
+	sdk.RegisterStreamFunction("count", func(ctx context.Context, params map[string]interface{}, emitter *StreamEmitter) error {
+		for i := 0; ; i++ {
+			if err := emitter.Emit(i); err != nil {
+				return err
+			}
+			emitted.Add(1)
+		}
+	})
+	host := startPipe(t, sdk)
+
+	// receiveChunks 读取n个数据块并检查序号连续
+	next := 0
+	receiveChunks := func(n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			msg := host.receive()
+			if msg.Type != MessageTypeStreamChunk || msg.Result != float64(next) {
+				t.Fatalf("收到 %s %v, 期望数据块 %d", msg.Type, msg.Result, next)
+			}
+			next++
+		}
+	}
+
+	host.send(&Message{Type: MessageTypeCall, ID: "stream-1", Function: "count", Stream: true, Credit: window})
+
+	// 额度用完后发送方阻塞，主机不消费就不会收到更多数据块
+	receiveChunks(window)
+	host.expectNothing(50 * time.Millisecond)
+	if got := emitted.Load(); got != window {
+		t.Fatalf("额度用完后已发送 %d 个数据块, 期望 %d", got, window)
+	}
+
+	// 归还额度后恢复发送，发送数量不超过归还的额度
+	host.send(&Message{Type: MessageTypeStreamAck, ID: "stream-1", Credit: 2})
+	receiveChunks(2)
+	host.expectNothing(50 * time.Millisecond)
+
+	host.send(&Message{Type: MessageTypeStreamAck, ID: "stream-1", Credit: 1})
+	host.send(&Message{Type: MessageTypeStreamAck, ID: "stream-1", Credit: 2})
+	receiveChunks(3)
+	host.expectNothing(50 * time.Millisecond)
+
+	// 阻塞中的发送方在调用取消后返回
+	host.send(&Message{Type: MessageTypeCancel, ID: "stream-1"})
+	reply := host.receive()
+	if reply.Type != MessageTypeError || reply.ErrorInfo == nil || reply.ErrorInfo.Code != ErrorCodeCanceled {
+		t.Fatalf("取消后回复 = %s %+v, 期望错误码 %s", reply.Type, reply.ErrorInfo, ErrorCodeCanceled)
+	}
+	if got := emitted.Load(); got != window+5 {
+		t.Errorf("共发送 %d 个数据块, 期望 %d", got, window+5)
+	}
+	waitNoCalls(t, sdk)
+}
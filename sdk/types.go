@@ -1,34 +1,51 @@
 package sdk
 
 import (
-	"encoding/json"
+	"context"
 )
 
 // FunctionHandler 函数处理器类型
 type FunctionHandler func(params map[string]interface{}) (interface{}, error)
 
+// StreamHandler 流式函数处理器类型
+// 通过emitter逐块发送结果，返回后流结束
+type StreamHandler func(ctx context.Context, params map[string]interface{}, emitter *StreamEmitter) error
+
+// ContextFunctionHandler 带上下文的函数处理器类型
+// 主机取消调用或调用超时后，ctx会被取消
+type ContextFunctionHandler func(ctx context.Context, params map[string]interface{}) (interface{}, error)
+
 // MessageType 消息类型
 type MessageType string
 
 const (
-	MessageTypeRegister     MessageType = "register"     // 注册消息
-	MessageTypeRegisterAck  MessageType = "register_ack" // 注册确认消息
-	MessageTypeCall         MessageType = "call"         // 调用消息
-	MessageTypeResult       MessageType = "result"       // 结果消息
-	MessageTypeError        MessageType = "error"        // 错误消息
-	MessageTypePing         MessageType = "ping"         // 心跳消息
-	MessageTypePong         MessageType = "pong"         // 心跳响应
-	MessageTypeStop         MessageType = "stop"         // 停止消息
+	MessageTypeRegister    MessageType = "register"     // 注册消息
+	MessageTypeRegisterAck MessageType = "register_ack" // 注册确认消息
+	MessageTypeCall        MessageType = "call"         // 调用消息
+	MessageTypeResult      MessageType = "result"       // 结果消息
+	MessageTypeError       MessageType = "error"        // 错误消息
+	MessageTypePing        MessageType = "ping"         // 心跳消息
+	MessageTypePong        MessageType = "pong"         // 心跳响应
+	MessageTypeStop        MessageType = "stop"         // 停止消息
+	MessageTypeCancel      MessageType = "cancel"       // 取消调用消息
+	MessageTypeStreamChunk MessageType = "stream_chunk" // 流式数据块
+	MessageTypeStreamEnd   MessageType = "stream_end"   // 流式结束
+	MessageTypeStreamAck   MessageType = "stream_ack"   // 流式额度确认
+	MessageTypeHostCall    MessageType = "host_call"    // 插件调用主机服务
 )
 
 // Message 消息结构
 type Message struct {
-	Type      MessageType       `json:"type"`               // 消息类型
-	ID        string            `json:"id,omitempty"`       // 消息ID
-	Function  string            `json:"function,omitempty"` // 函数名
-	Params    map[string]interface{} `json:"params,omitempty"` // 参数
-	Result    interface{}       `json:"result,omitempty"`   // 结果
-	Error     string            `json:"error,omitempty"`    // 错误信息
+	Type      MessageType            `json:"type"`                 // 消息类型
+	ID        string                 `json:"id,omitempty"`         // 消息ID
+	Function  string                 `json:"function,omitempty"`   // 函数名
+	Params    map[string]interface{} `json:"params,omitempty"`     // 参数
+	Result    interface{}            `json:"result,omitempty"`     // 结果
+	Error     string                 `json:"error,omitempty"`      // 错误信息
+	ErrorInfo *ErrorInfo             `json:"error_info,omitempty"` // 结构化错误信息
+	Timeout   int64                  `json:"timeout,omitempty"`    // 调用剩余超时时间（毫秒）
+	Stream    bool                   `json:"stream,omitempty"`     // 是否为流式调用
+	Credit    int                    `json:"credit,omitempty"`     // 流式额度：可继续发送的数据块数
 }
 
 // RegisterMessage 注册消息
@@ -52,18 +69,14 @@ type ErrorMessage struct {
 	Error string `json:"error"` // 错误信息
 }
 
-// EncodeMessage 编码消息
+// EncodeMessage 使用默认的JSON编解码器编码消息
 func EncodeMessage(msg *Message) ([]byte, error) {
-	return json.Marshal(msg)
+	return JSONCodec.Encode(msg)
 }
 
-// DecodeMessage 解码消息
+// DecodeMessage 使用默认的JSON编解码器解码消息
 func DecodeMessage(data []byte) (*Message, error) {
-	var msg Message
-	if err := json.Unmarshal(data, &msg); err != nil {
-		return nil, err
-	}
-	return &msg, nil
+	return JSONCodec.Decode(data)
 }
 
 // PluginInfo 插件信息
@@ -71,4 +84,4 @@ type PluginInfo struct {
 	Name      string   `json:"name"`      // 插件名称
 	Version   string   `json:"version"`   // 插件版本
 	Functions []string `json:"functions"` // 支持的函数
-}
\ No newline at end of file
+}